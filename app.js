@@ -11,7 +11,7 @@ async function checkAuth() {
   
   // Check if user is authenticated
   if (!token) {
-    window.location = '/auth';
+    window.location = '/auth?next=' + encodeURIComponent(currentPath + window.location.search);
     return;
   }
   
@@ -23,7 +23,7 @@ async function checkAuth() {
   } catch (err) {
     // Token invalid, redirect to auth
     localStorage.removeItem('token');
-    window.location = '/auth';
+    window.location = '/auth?next=' + encodeURIComponent(currentPath + window.location.search);
   }
 }
 
@@ -87,8 +87,11 @@ function getToken() {
 
 async function logout() {
   try {
-    // Inform backend to clear HTTP-only auth cookie
-    await fetch('/api/auth/logout', { method: 'POST' });
+    // End the session server-side and clear the HTTP-only auth cookies
+    await fetch('/api/auth/logout', {
+      method: 'POST',
+      headers: { 'Authorization': 'Bearer ' + getToken(), 'X-CSRF-Token': csrfToken() }
+    });
   } catch (e) {
     console.error('Logout request failed:', e);
   }
@@ -103,8 +106,49 @@ function setThemeFromTeam(team) {
   document.documentElement.style.setProperty('--secondary', team.secondaryColor || '#555');
 }
 
+// csrfToken reads the CSRF cookie set at login. The server wants it back in
+// the X-CSRF-Token header on state-changing requests that rely on cookies.
+function csrfToken() {
+  const m = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]*)/);
+  return m ? decodeURIComponent(m[1]) : '';
+}
+
+function withCSRF(opts) {
+  const token = csrfToken();
+  if (!token) return opts;
+  return { ...opts, headers: { ...(opts.headers || {}), 'X-CSRF-Token': token } };
+}
+
+// refreshToken trades the refresh cookie for a new access token. Concurrent
+// callers share one request, since each refresh token only works once.
+let refreshing = null;
+function refreshToken() {
+  if (!refreshing) {
+    refreshing = fetch('/api/auth/refresh', withCSRF({ method: 'POST', credentials: 'same-origin' }))
+      .then(res => res.ok ? res.json() : null)
+      .then(resp => {
+        if (resp && resp.token) localStorage.setItem('token', resp.token);
+        return resp ? resp.token : null;
+      })
+      .catch(() => null)
+      .finally(() => { refreshing = null; });
+  }
+  return refreshing;
+}
+
 async function fetchJSON(url, opts={}) {
-  const res = await fetch(url, opts);
+  let res = await fetch(url, withCSRF(opts));
+  // Access tokens are short-lived: on a 401 for an authenticated call, refresh
+  // once and retry with the new token.
+  const auth = opts.headers && opts.headers['Authorization'];
+  if (res.status === 401 && auth) {
+    const token = await refreshToken();
+    if (token) {
+      opts = { ...opts, headers: { ...opts.headers, 'Authorization': 'Bearer ' + token } };
+      // The refresh also replaced the CSRF cookie.
+      res = await fetch(url, withCSRF(opts));
+    }
+  }
   if (!res.ok) throw new Error(await res.text());
   return res.json();
 }
@@ -165,20 +209,21 @@ window.initTableLive = function initTableLive() {
         tr.classList.add('team-live');
         statusCell = '<span class="live-badge">LIVE</span>';
       }
-      tr.innerHTML = `<td>${idx+1}</td><td>${r.team}</td><td>${r.played}</td><td>${r.points}</td><td>${r.gd}</td><td>${statusCell}</td>`;
+      tr.innerHTML = `<td>${idx+1}</td><td>${r.team}</td><td>${r.live ? r.provisional_played : r.played}</td><td>${r.live ? r.provisional_points : r.points}</td><td>${r.live ? r.provisional_gd : r.gd}</td><td>${statusCell}</td>`;
       tbody.appendChild(tr);
     });
   }
   function connectWS() {
-    ws = new WebSocket('ws://' + window.location.host + '/ws/standings');
+    const scheme = window.location.protocol === 'https:' ? 'wss://' : 'ws://';
+    ws = new WebSocket(scheme + window.location.host + '/ws?topics=standings');
     ws.onopen = () => {
       console.log('WebSocket connected');
     };
     ws.onmessage = (event) => {
-      const data = JSON.parse(event.data);
-      if (data.standings) {
-        renderTable(data.standings);
-        const anyLive = data.standings.some(t => t.live);
+      const msg = JSON.parse(event.data);
+      if (msg.type === 'update' && msg.topic === 'standings') {
+        renderTable(msg.data);
+        const anyLive = msg.data.some(t => t.live);
         liveIndicator.style.display = anyLive ? '' : 'none';
       }
     };
@@ -204,18 +249,36 @@ window.initProfilePage = async function initProfilePage() {
   const emailDisplay = document.getElementById('displayEmail');
   const roleDisplay = document.getElementById('displayRole');
   const favTeamDisplay = document.getElementById('displayFavoriteTeam');
+  const sessionList = document.getElementById('sessionList');
+  const verifyNotice = document.getElementById('verifyNotice');
+  const resendVerifyBtn = document.getElementById('resendVerifyBtn');
+  const logoutAllBtn = document.getElementById('logoutAllBtn');
 
   loginBtn.onclick = async () => {
     try {
       const body = { email: emailEl.value, password: pwEl.value };
-      const resp = await fetchJSON('/api/auth/login', {
+      let resp = await fetchJSON('/api/auth/login', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify(body),
       });
+      if (resp.twoFactorRequired) {
+        const code = prompt('Enter the code from your authenticator app (or a recovery code):');
+        if (!code) {
+          statusEl.textContent = 'Login cancelled';
+          return;
+        }
+        resp = await fetchJSON('/api/auth/login/2fa', {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ challenge: resp.challenge, code: code.trim() }),
+        });
+      }
       localStorage.setItem('token', resp.token);
       statusEl.textContent = 'Logged in';
       await loadMe();
+      await loadTwoFactor();
+      await loadSessions();
     } catch (e) {
       statusEl.textContent = 'Login failed';
     }
@@ -253,6 +316,9 @@ window.initProfilePage = async function initProfilePage() {
       if (roleDisplay && (me.Role || me.role)) {
         roleDisplay.textContent = me.Role || me.role;
       }
+      if (verifyNotice) {
+        verifyNotice.style.display = me.EmailVerifiedAt ? 'none' : '';
+      }
       const favTeam = me.FavoriteTeam || me.favoriteTeam;
       if (favTeamDisplay) {
         favTeamDisplay.textContent = favTeam && (favTeam.Name || favTeam.name) ? (favTeam.Name || favTeam.name) : 'Not set';
@@ -293,6 +359,190 @@ window.initProfilePage = async function initProfilePage() {
     }
   }
 
+  // describeAgent turns a user agent into something like "Firefox on Windows".
+  function describeAgent(ua) {
+    if (!ua) return 'Unknown device';
+    const browser = /Edg\//.test(ua) ? 'Edge' : /OPR\//.test(ua) ? 'Opera' : /Firefox\//.test(ua) ? 'Firefox'
+      : /Chrome\//.test(ua) ? 'Chrome' : /Safari\//.test(ua) ? 'Safari' : ua.split(' ')[0];
+    const os = /Android/.test(ua) ? 'Android' : /iPhone|iPad/.test(ua) ? 'iOS' : /Windows/.test(ua) ? 'Windows'
+      : /Mac OS X/.test(ua) ? 'macOS' : /Linux/.test(ua) ? 'Linux' : '';
+    return os ? browser + ' on ' + os : browser;
+  }
+
+  async function loadSessions() {
+    if (!sessionList) return;
+    let sessions;
+    try {
+      sessions = await fetchJSON('/api/profile/sessions', {
+        headers: { 'Authorization': 'Bearer ' + getToken() }
+      });
+    } catch (e) {
+      sessionList.textContent = 'Log in to see your sessions.';
+      return;
+    }
+    sessionList.innerHTML = '';
+    sessions.forEach(s => {
+      const row = document.createElement('div');
+      row.style.cssText = 'display: flex; justify-content: space-between; align-items: center; gap: var(--spacing-md); padding: var(--spacing-md); background: var(--bg-tertiary); border-radius: var(--radius-md);';
+      const info = document.createElement('div');
+      const title = document.createElement('div');
+      title.style.cssText = 'color: var(--text-primary); font-weight: 600;';
+      title.textContent = describeAgent(s.userAgent) + (s.current ? ' (this device)' : '');
+      title.title = s.userAgent || '';
+      const meta = document.createElement('div');
+      meta.style.cssText = 'color: var(--text-muted); font-size: 0.875rem;';
+      meta.textContent = (s.ip || 'unknown IP') + ' · signed in ' + new Date(s.createdAt).toLocaleString()
+        + ' · last active ' + new Date(s.lastUsedAt).toLocaleString();
+      info.append(title, meta);
+      const btn = document.createElement('button');
+      btn.className = 'btn btn-secondary';
+      btn.textContent = 'Sign Out';
+      btn.onclick = async () => {
+        try {
+          await fetchJSON('/api/profile/sessions/' + s.id, {
+            method: 'DELETE',
+            headers: { 'Authorization': 'Bearer ' + getToken() }
+          });
+        } catch (e) {
+          showNotification('Failed to sign out that device.', 'error');
+          return;
+        }
+        if (s.current) {
+          logout();
+          return;
+        }
+        showNotification('Device signed out.', 'info');
+        await loadSessions();
+      };
+      row.append(info, btn);
+      sessionList.appendChild(row);
+    });
+  }
+
+  const twoFactorState = document.getElementById('twoFactorState');
+  const twoFactorSetup = document.getElementById('twoFactorSetup');
+  const twoFactorSetupBtn = document.getElementById('twoFactorSetupBtn');
+  const twoFactorConfirmBtn = document.getElementById('twoFactorConfirmBtn');
+  const twoFactorDisableBtn = document.getElementById('twoFactorDisableBtn');
+  const recoveryCodesBtn = document.getElementById('recoveryCodesBtn');
+  const recoveryCodes = document.getElementById('recoveryCodes');
+
+  function showRecoveryCodes(codes) {
+    document.getElementById('recoveryCodeList').textContent = codes.join('\n');
+    recoveryCodes.style.display = '';
+  }
+
+  async function authPost(url, body) {
+    return fetchJSON(url, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json', 'Authorization': 'Bearer ' + getToken() },
+      body: JSON.stringify(body || {}),
+    });
+  }
+
+  async function loadTwoFactor() {
+    if (!twoFactorState) return;
+    let st;
+    try {
+      st = await fetchJSON('/api/profile/2fa', {
+        headers: { 'Authorization': 'Bearer ' + getToken() }
+      });
+    } catch (e) {
+      return;
+    }
+    if (st.enabled) {
+      twoFactorState.textContent = 'Two-factor authentication is on. ' + st.recoveryCodesLeft + ' recovery codes left.';
+    } else {
+      twoFactorState.textContent = st.required
+        ? 'Your role requires two-factor authentication. Set it up to use admin tools.'
+        : 'Protect your account with a code from an authenticator app when you log in.';
+    }
+    twoFactorSetupBtn.style.display = st.enabled ? 'none' : '';
+    recoveryCodesBtn.style.display = st.enabled ? '' : 'none';
+    twoFactorDisableBtn.style.display = st.enabled && !st.required ? '' : 'none';
+  }
+
+  if (twoFactorSetupBtn) {
+    twoFactorSetupBtn.onclick = async () => {
+      try {
+        const setup = await authPost('/api/profile/2fa/setup');
+        document.getElementById('twoFactorUri').href = setup.uri;
+        document.getElementById('twoFactorSecret').textContent = setup.secret.match(/.{1,4}/g).join(' ');
+        twoFactorSetup.style.display = '';
+        twoFactorSetupBtn.style.display = 'none';
+      } catch (e) {
+        showNotification('Could not start two-factor setup.', 'error');
+      }
+    };
+    twoFactorConfirmBtn.onclick = async () => {
+      try {
+        const resp = await authPost('/api/profile/2fa/enable', { code: document.getElementById('twoFactorCode').value.trim() });
+        if (resp.token) localStorage.setItem('token', resp.token);
+        twoFactorSetup.style.display = 'none';
+        showRecoveryCodes(resp.recoveryCodes);
+        showNotification('Two-factor authentication is on.', 'info');
+        await loadTwoFactor();
+      } catch (e) {
+        showNotification('That code did not match. Check the time on your phone and try again.', 'error');
+      }
+    };
+    recoveryCodesBtn.onclick = async () => {
+      const code = prompt('Enter a code from your authenticator app to replace your recovery codes:');
+      if (!code) return;
+      try {
+        const resp = await authPost('/api/profile/2fa/recovery-codes', { code });
+        showRecoveryCodes(resp.recoveryCodes);
+        await loadTwoFactor();
+      } catch (e) {
+        showNotification('Invalid code.', 'error');
+      }
+    };
+    twoFactorDisableBtn.onclick = async () => {
+      const password = prompt('Enter your password to turn off two-factor authentication:');
+      if (!password) return;
+      const code = prompt('Enter a code from your authenticator app (or a recovery code):');
+      if (!code) return;
+      try {
+        await authPost('/api/profile/2fa/disable', { password, code });
+        recoveryCodes.style.display = 'none';
+        showNotification('Two-factor authentication is off.', 'info');
+        await loadTwoFactor();
+      } catch (e) {
+        showNotification('Wrong password or code.', 'error');
+      }
+    };
+  }
+
+  if (resendVerifyBtn) {
+    resendVerifyBtn.onclick = async () => {
+      try {
+        await fetchJSON('/api/auth/resend-verification', {
+          method: 'POST',
+          headers: { 'Authorization': 'Bearer ' + getToken() }
+        });
+        showNotification('Verification email sent. Check your inbox.', 'info');
+      } catch (e) {
+        showNotification('Could not send the verification email.', 'error');
+      }
+    };
+  }
+
+  if (logoutAllBtn) {
+    logoutAllBtn.onclick = async () => {
+      if (!confirm('Sign out of every device, including this one?')) return;
+      try {
+        await fetchJSON('/api/auth/logout-all', {
+          method: 'POST',
+          headers: { 'Authorization': 'Bearer ' + getToken() }
+        });
+      } catch (e) {
+        showNotification('Failed to sign out everywhere.', 'error');
+        return;
+      }
+      logout();
+    };
+  }
+
   saveFavBtn.onclick = async () => {
     const teamId = parseInt(teamSelect.value, 10);
     if (!teamId) {
@@ -317,6 +567,8 @@ window.initProfilePage = async function initProfilePage() {
 
   await loadTeams();
   await loadMe();
+  await loadTwoFactor();
+  await loadSessions();
 }
 
 window.initAuthPage = async function initAuthPage() {
@@ -344,19 +596,27 @@ window.initAuthPage = async function initAuthPage() {
   }
   await loadTeams();
 
+  const forgotForm = document.getElementById('forgotForm');
+  const resetForm = document.getElementById('resetForm');
+  const inviteForm = document.getElementById('inviteForm');
+  const twoFactorForm = document.getElementById('twoFactorForm');
+  let twoFactorChallenge = null;
+
+  // showForm reveals one of the auth forms and hides the rest.
+  function showForm(form) {
+    [loginForm, registerForm, forgotForm, resetForm, inviteForm, twoFactorForm].forEach(f => {
+      if (f) f.classList.toggle('auth-form--hidden', f !== form);
+    });
+    tabs.forEach(t => {
+      t.classList.toggle('auth-tab--active', (t.dataset.tab === 'login' && form === loginForm) ||
+        (t.dataset.tab === 'register' && form === registerForm));
+    });
+  }
+
   // Tab switching
   tabs.forEach(tab => {
     tab.addEventListener('click', () => {
-      tabs.forEach(t => t.classList.remove('auth-tab--active'));
-      tab.classList.add('auth-tab--active');
-      const target = tab.dataset.tab;
-      if (target === 'login') {
-        loginForm.classList.remove('auth-form--hidden');
-        registerForm.classList.add('auth-form--hidden');
-      } else {
-        registerForm.classList.remove('auth-form--hidden');
-        loginForm.classList.add('auth-form--hidden');
-      }
+      showForm(tab.dataset.tab === 'login' ? loginForm : registerForm);
     });
   });
 
@@ -367,6 +627,156 @@ window.initAuthPage = async function initAuthPage() {
     if (type === 'error') el.classList.add('auth-message--error');
   }
 
+  // errorText pulls the message out of a failed fetchJSON call.
+  function errorText(err, fallback) {
+    try {
+      return JSON.parse(err.message).error || fallback;
+    } catch (e) {
+      return fallback;
+    }
+  }
+
+  // Links from emails land here as /auth?verify=..., /auth?reset=... or
+  // /auth?invite=...
+  const params = new URLSearchParams(window.location.search);
+  const verifyToken = params.get('verify');
+  const resetToken = params.get('reset');
+  const inviteToken = params.get('invite');
+
+  // Protected pages send visitors here as /auth?next=/page. Only local paths
+  // are followed so the link cannot bounce users to another site. If the
+  // access cookie merely expired, the refresh cookie gets them straight back;
+  // provider sign-ins also come back this way.
+  const nextParam = params.get('next') || '';
+  const next = /^\/(?![\/\\])/.test(nextParam) ? nextParam : null;
+  const oidcError = params.get('oidcError');
+  const providerChallenge = params.get('twofactor');
+  if (next && !verifyToken && !resetToken && !inviteToken && !oidcError && !providerChallenge) {
+    const token = await refreshToken();
+    if (token) {
+      await checkUserAndRedirect(token);
+      return;
+    }
+  }
+  if (verifyToken || resetToken || inviteToken || oidcError || providerChallenge) {
+    history.replaceState(null, '', next ? '/auth?next=' + encodeURIComponent(next) : '/auth');
+  }
+
+  // Sign-in buttons for the configured identity providers.
+  const providerBox = document.getElementById('oidcProviders');
+  if (providerBox) {
+    try {
+      const providers = await fetchJSON('/api/auth/oidc/providers');
+      providers.forEach(p => {
+        const link = document.createElement('a');
+        link.className = 'btn btn-secondary';
+        link.href = '/api/auth/oidc/' + encodeURIComponent(p.name) + '/login' + (next ? '?next=' + encodeURIComponent(next) : '');
+        link.textContent = 'Continue with ' + p.displayName;
+        providerBox.appendChild(link);
+      });
+      providerBox.hidden = providers.length === 0;
+    } catch (err) {
+      console.error('Failed to load sign-in providers:', err);
+    }
+  }
+  const oidcMessages = {
+    expired: 'That sign-in expired or was started in another browser. Please try again.',
+    denied: 'Sign-in was cancelled at the provider.',
+    no_email: 'The provider did not share your email address, which we need to sign you in.',
+    email_unverified: 'An account with this email already exists. Log in with your password; the provider has not verified the address.',
+    suspended: 'This account is suspended.',
+    failed: 'Sign-in with the provider failed. Please try again.',
+  };
+  if (oidcError) {
+    setMessage(loginMsg, oidcMessages[oidcError] || oidcMessages.failed, 'error');
+  }
+  if (verifyToken) {
+    try {
+      await fetchJSON('/api/auth/verify-email', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ token: verifyToken }),
+      });
+      setMessage(loginMsg, 'Email verified. You can now post in match threads.', 'success');
+    } catch (err) {
+      setMessage(loginMsg, errorText(err, 'Verification failed.'), 'error');
+    }
+  }
+  if (resetToken && resetForm) {
+    showForm(resetForm);
+    resetForm.addEventListener('submit', async (e) => {
+      e.preventDefault();
+      const resetMsg = document.getElementById('resetMessage');
+      try {
+        await fetchJSON('/api/auth/reset-password', {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ token: resetToken, password: document.getElementById('resetPassword').value }),
+        });
+        localStorage.removeItem('token');
+        showForm(loginForm);
+        setMessage(loginMsg, 'Password changed. Log in with your new password.', 'success');
+      } catch (err) {
+        setMessage(resetMsg, errorText(err, 'Could not reset your password.'), 'error');
+      }
+    });
+  }
+
+  if (inviteToken && inviteForm) {
+    showForm(inviteForm);
+    inviteForm.addEventListener('submit', async (e) => {
+      e.preventDefault();
+      const inviteMsg = document.getElementById('inviteMessage');
+      try {
+        const resp = await fetchJSON('/api/auth/accept-invite', {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({
+            token: inviteToken,
+            name: document.getElementById('inviteName').value.trim(),
+            password: document.getElementById('invitePassword').value,
+          }),
+        });
+        localStorage.setItem('token', resp.token);
+        setMessage(inviteMsg, 'Welcome aboard! Redirecting…', 'success');
+        setTimeout(() => {
+          checkUserAndRedirect(resp.token);
+        }, 800);
+      } catch (err) {
+        setMessage(inviteMsg, errorText(err, 'Could not accept the invitation.'), 'error');
+      }
+    });
+  }
+
+  const forgotLink = document.getElementById('forgotLink');
+  if (forgotLink && forgotForm) {
+    forgotLink.addEventListener('click', (e) => {
+      e.preventDefault();
+      document.getElementById('forgotEmail').value = document.getElementById('loginEmail').value.trim();
+      showForm(forgotForm);
+    });
+    forgotForm.addEventListener('submit', async (e) => {
+      e.preventDefault();
+      const forgotMsg = document.getElementById('forgotMessage');
+      try {
+        await fetchJSON('/api/auth/forgot-password', {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ email: document.getElementById('forgotEmail').value.trim() }),
+        });
+        setMessage(forgotMsg, 'If that address has an account, a reset link is on its way.', 'success');
+      } catch (err) {
+        setMessage(forgotMsg, errorText(err, 'Could not send the reset email.'), 'error');
+      }
+    });
+  }
+
+  // Accounts with 2FA come back from a provider with a login challenge.
+  if (providerChallenge && twoFactorForm) {
+    twoFactorChallenge = providerChallenge;
+    showForm(twoFactorForm);
+  }
+
   async function checkUserAndRedirect(token) {
     try {
       const me = await fetchJSON('/api/profile/me', {
@@ -376,7 +786,7 @@ window.initAuthPage = async function initAuthPage() {
       if (!me.FavoriteTeam && !me.favoriteTeam) {
         window.location = '/profile';
       } else {
-        window.location = '/feed';
+        window.location = next || '/feed';
       }
     } catch (err) {
       console.error('Failed to check user:', err);
@@ -395,6 +805,13 @@ window.initAuthPage = async function initAuthPage() {
           headers: { 'Content-Type': 'application/json' },
           body: JSON.stringify({ email, password }),
         });
+        if (resp.twoFactorRequired) {
+          twoFactorChallenge = resp.challenge;
+          setMessage(loginMsg, '', null);
+          showForm(twoFactorForm);
+          document.getElementById('twoFactorCode').focus();
+          return;
+        }
         localStorage.setItem('token', resp.token);
         setMessage(loginMsg, 'Login successful! Redirecting…', 'success');
         showNotification('Welcome back!', 'info');
@@ -403,7 +820,38 @@ window.initAuthPage = async function initAuthPage() {
         }, 800);
       } catch (err) {
         console.error(err);
-        setMessage(loginMsg, 'Login failed. Check your email and password.', 'error');
+        // Show throttling and suspension messages as they are; anything else is bad credentials.
+        const msg = errorText(err, '');
+        const shown = msg.startsWith('too many') || msg === 'this account is suspended';
+        setMessage(loginMsg, shown ? msg : 'Login failed. Check your email and password.', 'error');
+      }
+    });
+  }
+
+  // Second login step for accounts with two-factor authentication.
+  if (twoFactorForm) {
+    twoFactorForm.addEventListener('submit', async (e) => {
+      e.preventDefault();
+      const twoFactorMsg = document.getElementById('twoFactorMessage');
+      try {
+        const resp = await fetchJSON('/api/auth/login/2fa', {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ challenge: twoFactorChallenge, code: document.getElementById('twoFactorCode').value.trim() }),
+        });
+        localStorage.setItem('token', resp.token);
+        setMessage(twoFactorMsg, 'Login successful! Redirecting…', 'success');
+        setTimeout(() => {
+          checkUserAndRedirect(resp.token);
+        }, 800);
+      } catch (err) {
+        const msg = errorText(err, 'Invalid code.');
+        if (msg.startsWith('login challenge')) {
+          showForm(loginForm);
+          setMessage(loginMsg, msg, 'error');
+        } else {
+          setMessage(twoFactorMsg, msg, 'error');
+        }
       }
     });
   }
@@ -431,7 +879,7 @@ window.initAuthPage = async function initAuthPage() {
           headers: { 'Content-Type': 'application/json' },
           body: JSON.stringify(body),
         });
-        setMessage(registerMsg, 'Account created! Logging you in...', 'success');
+        setMessage(registerMsg, 'Account created! Check your email to verify your address. Logging you in...', 'success');
         showNotification('Account created successfully!', 'info');
         
         // Auto-login after registration
@@ -446,18 +894,13 @@ window.initAuthPage = async function initAuthPage() {
             window.location = '/feed';
           } catch (err) {
             // Switch to login tab if auto-login fails
-            tabs.forEach(t => {
-              if (t.dataset.tab === 'login') t.classList.add('auth-tab--active');
-              else t.classList.remove('auth-tab--active');
-            });
-            registerForm.classList.add('auth-form--hidden');
-            loginForm.classList.remove('auth-form--hidden');
+            showForm(loginForm);
             setMessage(registerMsg, 'Account created! Please log in.', 'success');
           }
         }, 1000);
       } catch (err) {
         console.error(err);
-        setMessage(registerMsg, 'Registration failed. Try a different email.', 'error');
+        setMessage(registerMsg, errorText(err, 'Registration failed. Try a different email.'), 'error');
       }
     });
   }
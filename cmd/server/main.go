@@ -1,26 +1,54 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"project/internal/cache"
+	"project/internal/chat"
 	"project/internal/config"
 	"project/internal/database"
+	"project/internal/filter"
 	"project/internal/handlers"
+	"project/internal/hub"
+	"project/internal/jwtkeys"
+	"project/internal/mail"
+	"project/internal/middleware"
 	"project/internal/migrations"
+	"project/internal/oidc"
 	"project/internal/services"
 )
 
 func main() {
 	_ = os.Setenv("GIN_MODE", "release")
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	if cfg.JWTSecret == config.DefaultJWTSecret {
+		log.Printf("config: using the development JWT_SECRET; do not deploy like this")
+	}
+	keys, err := jwtkeys.New(cfg.JWT)
+	if err != nil {
+		log.Fatalf("jwt keys: %v", err)
+	}
 	db := database.Connect(cfg)
+	if cfg.RedisAddr != "" {
+		cache.InitRedis(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB)
+	}
 	if err := migrations.AutoMigrateAndSeed(cfg); err != nil {
 		log.Fatal(err)
 	}
 
 	router := gin.New()
+	// Only trusted proxies may set X-Forwarded-For; otherwise anyone could
+	// pick the IP the login throttle counts.
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("TRUSTED_PROXIES: %v", err)
+	}
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 
@@ -43,14 +71,112 @@ func main() {
 	router.GET("/profile", func(c *gin.Context) {
 		c.HTML(200, "profile.html", gin.H{})
 	})
-	
-	// Protected routes - require authentication
+
+	events := services.NewEventBus()
+	table := &services.TableService{DB: db}
+	table.Subscribe(events)
+	if err := table.SyncTeamCounters(); err != nil {
+		log.Printf("team counters: %v", err)
+	}
+	matches := &services.MatchService{DB: db, Events: events}
+	matchEvents := &services.MatchEventService{DB: db, Matches: matches, Events: events}
+	matchThreads := &services.MatchThreads{
+		DB:              db,
+		MatchEvents:     matchEvents,
+		PreMatchOffset:  cfg.PreMatchThreadOffset,
+		PostMatchOffset: cfg.PostMatchThreadOffset,
+	}
+	matchThreads.Subscribe(events)
+	go matchThreads.Run(context.Background(), cfg.ThreadSchedulerEvery)
+
+	contentFilter := filter.NewPipeline(filter.Default()...)
+	if cfg.ContentFilterFile != "" {
+		filters, err := filter.Load(cfg.ContentFilterFile)
+		if err != nil {
+			log.Fatalf("content filter: %v", err)
+		}
+		contentFilter.Replace(filters)
+		go filter.Watch(context.Background(), contentFilter, cfg.ContentFilterFile, cfg.ContentFilterReload)
+	}
+
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("mail: %v", err)
+	}
+	loginGuard := services.NewLoginGuard(db, cache.NewCounters("login:"))
+	loginGuard.Account.LockAfter = cfg.LoginLockoutThreshold
+	loginGuard.Account.LockFor = cfg.LoginLockoutDuration
+	loginGuard.IP.LockFor = cfg.LoginLockoutDuration
+	auth := &services.AuthService{
+		DB:              db,
+		Keys:            keys,
+		JWTSecret:       cfg.JWTSecret,
+		AccessTTL:       cfg.AccessTokenTTL,
+		RefreshTTL:      cfg.RefreshTokenTTL,
+		Mailer:          mailer,
+		BaseURL:         cfg.BaseURL,
+		VerifyTTL:       cfg.EmailVerifyTTL,
+		ResetTTL:        cfg.PasswordResetTTL,
+		Guard:           loginGuard,
+		TOTPIssuer:      cfg.TOTPIssuer,
+		RequireAdmin2FA: cfg.RequireAdmin2FA,
+	}
+	// An admin created without ADMIN_PASSWORD gets a one-time link to
+	// choose one; it goes to the log, never to the mailer.
+	for _, email := range []string{cfg.AdminEmail, migrations.LegacyAdminEmail} {
+		if link, err := auth.BootstrapAdmin(email); err != nil {
+			log.Fatalf("bootstrap admin: %v", err)
+		} else if link != "" {
+			log.Printf("bootstrap: admin %s has no password; set one within 24 hours at %s", email, link)
+		}
+	}
+	for _, pc := range cfg.OIDC {
+		auth.Providers = append(auth.Providers, oidc.NewClient(pc, nil))
+	}
+	if cfg.OIDCMock {
+		// The mock runs inside this server; the client reaches it in-process.
+		issuer := strings.TrimRight(cfg.BaseURL, "/") + "/oidc-mock"
+		secret, err := oidc.RandomString(24)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mock, err := oidc.NewMock(issuer, "epl-dev", secret)
+		if err != nil {
+			log.Fatalf("oidc mock: %v", err)
+		}
+		router.GET("/oidc-mock/*path", gin.WrapH(mock))
+		router.POST("/oidc-mock/*path", gin.WrapH(mock))
+		auth.Providers = append(auth.Providers, oidc.NewClient(oidc.Config{
+			Name:         "mock",
+			DisplayName:  "Mock provider",
+			Issuer:       issuer,
+			ClientID:     "epl-dev",
+			ClientSecret: secret,
+			RedirectURL:  cfg.OIDCRedirectURL("mock"),
+		}, mock.HTTPClient()))
+		log.Printf("oidc: mock provider at %s", issuer)
+	}
+
+	api := &handlers.API{
+		Auth:        auth,
+		Teams:       &services.TeamService{DB: db},
+		Players:     &services.PlayerService{DB: db},
+		Matches:     matches,
+		Table:       table,
+		Calendar:    &services.CalendarService{DB: db},
+		MatchEvents: matchEvents,
+		Threads:     &services.ThreadService{DB: db, Filter: contentFilter},
+		Moderation:  &services.ModerationService{DB: db},
+		Events:      events,
+		Keys:        keys,
+		BaseURL:     cfg.BaseURL,
+	}
+	api.RegisterRoutes(router)
+
+	// Protected routes - require authentication; anonymous visitors are
+	// redirected to /auth?next=...
 	protected := router.Group("/")
-	protected.Use(func(c *gin.Context) {
-		// Check token in cookie or localStorage (handled by JS)
-		// Server-side: allow HTML to load, JS will handle redirect
-		c.Next()
-	})
+	protected.Use(middleware.AuthHTML(keys, auth.SessionActive))
 	protected.GET("/feed", func(c *gin.Context) {
 		c.HTML(200, "index.html", gin.H{})
 	})
@@ -70,15 +196,13 @@ func main() {
 		c.HTML(200, "account.html", gin.H{})
 	})
 
-	api := &handlers.API{
-		Auth:      &services.AuthService{DB: db, JWTSecret: cfg.JWTSecret},
-		Teams:     &services.TeamService{DB: db},
-		Players:   &services.PlayerService{DB: db},
-		Matches:   &services.MatchService{DB: db},
-		Table:     &services.TableService{DB: db},
-		JWTSecret: cfg.JWTSecret,
-	}
-	api.RegisterRoutes(router)
+	realtime := hub.New()
+	realtime.CheckOrigin = cfg.SameOrigin
+	api.AttachHub(realtime)
+	router.GET("/ws", gin.WrapH(realtime))
+	chats := chat.NewManager()
+	chats.CheckOrigin = cfg.SameOrigin
+	api.AttachChat(chats)
 
 	if err := router.Run(":8080"); err != nil {
 		log.Fatal(err)
@@ -43,6 +43,13 @@ func GetRedis(key string, dest interface{}) (bool, error) {
 	return json.Unmarshal([]byte(val), dest) == nil, nil
 }
 
+func DelRedis(key string) error {
+	if redisClient == nil {
+		return nil
+	}
+	return redisClient.Del(context.Background(), key).Err()
+}
+
 type Item struct {
 	Value      interface{}
 	Expiration int64
@@ -72,3 +79,9 @@ func (c *Cache) Get(key string) (interface{}, bool) {
 	}
 	return it.Value, true
 }
+
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.store, key)
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RedisEnabled reports whether InitRedis has been called.
+func RedisEnabled() bool {
+	return redisClient != nil
+}
+
+// IncrRedis increments key and (re)starts its expiry, returning the new
+// value.
+func IncrRedis(key string, ttl time.Duration) (int64, error) {
+	if redisClient == nil {
+		return 0, nil
+	}
+	ctx := context.Background()
+	pipe := redisClient.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.PExpire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// Counters are expiring counters and deadlines kept in Redis, falling back
+// to process memory whenever Redis is not configured or a call fails. The
+// fallback is per process, so with several instances and no Redis each
+// keeps its own counts.
+type Counters struct {
+	Prefix string
+
+	mu     sync.Mutex
+	counts map[string]counter
+	writes int
+}
+
+type counter struct {
+	n       int64
+	until   time.Time
+	expires time.Time
+}
+
+func NewCounters(prefix string) *Counters {
+	return &Counters{Prefix: prefix, counts: make(map[string]counter)}
+}
+
+// Incr adds one to key and returns the new count. The count expires window
+// after the last increment.
+func (c *Counters) Incr(key string, window time.Duration) int64 {
+	key = c.Prefix + key
+	if RedisEnabled() {
+		if n, err := IncrRedis(key, window); err == nil {
+			return n
+		}
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweepLocked(now)
+	v := c.counts[key]
+	if now.After(v.expires) {
+		v = counter{}
+	}
+	v.n++
+	v.expires = now.Add(window)
+	c.counts[key] = v
+	return v.n
+}
+
+// SetUntil records a deadline under key; it disappears once it passes.
+func (c *Counters) SetUntil(key string, until time.Time) {
+	key = c.Prefix + key
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return
+	}
+	if RedisEnabled() {
+		if err := SetRedis(key, until.UnixNano(), ttl); err == nil {
+			return
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweepLocked(time.Now())
+	c.counts[key] = counter{until: until, expires: until}
+}
+
+// Until returns the deadline stored under key, or the zero time.
+func (c *Counters) Until(key string) time.Time {
+	key = c.Prefix + key
+	if RedisEnabled() {
+		var ns int64
+		if found, err := GetRedis(key, &ns); err == nil {
+			if !found {
+				return time.Time{}
+			}
+			return time.Unix(0, ns)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.counts[key]
+	if !ok || time.Now().After(v.expires) {
+		return time.Time{}
+	}
+	return v.until
+}
+
+// Del removes keys from both stores.
+func (c *Counters) Del(keys ...string) {
+	c.mu.Lock()
+	for _, k := range keys {
+		delete(c.counts, c.Prefix+k)
+	}
+	c.mu.Unlock()
+	if RedisEnabled() {
+		for _, k := range keys {
+			_ = DelRedis(c.Prefix + k)
+		}
+	}
+}
+
+// sweepLocked drops expired entries every 256 writes so the fallback map
+// does not grow without bound under a spray of usernames.
+func (c *Counters) sweepLocked(now time.Time) {
+	c.writes++
+	if c.writes%256 != 0 {
+		return
+	}
+	for k, v := range c.counts {
+		if now.After(v.expires) {
+			delete(c.counts, k)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package calendar
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"project/internal/models"
+)
+
+// ContentType is the media type calendar clients expect for .ics feeds.
+const ContentType = "text/calendar; charset=utf-8"
+
+// matchLength is used for DTEND; fixtures carry only a kick-off time.
+const matchLength = 2 * time.Hour
+
+const stampLayout = "20060102T150405Z"
+
+// Write renders matches as an RFC 5545 VCALENDAR. Matches need HomeTeam and
+// AwayTeam preloaded. UIDs are derived from the match ID so clients update
+// events in place when a fixture moves or gets a score.
+func Write(w io.Writer, name string, matches []models.Match) error {
+	cw := &contentWriter{w: w}
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:-//EPLHub//Fixtures//EN")
+	cw.line("CALSCALE:GREGORIAN")
+	cw.line("METHOD:PUBLISH")
+	cw.line("X-WR-CALNAME:" + escapeText(name))
+	cw.line("X-WR-TIMEZONE:UTC")
+	for _, m := range matches {
+		writeEvent(cw, m)
+	}
+	cw.line("END:VCALENDAR")
+	return cw.err
+}
+
+func writeEvent(cw *contentWriter, m models.Match) {
+	start := time.Unix(m.Date, 0).UTC()
+	stamp := m.UpdatedAt.UTC()
+	if stamp.IsZero() {
+		stamp = start
+	}
+	cw.line("BEGIN:VEVENT")
+	cw.line(fmt.Sprintf("UID:match-%d@eplhub", m.ID))
+	cw.line("DTSTAMP:" + stamp.Format(stampLayout))
+	cw.line("LAST-MODIFIED:" + stamp.Format(stampLayout))
+	cw.line("DTSTART:" + start.Format(stampLayout))
+	cw.line("DTEND:" + start.Add(matchLength).Format(stampLayout))
+	cw.line("SUMMARY:" + escapeText(summary(m)))
+	cw.line("DESCRIPTION:" + escapeText(description(m)))
+	if m.Stadium != "" {
+		cw.line("LOCATION:" + escapeText(m.Stadium))
+	}
+	cw.line("STATUS:CONFIRMED")
+	cw.line("TRANSP:TRANSPARENT")
+	cw.line("END:VEVENT")
+}
+
+func finished(m models.Match) bool {
+	return m.Status == "finished" && m.HomeScore != nil && m.AwayScore != nil
+}
+
+func summary(m models.Match) string {
+	if finished(m) {
+		return fmt.Sprintf("%s %d-%d %s", m.HomeTeam.Name, *m.HomeScore, *m.AwayScore, m.AwayTeam.Name)
+	}
+	return fmt.Sprintf("%s vs %s", m.HomeTeam.Name, m.AwayTeam.Name)
+}
+
+func description(m models.Match) string {
+	if finished(m) {
+		return fmt.Sprintf("Full time: %s %d-%d %s", m.HomeTeam.Name, *m.HomeScore, *m.AwayScore, m.AwayTeam.Name)
+	}
+	kickoff := time.Unix(m.Date, 0).UTC().Format("Mon 2 Jan 2006 15:04 MST")
+	if m.Status == "live" {
+		return fmt.Sprintf("%s vs %s is live now (kick-off %s)", m.HomeTeam.Name, m.AwayTeam.Name, kickoff)
+	}
+	competition := m.Competition
+	if competition == "" {
+		competition = "Premier League"
+	}
+	return fmt.Sprintf("%s: %s vs %s, kick-off %s", competition, m.HomeTeam.Name, m.AwayTeam.Name, kickoff)
+}
+
+// escapeText applies the TEXT value escaping from RFC 5545 section 3.3.11.
+func escapeText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// contentWriter writes CRLF-terminated content lines folded at 75 octets
+// (RFC 5545 section 3.1), keeping the first error.
+type contentWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (cw *contentWriter) line(s string) {
+	if cw.err != nil {
+		return
+	}
+	const limit = 75
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		size := len(string(r))
+		if n+size > limit {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	b.WriteString("\r\n")
+	_, cw.err = io.WriteString(cw.w, b.String())
+}
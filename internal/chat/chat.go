@@ -0,0 +1,264 @@
+// Package chat runs ephemeral WebSocket chat rooms for live matches. Rooms
+// live in memory only: they are created when the first fan joins and thrown
+// away, backlog and all, when the match ends.
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	maxTextLength = 500
+	// viewerEvery throttles viewer-count broadcasts when fans come and go.
+	viewerEvery = 2 * time.Second
+	// Mutes and slow mode only last as long as the room anyway.
+	maxMute     = 24 * time.Hour
+	maxSlowMode = 10 * time.Minute
+)
+
+var (
+	ErrRoomClosed      = errors.New("chat room is closed")
+	ErrNotModerator    = errors.New("moderators only")
+	ErrNotSignedIn     = errors.New("sign in to chat")
+	ErrMuted           = errors.New("you are muted in this room")
+	ErrReadOnly        = errors.New("you are banned from posting")
+	ErrNotVerified     = errors.New("verify your email address before chatting")
+	ErrEmptyMessage    = errors.New("message is empty")
+	ErrMessageTooLong  = errors.New("message is too long")
+	ErrRateLimited     = errors.New("you are sending messages too fast")
+	ErrMessageNotFound = errors.New("message not found")
+	ErrInvalidDuration = errors.New("duration out of range")
+	ErrUnknownAction   = errors.New("unknown action")
+)
+
+// User is who is on the other end of a connection. A nil *User is an
+// anonymous viewer who can read but not send; so is a ReadOnly user, such
+// as one serving a posting ban or one who has not verified their email
+// (Unverified says which).
+type User struct {
+	ID         uint
+	Name       string
+	Moderator  bool
+	ReadOnly   bool
+	Unverified bool
+}
+
+// Message is one chat line. IDs are per room and increase monotonically.
+type Message struct {
+	ID     uint64    `json:"id"`
+	UserID uint      `json:"userId"`
+	Author string    `json:"author"`
+	Text   string    `json:"text"`
+	SentAt time.Time `json:"sentAt"`
+}
+
+// Event is the envelope for everything written to a socket.
+type Event struct {
+	Type  string      `json:"type"`
+	Data  interface{} `json:"data,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+// Event types.
+const (
+	TypeWelcome  = "welcome"
+	TypeMessage  = "message"
+	TypeDeleted  = "deleted"
+	TypeViewers  = "viewers"
+	TypeMuted    = "muted"
+	TypeSlowMode = "slow_mode"
+	TypeClosed   = "closed"
+	TypeError    = "error"
+)
+
+// Moderator actions reported to Manager.Audit.
+const (
+	ActionDelete   = "delete_chat_message"
+	ActionMute     = "mute_chat_user"
+	ActionSlowMode = "chat_slow_mode"
+)
+
+// Snapshot is the state a late joiner receives.
+type Snapshot struct {
+	MatchID  uint      `json:"matchId"`
+	Viewers  int       `json:"viewers"`
+	SlowMode int       `json:"slowMode"` // seconds, 0 when off
+	Messages []Message `json:"messages"`
+}
+
+// Manager owns every room.
+type Manager struct {
+	// Backlog is how many recent messages a room keeps for late joiners.
+	Backlog int
+	// RateBurst messages may be sent back to back; after that one more is
+	// allowed every RateEvery.
+	RateBurst int
+	RateEvery time.Duration
+	// Audit, when set, is called for every moderator action.
+	Audit func(moderatorID uint, action string, targetID uint, reason, detail string)
+	// CheckOrigin decides which browser origins may open a socket. Nil
+	// allows only the request's own host.
+	CheckOrigin func(r *http.Request) bool
+
+	mu    sync.Mutex
+	rooms map[uint]*Room
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		Backlog:   100,
+		RateBurst: 5,
+		RateEvery: 2 * time.Second,
+		rooms:     make(map[uint]*Room),
+	}
+}
+
+// room returns the match's room, creating it when create is set.
+func (m *Manager) room(matchID uint, create bool) *Room {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.rooms[matchID]
+	if !ok && create {
+		r = &Room{
+			matchID:  matchID,
+			mgr:      m,
+			clients:  make(map[*client]struct{}),
+			muted:    make(map[uint]time.Time),
+			lastSent: make(map[uint]time.Time),
+			buckets:  make(map[uint]*bucket),
+		}
+		m.rooms[matchID] = r
+	}
+	return r
+}
+
+// TokenProtocol is the WebSocket subprotocol a browser offers to pass its
+// access token, since it cannot set headers on a socket:
+// new WebSocket(url, ["bearer", token]).
+const TokenProtocol = "bearer"
+
+// Serve upgrades the request and joins the match's room until the socket
+// closes. The caller decides whether the match is live.
+func (m *Manager) Serve(w http.ResponseWriter, req *http.Request, matchID uint, u *User) {
+	upgrader := websocket.Upgrader{CheckOrigin: m.CheckOrigin, Subprotocols: []string{TokenProtocol}}
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return
+	}
+	c := newClient(conn, u, m.room(matchID, true))
+	go c.writePump()
+	if err := c.room.join(c); err != nil {
+		c.sendEvent(Event{Type: TypeClosed, Error: err.Error()})
+		c.close()
+		return
+	}
+	c.readPump()
+}
+
+// Snapshot returns the room's current state; ok is false when nobody has
+// joined it yet.
+func (m *Manager) Snapshot(matchID uint) (Snapshot, bool) {
+	r := m.room(matchID, false)
+	if r == nil {
+		return Snapshot{MatchID: matchID, Messages: []Message{}}, false
+	}
+	return r.snapshot(), true
+}
+
+// Close ends a match's chat: everyone is told and disconnected and the
+// backlog is dropped.
+func (m *Manager) Close(matchID uint) {
+	m.mu.Lock()
+	r, ok := m.rooms[matchID]
+	delete(m.rooms, matchID)
+	m.mu.Unlock()
+	if ok {
+		r.close()
+	}
+}
+
+// Delete removes a message from the room and from everyone's screen.
+func (m *Manager) Delete(mod *User, matchID uint, msgID uint64, reason string) error {
+	if mod == nil || !mod.Moderator {
+		return ErrNotModerator
+	}
+	r := m.room(matchID, false)
+	if r == nil {
+		return ErrMessageNotFound
+	}
+	author, err := r.delete(msgID)
+	if err != nil {
+		return err
+	}
+	m.audit(mod.ID, ActionDelete, matchID, reason, fmt.Sprintf("message %d by user %d", msgID, author))
+	return nil
+}
+
+// Mute stops userID sending in the room for d, at most a day. A zero d
+// lifts the mute.
+func (m *Manager) Mute(mod *User, matchID, userID uint, d time.Duration, reason string) error {
+	if mod == nil || !mod.Moderator {
+		return ErrNotModerator
+	}
+	if d < 0 || d > maxMute {
+		return ErrInvalidDuration
+	}
+	r := m.room(matchID, true)
+	until := r.mute(userID, d)
+	detail := fmt.Sprintf("user %d unmuted", userID)
+	if d > 0 {
+		detail = fmt.Sprintf("user %d until %s", userID, until.UTC().Format(time.RFC3339))
+	}
+	m.audit(mod.ID, ActionMute, matchID, reason, detail)
+	return nil
+}
+
+// SetSlowMode makes everyone except moderators wait d (at most ten
+// minutes) between messages. Zero turns slow mode off.
+func (m *Manager) SetSlowMode(mod *User, matchID uint, d time.Duration) error {
+	if mod == nil || !mod.Moderator {
+		return ErrNotModerator
+	}
+	if d < 0 || d > maxSlowMode {
+		return ErrInvalidDuration
+	}
+	m.room(matchID, true).setSlowMode(d)
+	m.audit(mod.ID, ActionSlowMode, matchID, "", d.String())
+	return nil
+}
+
+func (m *Manager) audit(modID uint, action string, matchID uint, reason, detail string) {
+	if m.Audit != nil {
+		m.Audit(modID, action, matchID, strings.TrimSpace(reason), detail)
+	}
+}
+
+// bucket is a per-user token bucket for the send rate limit.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) take(now time.Time, burst int, every time.Duration) bool {
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else if every > 0 {
+		b.tokens += float64(now.Sub(b.last)) / float64(every)
+		if b.tokens > float64(burst) {
+			b.tokens = float64(burst)
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,156 @@
+package chat
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait    = 10 * time.Second
+	pongWait     = 60 * time.Second
+	pingPeriod   = (pongWait * 9) / 10
+	maxFrameSize = 4096
+	sendBuffer   = 128
+)
+
+// request is what clients send:
+//
+//	{"action":"send","text":"..."}
+//	{"action":"delete","id":12,"reason":"..."}           moderators
+//	{"action":"mute","userId":3,"seconds":600,"reason":"..."} moderators
+//	{"action":"slow_mode","seconds":30}                 moderators
+type request struct {
+	Action  string `json:"action"`
+	Text    string `json:"text"`
+	ID      uint64 `json:"id"`
+	UserID  uint   `json:"userId"`
+	Seconds int    `json:"seconds"`
+	Reason  string `json:"reason"`
+}
+
+// client is one WebSocket connection. Like the hub's clients it has its own
+// send queue, and is dropped when the queue fills up. Its room is fixed
+// before either pump starts, so closing always leaves the room.
+type client struct {
+	conn *websocket.Conn
+	user *User
+	send chan []byte
+	room *Room
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newClient(conn *websocket.Conn, u *User, r *Room) *client {
+	return &client{conn: conn, user: u, room: r, send: make(chan []byte, sendBuffer)}
+}
+
+func (c *client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (c *client) sendEvent(e Event) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	c.enqueue(b)
+}
+
+func (c *client) enqueue(b []byte) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	select {
+	case c.send <- b:
+		c.mu.Unlock()
+	default:
+		c.mu.Unlock()
+		c.close()
+	}
+}
+
+func (c *client) close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	close(c.send)
+	c.mu.Unlock()
+	c.room.leave(c)
+}
+
+func (c *client) readPump() {
+	defer c.close()
+	c.conn.SetReadLimit(maxFrameSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, b, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req request
+		if err := json.Unmarshal(b, &req); err != nil {
+			c.sendEvent(Event{Type: TypeError, Error: "invalid message"})
+			continue
+		}
+		if err := c.handle(c.room, req); err != nil {
+			c.sendEvent(Event{Type: TypeError, Error: err.Error()})
+		}
+	}
+}
+
+func (c *client) handle(r *Room, req request) error {
+	m := r.mgr
+	switch req.Action {
+	case "send":
+		return r.send(c.user, req.Text)
+	case "delete":
+		return m.Delete(c.user, r.matchID, req.ID, req.Reason)
+	case "mute":
+		return m.Mute(c.user, r.matchID, req.UserID, time.Duration(req.Seconds)*time.Second, req.Reason)
+	case "slow_mode":
+		return m.SetSlowMode(c.user, r.matchID, time.Duration(req.Seconds)*time.Second)
+	}
+	return ErrUnknownAction
+}
+
+func (c *client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case b, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, b); err != nil {
+				c.close()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Room is one match's chat.
+type Room struct {
+	matchID uint
+	mgr     *Manager
+
+	mu       sync.Mutex
+	clients  map[*client]struct{}
+	backlog  []Message
+	nextID   uint64
+	slow     time.Duration
+	muted    map[uint]time.Time
+	lastSent map[uint]time.Time
+	buckets  map[uint]*bucket
+	closed   bool
+
+	viewersPending bool
+	viewersSent    time.Time
+}
+
+func (r *Room) join(c *client) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRoomClosed
+	}
+	// A client whose socket already failed has left; do not add it back.
+	if c.isClosed() {
+		r.mu.Unlock()
+		return nil
+	}
+	r.clients[c] = struct{}{}
+	snap := r.snapshotLocked()
+	r.mu.Unlock()
+
+	c.sendEvent(Event{Type: TypeWelcome, Data: snap})
+	r.viewersChanged()
+	return nil
+}
+
+func (r *Room) leave(c *client) {
+	r.mu.Lock()
+	_, ok := r.clients[c]
+	delete(r.clients, c)
+	r.mu.Unlock()
+	if ok {
+		r.viewersChanged()
+	}
+}
+
+func (r *Room) snapshot() Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.snapshotLocked()
+}
+
+func (r *Room) snapshotLocked() Snapshot {
+	msgs := make([]Message, len(r.backlog))
+	copy(msgs, r.backlog)
+	return Snapshot{
+		MatchID:  r.matchID,
+		Viewers:  len(r.clients),
+		SlowMode: int(r.slow / time.Second),
+		Messages: msgs,
+	}
+}
+
+// send validates and broadcasts a message from u.
+func (r *Room) send(u *User, text string) error {
+	if u == nil {
+		return ErrNotSignedIn
+	}
+	if u.Unverified {
+		return ErrNotVerified
+	}
+	if u.ReadOnly {
+		return ErrReadOnly
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ErrEmptyMessage
+	}
+	if len([]rune(text)) > maxTextLength {
+		return ErrMessageTooLong
+	}
+	now := time.Now()
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRoomClosed
+	}
+	if until, ok := r.muted[u.ID]; ok {
+		if now.Before(until) {
+			r.mu.Unlock()
+			return ErrMuted
+		}
+		delete(r.muted, u.ID)
+	}
+	if !u.Moderator {
+		if r.slow > 0 {
+			if wait := r.slow - now.Sub(r.lastSent[u.ID]); wait > 0 {
+				r.mu.Unlock()
+				return fmt.Errorf("slow mode is on: wait %ds", int(wait.Seconds()+0.999))
+			}
+		}
+		b, ok := r.buckets[u.ID]
+		if !ok {
+			b = &bucket{}
+			r.buckets[u.ID] = b
+		}
+		if !b.take(now, r.mgr.RateBurst, r.mgr.RateEvery) {
+			r.mu.Unlock()
+			return ErrRateLimited
+		}
+	}
+	r.lastSent[u.ID] = now
+	r.nextID++
+	msg := Message{ID: r.nextID, UserID: u.ID, Author: u.Name, Text: text, SentAt: now}
+	r.backlog = append(r.backlog, msg)
+	if limit := r.mgr.Backlog; limit > 0 && len(r.backlog) > limit {
+		r.backlog = append([]Message(nil), r.backlog[len(r.backlog)-limit:]...)
+	}
+	r.mu.Unlock()
+
+	r.broadcast(Event{Type: TypeMessage, Data: msg})
+	return nil
+}
+
+// delete drops a message from the backlog and tells everyone to hide it. It
+// returns the author's user ID, or 0 when the message had already scrolled
+// out of the backlog (it may still be on screens, so the broadcast goes out
+// anyway).
+func (r *Room) delete(id uint64) (uint, error) {
+	r.mu.Lock()
+	if id == 0 || id > r.nextID {
+		r.mu.Unlock()
+		return 0, ErrMessageNotFound
+	}
+	var author uint
+	for i, m := range r.backlog {
+		if m.ID == id {
+			author = m.UserID
+			r.backlog = append(r.backlog[:i], r.backlog[i+1:]...)
+			break
+		}
+	}
+	r.mu.Unlock()
+	r.broadcast(Event{Type: TypeDeleted, Data: map[string]uint64{"id": id}})
+	return author, nil
+}
+
+func (r *Room) mute(userID uint, d time.Duration) time.Time {
+	until := time.Now().Add(d)
+	r.mu.Lock()
+	if d > 0 {
+		r.muted[userID] = until
+	} else {
+		delete(r.muted, userID)
+	}
+	r.mu.Unlock()
+	data := map[string]interface{}{"userId": userID, "until": nil}
+	if d > 0 {
+		data["until"] = until
+	}
+	r.broadcast(Event{Type: TypeMuted, Data: data})
+	return until
+}
+
+func (r *Room) setSlowMode(d time.Duration) {
+	r.mu.Lock()
+	r.slow = d
+	r.mu.Unlock()
+	r.broadcast(Event{Type: TypeSlowMode, Data: map[string]int{"seconds": int(d / time.Second)}})
+}
+
+// viewersChanged broadcasts the viewer count, at most once per viewerEvery.
+func (r *Room) viewersChanged() {
+	r.mu.Lock()
+	if r.viewersPending || r.closed {
+		r.mu.Unlock()
+		return
+	}
+	wait := viewerEvery - time.Since(r.viewersSent)
+	if wait <= 0 {
+		r.viewersSent = time.Now()
+		n := len(r.clients)
+		r.mu.Unlock()
+		r.broadcast(Event{Type: TypeViewers, Data: map[string]int{"count": n}})
+		return
+	}
+	r.viewersPending = true
+	r.mu.Unlock()
+	time.AfterFunc(wait, func() {
+		r.mu.Lock()
+		r.viewersPending = false
+		r.mu.Unlock()
+		r.viewersChanged()
+	})
+}
+
+func (r *Room) broadcast(e Event) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	targets := make([]*client, 0, len(r.clients))
+	for c := range r.clients {
+		targets = append(targets, c)
+	}
+	r.mu.Unlock()
+	for _, c := range targets {
+		c.enqueue(b)
+	}
+}
+
+func (r *Room) close() {
+	r.broadcast(Event{Type: TypeClosed})
+	r.mu.Lock()
+	r.closed = true
+	targets := make([]*client, 0, len(r.clients))
+	for c := range r.clients {
+		targets = append(targets, c)
+	}
+	r.clients = make(map[*client]struct{})
+	r.backlog = nil
+	r.mu.Unlock()
+	for _, c := range targets {
+		c.close()
+	}
+}
@@ -1,27 +1,200 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/internal/jwtkeys"
+	"project/internal/mail"
+	"project/internal/oidc"
 )
 
+// DefaultJWTSecret is the built-in development secret. Validate refuses it
+// outside development.
+const DefaultJWTSecret = "dev-secret-change"
+
 type Config struct {
+	// Env is APP_ENV. It defaults to "production"; the development
+	// shortcuts Validate refuses elsewhere need APP_ENV=development.
+	Env        string
 	DBDriver   string
 	DSN        string
 	JWTSecret  string
 	AdminEmail string
+	// BaseURL is the public address used in links handed out to clients,
+	// such as calendar feeds and emailed links.
+	BaseURL string
+	// AdminPassword is the first admin's password when the database has no
+	// admin yet. Without it the admin is created without a password and a
+	// one-time link to choose one is logged at startup.
+	AdminPassword string
+	// JWT selects the access token keys: JWT_SIGNING_KEY is a PEM private
+	// key (RSA or Ed25519) and JWT_VERIFY_KEYS a comma-separated list of
+	// older keys still accepted. Without a signing key, tokens use HS256
+	// with JWTSecret.
+	JWT jwtkeys.Config
+	// PreMatchThreadOffset is how long before kick-off the pre-match thread
+	// opens; PostMatchThreadOffset how long after full time the post-match
+	// thread follows.
+	PreMatchThreadOffset  time.Duration
+	PostMatchThreadOffset time.Duration
+	ThreadSchedulerEvery  time.Duration
+	// ContentFilterFile is a JSON filter config, re-read whenever it changes;
+	// empty uses the built-in defaults.
+	ContentFilterFile   string
+	ContentFilterReload time.Duration
+	// AccessTokenTTL is the lifetime of a JWT; RefreshTokenTTL how long a
+	// session survives without being refreshed.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// Mail selects how email is sent: MAIL_DRIVER=smtp|file|log.
+	Mail             mail.Config
+	EmailVerifyTTL   time.Duration
+	PasswordResetTTL time.Duration
+	// RedisAddr enables Redis for shared caches and login counters; empty
+	// keeps everything in process memory.
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	// LoginLockoutThreshold failed logins lock an account for
+	// LoginLockoutDuration.
+	LoginLockoutThreshold int
+	LoginLockoutDuration  time.Duration
+	// TrustedProxies are the addresses (IPs or CIDRs) allowed to set
+	// X-Forwarded-For. Empty trusts nobody, so the client IP used for
+	// login throttling and sessions is the TCP peer.
+	TrustedProxies []string
+	// RequireAdmin2FA makes admins sign in with TOTP before the admin
+	// endpoints accept them. TOTPIssuer is the name shown in authenticator
+	// apps.
+	RequireAdmin2FA bool
+	TOTPIssuer      string
+	// OIDC lists the OpenID Connect providers named in OIDC_PROVIDERS, each
+	// configured by OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and
+	// optionally _DISPLAY_NAME and _SCOPES. OIDCMock adds the built-in mock
+	// provider (development only).
+	OIDC     []oidc.Config
+	OIDCMock bool
 }
 
 func Load() Config {
 	driver := getEnv("DB_DRIVER", "sqlite")
 	dsn := getEnv("DB_DSN", "file:epl.db?cache=shared&_journal_mode=WAL")
-	secret := getEnv("JWT_SECRET", "dev-secret-change")
+	secret := getEnv("JWT_SECRET", DefaultJWTSecret)
 	adminEmail := getEnv("ADMIN_EMAIL", "admin@epl.local")
-	return Config{
-		DBDriver:   driver,
-		DSN:        dsn,
-		JWTSecret:  secret,
-		AdminEmail: adminEmail,
+	cfg := Config{
+		Env:           getEnv("APP_ENV", "production"),
+		DBDriver:      driver,
+		DSN:           dsn,
+		JWTSecret:     secret,
+		AdminEmail:    adminEmail,
+		AdminPassword: os.Getenv("ADMIN_PASSWORD"),
+		JWT: jwtkeys.Config{
+			Secret:         secret,
+			SigningKeyFile: os.Getenv("JWT_SIGNING_KEY"),
+			VerifyKeyFiles: getList("JWT_VERIFY_KEYS"),
+		},
+		BaseURL:               getEnv("APP_BASE_URL", "http://localhost:8080"),
+		PreMatchThreadOffset:  getDuration("PRE_MATCH_THREAD_OFFSET", 24*time.Hour),
+		PostMatchThreadOffset: getDuration("POST_MATCH_THREAD_OFFSET", 0),
+		ThreadSchedulerEvery:  getDuration("THREAD_SCHEDULER_INTERVAL", time.Minute),
+		ContentFilterFile:     os.Getenv("CONTENT_FILTER_FILE"),
+		ContentFilterReload:   getDuration("CONTENT_FILTER_RELOAD", 30*time.Second),
+		AccessTokenTTL:        getDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:       getDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		Mail: mail.Config{
+			Driver:   getEnv("MAIL_DRIVER", "log"),
+			From:     getEnv("MAIL_FROM", "EPL Stats <no-reply@epl.local>"),
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     getInt("SMTP_PORT", 587),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			Dir:      getEnv("MAIL_DIR", "outbox"),
+		},
+		EmailVerifyTTL:   getDuration("EMAIL_VERIFY_TTL", 48*time.Hour),
+		PasswordResetTTL: getDuration("PASSWORD_RESET_TTL", time.Hour),
+		RedisAddr:        os.Getenv("REDIS_ADDR"),
+		RedisPassword:    os.Getenv("REDIS_PASSWORD"),
+		RedisDB:          getInt("REDIS_DB", 0),
+
+		LoginLockoutThreshold: getInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+		LoginLockoutDuration:  getDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		TrustedProxies:        getList("TRUSTED_PROXIES"),
+		RequireAdmin2FA:       getBool("REQUIRE_ADMIN_2FA", false),
+		TOTPIssuer:            getEnv("TOTP_ISSUER", "EPL Stats"),
+		OIDCMock:              getBool("OIDC_MOCK", false),
+	}
+	for _, name := range getList("OIDC_PROVIDERS") {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + envName(name) + "_"
+		cfg.OIDC = append(cfg.OIDC, oidc.Config{
+			Name:         name,
+			DisplayName:  getEnv(prefix+"DISPLAY_NAME", name),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  cfg.OIDCRedirectURL(name),
+			Scopes:       strings.Fields(strings.ReplaceAll(os.Getenv(prefix+"SCOPES"), ",", " ")),
+		})
+	}
+	return cfg
+}
+
+// OIDCRedirectURL is the callback URL to register with a provider.
+func (c Config) OIDCRedirectURL(provider string) string {
+	return strings.TrimRight(c.BaseURL, "/") + "/api/auth/oidc/" + provider + "/callback"
+}
+
+// SameOrigin reports whether a browser request was made by a page served
+// from BaseURL. Requests without an Origin header do not come from a
+// browser page and pass.
+func (c Config) SameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	o, err := url.Parse(origin)
+	if err != nil {
+		return false
 	}
+	base, err := url.Parse(c.BaseURL)
+	return err == nil && strings.EqualFold(o.Scheme, base.Scheme) && strings.EqualFold(o.Host, base.Host)
+}
+
+// DevMode reports whether the server runs as a development instance.
+func (c Config) DevMode() bool {
+	return c.Env == "development" || c.Env == "dev"
+}
+
+// Validate rejects settings that are only acceptable in development.
+func (c Config) Validate() error {
+	if !c.DevMode() && c.JWTSecret == DefaultJWTSecret {
+		return errors.New("JWT_SECRET is the built-in development secret; set a strong secret or APP_ENV=development")
+	}
+	if !c.DevMode() && (c.Mail.Driver == "" || c.Mail.Driver == "log") {
+		return errors.New("MAIL_DRIVER=log writes sign-in links to the server log; set smtp or file, or APP_ENV=development")
+	}
+	if c.AdminPassword != "" && len(c.AdminPassword) < 8 {
+		return errors.New("ADMIN_PASSWORD must be at least 8 characters")
+	}
+	if !c.DevMode() && c.OIDCMock {
+		return errors.New("OIDC_MOCK lets anyone sign in as anyone; it is only allowed with APP_ENV=development")
+	}
+	for _, p := range c.OIDC {
+		if p.Issuer == "" || p.ClientID == "" {
+			return fmt.Errorf("OIDC provider %q needs an issuer and a client ID", p.Name)
+		}
+		if p.Name == "mock" && c.OIDCMock {
+			return errors.New(`OIDC provider name "mock" is taken by OIDC_MOCK`)
+		}
+	}
+	return nil
 }
 
 func getEnv(key, def string) string {
@@ -30,3 +203,53 @@ func getEnv(key, def string) string {
 	}
 	return def
 }
+
+func getList(key string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// envName turns a provider name into its environment variable infix.
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func getInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+func getBool(key string, def bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
+func getDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
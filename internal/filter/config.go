@@ -0,0 +1,179 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Config is the JSON shape of the content filter file. Durations are Go
+// duration strings ("10m"). A section that is missing or has no action is
+// left out of the pipeline.
+//
+//	{
+//	  "wordLists": [{"action": "mask", "words": ["..."]}],
+//	  "links": {"max": 2, "action": "hold"},
+//	  "duplicates": {"window": "10m", "action": "reject"},
+//	  "rate": {"max": 5, "window": "1m", "action": "reject"}
+//	}
+type Config struct {
+	WordLists []struct {
+		Action string   `json:"action"`
+		Words  []string `json:"words"`
+	} `json:"wordLists"`
+	Links *struct {
+		Max    int    `json:"max"`
+		Action string `json:"action"`
+	} `json:"links"`
+	Duplicates *struct {
+		Window string `json:"window"`
+		Action string `json:"action"`
+	} `json:"duplicates"`
+	Rate *struct {
+		Max    int    `json:"max"`
+		Window string `json:"window"`
+		Action string `json:"action"`
+	} `json:"rate"`
+}
+
+// Default is used when no config file is set: no word list, hold posts with
+// more than two links, reject repeats within ten minutes and more than five
+// posts a minute.
+func Default() []Filter {
+	return []Filter{
+		&Links{Max: 2, Action: Hold},
+		&Duplicates{Window: 10 * time.Minute, Action: Reject},
+		&Rate{Max: 5, Window: time.Minute, Action: Reject},
+	}
+}
+
+// Load reads and validates a config file.
+func Load(path string) ([]Filter, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg.Build()
+}
+
+// Build turns a config into filters, in the order word lists, links,
+// duplicates, rate.
+func (cfg Config) Build() ([]Filter, error) {
+	var out []Filter
+	for i, wl := range cfg.WordLists {
+		a, err := action(wl.Action, fmt.Sprintf("wordLists[%d]", i), true)
+		if err != nil {
+			return nil, err
+		}
+		if a != Allow && len(wl.Words) > 0 {
+			out = append(out, NewWordList(a, wl.Words))
+		}
+	}
+	if l := cfg.Links; l != nil {
+		a, err := action(l.Action, "links", true)
+		if err != nil {
+			return nil, err
+		}
+		if l.Max < 0 {
+			return nil, fmt.Errorf("links: max must not be negative")
+		}
+		if a != Allow {
+			out = append(out, &Links{Max: l.Max, Action: a})
+		}
+	}
+	if d := cfg.Duplicates; d != nil {
+		a, err := action(d.Action, "duplicates", false)
+		if err != nil {
+			return nil, err
+		}
+		w, err := window(d.Window, "duplicates")
+		if err != nil {
+			return nil, err
+		}
+		if a != Allow {
+			out = append(out, &Duplicates{Window: w, Action: a})
+		}
+	}
+	if r := cfg.Rate; r != nil {
+		a, err := action(r.Action, "rate", false)
+		if err != nil {
+			return nil, err
+		}
+		w, err := window(r.Window, "rate")
+		if err != nil {
+			return nil, err
+		}
+		if r.Max < 1 {
+			return nil, fmt.Errorf("rate: max must be at least 1")
+		}
+		if a != Allow {
+			out = append(out, &Rate{Max: r.Max, Window: w, Action: a})
+		}
+	}
+	return out, nil
+}
+
+// action parses a config action. Masking only makes sense for filters that
+// can point at the offending text.
+func action(s, section string, maskable bool) (Action, error) {
+	a, ok := ParseAction(s)
+	if !ok {
+		return Allow, fmt.Errorf("%s: unknown action %q", section, s)
+	}
+	if a == Mask && !maskable {
+		return Allow, fmt.Errorf("%s: action must be reject or hold", section)
+	}
+	return a, nil
+}
+
+func window(s, section string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s: invalid window %q", section, s)
+	}
+	if d > historyWindow {
+		return 0, fmt.Errorf("%s: window must be at most %s", section, historyWindow)
+	}
+	return d, nil
+}
+
+// Watch reloads the pipeline from path whenever the file's modification
+// time changes, checking every interval until ctx is cancelled. A file that
+// fails to load is logged and the previous filters stay in place.
+func Watch(ctx context.Context, p *Pipeline, path string, interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	var last time.Time
+	if st, err := os.Stat(path); err == nil {
+		last = st.ModTime()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		st, err := os.Stat(path)
+		if err != nil || st.ModTime().Equal(last) {
+			continue
+		}
+		last = st.ModTime()
+		filters, err := Load(path)
+		if err != nil {
+			log.Printf("content filter: keeping previous config: %v", err)
+			continue
+		}
+		p.Replace(filters)
+		log.Printf("content filter: reloaded %s (%d filters)", path, len(filters))
+	}
+}
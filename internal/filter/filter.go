@@ -0,0 +1,182 @@
+// Package filter screens user-generated text before it is stored. A
+// Pipeline runs a list of Filters over each post; every filter can allow it,
+// mask part of the text, hold the post for moderation or reject it outright.
+package filter
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Action is a filter's verdict. Higher values win when several filters fire.
+type Action int
+
+const (
+	Allow Action = iota
+	Mask
+	Hold
+	Reject
+)
+
+func (a Action) String() string {
+	switch a {
+	case Mask:
+		return "mask"
+	case Hold:
+		return "hold"
+	case Reject:
+		return "reject"
+	}
+	return "allow"
+}
+
+// ParseAction reads an action name from config.
+func ParseAction(s string) (Action, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "allow", "":
+		return Allow, true
+	case "mask":
+		return Mask, true
+	case "hold":
+		return Hold, true
+	case "reject":
+		return Reject, true
+	}
+	return Allow, false
+}
+
+// Post is an earlier post by the same user, as remembered by the pipeline.
+type Post struct {
+	At   time.Time
+	Text string // as the filters saw it after masking, normalised with Fold
+}
+
+// Input is what a filter sees.
+type Input struct {
+	UserID uint
+	Text   string
+	Now    time.Time
+	// Recent holds the user's accepted posts from the last historyWindow,
+	// oldest first.
+	Recent []Post
+}
+
+// Result is a filter's verdict. Text is only read when Action is Mask.
+type Result struct {
+	Action Action
+	Filter string
+	Reason string
+	Text   string
+}
+
+// Filter inspects one post.
+type Filter interface {
+	Name() string
+	Check(in Input) Result
+}
+
+// historyWindow bounds how long the pipeline remembers posts for the
+// duplicate and rate filters.
+const historyWindow = time.Hour
+
+// Pipeline runs filters in order. Masks are applied cumulatively, so later
+// filters see the masked text; the first Reject stops the run. The outcome
+// is the strongest action any filter returned. Pipeline keeps per-user post
+// history in memory, which survives Replace but not a restart.
+type Pipeline struct {
+	mu      sync.RWMutex
+	filters []Filter
+
+	histMu  sync.Mutex
+	history map[uint][]Post
+	writes  int
+}
+
+func NewPipeline(filters ...Filter) *Pipeline {
+	return &Pipeline{filters: filters, history: make(map[uint][]Post)}
+}
+
+// Replace swaps the filter list, e.g. after the config file changes.
+func (p *Pipeline) Replace(filters []Filter) {
+	p.mu.Lock()
+	p.filters = filters
+	p.mu.Unlock()
+}
+
+// Check runs the pipeline for a post by userID. Posts that are not rejected
+// are recorded for later duplicate and rate checks.
+func (p *Pipeline) Check(userID uint, text string) Result {
+	now := time.Now()
+	in := Input{UserID: userID, Text: text, Now: now, Recent: p.recent(userID, now)}
+
+	p.mu.RLock()
+	filters := p.filters
+	p.mu.RUnlock()
+
+	out := Result{Action: Allow, Text: text}
+	for _, f := range filters {
+		r := f.Check(in)
+		if r.Action == Allow {
+			continue
+		}
+		if r.Filter == "" {
+			r.Filter = f.Name()
+		}
+		if r.Action == Mask {
+			in.Text = r.Text
+			out.Text = r.Text
+		}
+		if r.Action > out.Action {
+			out.Action, out.Filter, out.Reason = r.Action, r.Filter, r.Reason
+		}
+		if r.Action == Reject {
+			break
+		}
+	}
+	if out.Action != Reject {
+		// Filters after a mask compare against the masked text, so
+		// remember that; the original would never match a repeat.
+		p.record(userID, Post{At: now, Text: Fold(out.Text)})
+	}
+	return out
+}
+
+func (p *Pipeline) recent(userID uint, now time.Time) []Post {
+	p.histMu.Lock()
+	defer p.histMu.Unlock()
+	posts := p.history[userID]
+	cut := 0
+	for cut < len(posts) && now.Sub(posts[cut].At) > historyWindow {
+		cut++
+	}
+	posts = posts[cut:]
+	if len(posts) == 0 {
+		delete(p.history, userID)
+		return nil
+	}
+	p.history[userID] = posts
+	return append([]Post(nil), posts...)
+}
+
+// record stores a post, sweeping expired history every so often so users
+// who stop posting do not stay in memory.
+func (p *Pipeline) record(userID uint, post Post) {
+	p.histMu.Lock()
+	defer p.histMu.Unlock()
+	p.history[userID] = append(p.history[userID], post)
+	p.writes++
+	if p.writes%256 != 0 {
+		return
+	}
+	for id, posts := range p.history {
+		if post.At.Sub(posts[len(posts)-1].At) > historyWindow {
+			delete(p.history, id)
+		}
+	}
+}
+
+// Fold lowercases text and collapses whitespace, for comparing messages.
+func Fold(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
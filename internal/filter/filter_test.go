@@ -0,0 +1,203 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeWord(t *testing.T) {
+	cases := map[string]string{
+		"$h1t":      "shit",
+		"s.h.i.t":   "shit",
+		"sh!t":      "shit",
+		"SHIT!":     "shit",
+		"(sh1t),":   "shit",
+		"hi!":       "hi",
+		"b@st4rd":   "bastard",
+		"...":       "",
+		"\"quote\"": "quote",
+	}
+	for in, want := range cases {
+		if got := normalizeWord(in); got != want {
+			t.Errorf("normalizeWord(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWordListMatch(t *testing.T) {
+	w := NewWordList(Reject, []string{"ass", "shit"})
+	cases := map[string]bool{
+		"ass":      true,
+		"A$$":      true,
+		"asssss":   true,
+		"shiiiit!": true,
+		"5h1t":     true,
+		"as":       false,
+		"pass":     false,
+		"assist":   false,
+		"hi!":      false,
+	}
+	for tok, want := range cases {
+		if got := w.match(tok); got != want {
+			t.Errorf("match(%q) = %v, want %v", tok, got, want)
+		}
+	}
+}
+
+func TestWordListActions(t *testing.T) {
+	in := Input{Text: "what a sh1t pass, ass"}
+	for _, a := range []Action{Reject, Hold} {
+		r := NewWordList(a, []string{"shit"}).Check(in)
+		if r.Action != a || r.Reason == "" {
+			t.Errorf("%s: result = %+v", a, r)
+		}
+	}
+	r := NewWordList(Mask, []string{"shit", "ass"}).Check(in)
+	if r.Action != Mask || r.Text != "what a **** pass, ***" {
+		t.Errorf("mask: result = %+v", r)
+	}
+	if r := NewWordList(Reject, []string{"shit"}).Check(Input{Text: "clean"}); r.Action != Allow {
+		t.Errorf("clean text: result = %+v", r)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	in := Input{Text: "see https://a.example and www.b.example or http://c.example"}
+	if r := (&Links{Max: 3, Action: Hold}).Check(in); r.Action != Allow {
+		t.Errorf("within limit: %+v", r)
+	}
+	r := (&Links{Max: 1, Action: Mask}).Check(in)
+	if r.Action != Mask || r.Text != "see https://a.example and [link removed] or [link removed]" {
+		t.Errorf("mask: %+v", r)
+	}
+}
+
+func TestDuplicatesAndRate(t *testing.T) {
+	now := time.Now()
+	recent := []Post{
+		{At: now.Add(-20 * time.Minute), Text: "old news"},
+		{At: now.Add(-30 * time.Second), Text: "come on you reds"},
+		{At: now.Add(-10 * time.Second), Text: "what a goal"},
+	}
+	d := &Duplicates{Window: 10 * time.Minute, Action: Reject}
+	if r := d.Check(Input{Text: "  What A  GOAL ", Now: now, Recent: recent}); r.Action != Reject {
+		t.Errorf("repeat within window: %+v", r)
+	}
+	if r := d.Check(Input{Text: "old news", Now: now, Recent: recent}); r.Action != Allow {
+		t.Errorf("repeat outside window: %+v", r)
+	}
+
+	rate := &Rate{Max: 2, Window: time.Minute, Action: Hold}
+	if r := rate.Check(Input{Now: now, Recent: recent}); r.Action != Hold {
+		t.Errorf("third post in a minute: %+v", r)
+	}
+	if r := rate.Check(Input{Now: now, Recent: recent[:2]}); r.Action != Allow {
+		t.Errorf("second post in a minute: %+v", r)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	p := NewPipeline(
+		NewWordList(Mask, []string{"shit"}),
+		&Links{Max: 0, Action: Hold},
+		&Duplicates{Window: time.Minute, Action: Reject},
+	)
+	// The strongest action wins; only masks change the text.
+	r := p.Check(1, "shit ref www.ref.example")
+	if r.Action != Hold || r.Filter != NameLinks || r.Text != "**** ref www.ref.example" {
+		t.Fatalf("mask then hold: %+v", r)
+	}
+	// Held posts count as history; the repeat is rejected.
+	if r := p.Check(1, "shit ref www.ref.example"); r.Action != Reject || r.Filter != NameDuplicates {
+		t.Fatalf("duplicate: %+v", r)
+	}
+	if r := p.Check(2, "shit ref www.ref.example"); r.Action != Hold {
+		t.Fatalf("another user's post: %+v", r)
+	}
+	p.Replace(nil)
+	if r := p.Check(1, "anything at all"); r.Action != Allow || r.Text != "anything at all" {
+		t.Fatalf("empty pipeline: %+v", r)
+	}
+}
+
+func TestBuildValidates(t *testing.T) {
+	cases := map[string]string{
+		`{"wordLists":[{"action":"ban","words":["x"]}]}`:     "wordLists[0]: unknown action",
+		`{"links":{"max":-1,"action":"hold"}}`:               "links: max must not be negative",
+		`{"duplicates":{"window":"10m","action":"mask"}}`:    "duplicates: action must be reject or hold",
+		`{"duplicates":{"window":"soon","action":"reject"}}`: "duplicates: invalid window",
+		`{"rate":{"max":5,"window":"2h","action":"reject"}}`: "rate: window must be at most",
+		`{"rate":{"max":0,"window":"1m","action":"reject"}}`: "rate: max must be at least 1",
+		`{"rate":{"max":5,"window":"-1m","action":"hold"}}`:  "rate: invalid window",
+	}
+	for doc, want := range cases {
+		var cfg Config
+		if err := json.Unmarshal([]byte(doc), &cfg); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cfg.Build(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", doc, err, want)
+		}
+	}
+
+	var cfg Config
+	json.Unmarshal([]byte(`{
+		"wordLists": [{"action": "mask", "words": ["x"]}, {"action": "allow", "words": ["y"]}, {"action": "hold"}],
+		"links": {"max": 2, "action": "hold"},
+		"duplicates": {"window": "10m", "action": ""},
+		"rate": {"max": 5, "window": "1m", "action": "reject"}
+	}`), &cfg)
+	filters, err := cfg.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range filters {
+		names = append(names, f.Name())
+	}
+	if got := strings.Join(names, ","); got != "words,links,rate" {
+		t.Fatalf("filters = %s, want words,links,rate", got)
+	}
+}
+
+func TestWatchReloadsAndKeepsLastGoodConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.json")
+	write := func(doc string, mod time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mod, mod)
+	}
+	base := time.Now().Add(-time.Hour)
+	write(`{}`, base)
+	p := NewPipeline()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watch(ctx, p, path, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond) // let Watch record the current mtime
+
+	waitFor := func(what string, ok func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !ok() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	write(`{"wordLists":[{"action":"reject","words":["offside"]}]}`, base.Add(time.Minute))
+	waitFor("reload", func() bool { return p.Check(1, "offside!").Action == Reject })
+
+	write(`{"rate":{"max":0,"window":"1m","action":"reject"}}`, base.Add(2*time.Minute))
+	time.Sleep(50 * time.Millisecond)
+	if r := p.Check(2, "offside"); r.Action != Reject {
+		t.Fatalf("invalid config replaced the filters: %+v", r)
+	}
+}
@@ -0,0 +1,173 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Filter names, reported in Result.Filter.
+const (
+	NameWords      = "words"
+	NameLinks      = "links"
+	NameDuplicates = "duplicates"
+	NameRate       = "rate"
+)
+
+// leet maps the usual character substitutions back to letters.
+var leet = map[rune]rune{
+	'0': 'o', '1': 'i', '!': 'i', '|': 'i', '3': 'e', '4': 'a', '@': 'a',
+	'5': 's', '$': 's', '7': 't', '+': 't', '8': 'b', '9': 'g',
+}
+
+// normalizeWord undoes leet-speak and drops punctuation, so "$h1t" and
+// "s.h.i.t" both become "shit". Sentence punctuation around the word is
+// trimmed first so a trailing "!" is not read as an "i".
+func normalizeWord(w string) string {
+	w = strings.TrimLeft(w, `("'`)
+	w = strings.TrimRight(w, `.,!?;:)"'`)
+	var b strings.Builder
+	for _, r := range strings.ToLower(w) {
+		if m, ok := leet[r]; ok {
+			r = m
+		}
+		if unicode.IsLetter(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// collapse squeezes runs of the same letter, for catching "shiiiit".
+func collapse(w string) string {
+	var b strings.Builder
+	var last rune
+	for _, r := range w {
+		if r != last {
+			b.WriteRune(r)
+		}
+		last = r
+	}
+	return b.String()
+}
+
+var tokenRe = regexp.MustCompile(`\S+`)
+
+// WordList matches whole words after normalisation. Stretched words are
+// compared with repeated letters squeezed out, but only when the post
+// actually repeats a letter, so listing "ass" does not catch "as". On Mask
+// the offending words are replaced by asterisks of the same length.
+type WordList struct {
+	Action    Action
+	words     map[string]bool
+	collapsed map[string]bool
+}
+
+func NewWordList(action Action, words []string) *WordList {
+	w := &WordList{Action: action, words: make(map[string]bool), collapsed: make(map[string]bool)}
+	for _, word := range words {
+		if n := normalizeWord(word); n != "" {
+			w.words[n] = true
+			w.collapsed[collapse(n)] = true
+		}
+	}
+	return w
+}
+
+func (w *WordList) match(tok string) bool {
+	n := normalizeWord(tok)
+	if n == "" {
+		return false
+	}
+	if w.words[n] {
+		return true
+	}
+	c := collapse(n)
+	return c != n && w.collapsed[c]
+}
+
+func (w *WordList) Name() string { return NameWords }
+
+func (w *WordList) Check(in Input) Result {
+	hits := 0
+	masked := tokenRe.ReplaceAllStringFunc(in.Text, func(tok string) string {
+		if !w.match(tok) {
+			return tok
+		}
+		hits++
+		return strings.Repeat("*", len([]rune(tok)))
+	})
+	if hits == 0 {
+		return Result{Action: Allow}
+	}
+	return Result{Action: w.Action, Reason: "contains blocked words", Text: masked}
+}
+
+var linkRe = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// Links limits how many URLs a post may contain. On Mask the links beyond
+// the limit are replaced.
+type Links struct {
+	Max    int
+	Action Action
+}
+
+func (l *Links) Name() string { return NameLinks }
+
+func (l *Links) Check(in Input) Result {
+	found := linkRe.FindAllStringIndex(in.Text, -1)
+	if len(found) <= l.Max {
+		return Result{Action: Allow}
+	}
+	n := 0
+	masked := linkRe.ReplaceAllStringFunc(in.Text, func(link string) string {
+		n++
+		if n <= l.Max {
+			return link
+		}
+		return "[link removed]"
+	})
+	return Result{Action: l.Action, Reason: fmt.Sprintf("more than %d links", l.Max), Text: masked}
+}
+
+// Duplicates catches a user posting the same message again within Window.
+type Duplicates struct {
+	Window time.Duration
+	Action Action
+}
+
+func (d *Duplicates) Name() string { return NameDuplicates }
+
+func (d *Duplicates) Check(in Input) Result {
+	text := Fold(in.Text)
+	for _, p := range in.Recent {
+		if in.Now.Sub(p.At) <= d.Window && p.Text == text {
+			return Result{Action: d.Action, Reason: "duplicate message"}
+		}
+	}
+	return Result{Action: Allow}
+}
+
+// Rate allows at most Max posts per user in any Window.
+type Rate struct {
+	Max    int
+	Window time.Duration
+	Action Action
+}
+
+func (r *Rate) Name() string { return NameRate }
+
+func (r *Rate) Check(in Input) Result {
+	n := 0
+	for _, p := range in.Recent {
+		if in.Now.Sub(p.At) <= r.Window {
+			n++
+		}
+	}
+	if n < r.Max {
+		return Result{Action: Allow}
+	}
+	return Result{Action: r.Action, Reason: fmt.Sprintf("more than %d posts in %s", r.Max, r.Window)}
+}
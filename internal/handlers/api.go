@@ -1,52 +1,142 @@
 package handlers
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"project/internal/calendar"
+	"project/internal/chat"
+	"project/internal/hub"
+	"project/internal/jwtkeys"
 	"project/internal/middleware"
 	"project/internal/models"
+	"project/internal/rbac"
 	"project/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type API struct {
-	Auth      *services.AuthService
-	Teams     *services.TeamService
-	Players   *services.PlayerService
-	Matches   *services.MatchService
-	Table     *services.TableService
-	JWTSecret string
+	Auth        *services.AuthService
+	Teams       *services.TeamService
+	Players     *services.PlayerService
+	Matches     *services.MatchService
+	Table       *services.TableService
+	Calendar    *services.CalendarService
+	MatchEvents *services.MatchEventService
+	Threads     *services.ThreadService
+	Moderation  *services.ModerationService
+	Events      *services.EventBus
+	Hub         *hub.Hub
+	Chat        *chat.Manager
+	Keys        *jwtkeys.Set
+	// BaseURL is the site's public address; links that carry secrets are
+	// built from it rather than from request headers.
+	BaseURL string
 }
 
 func (a *API) RegisterRoutes(r *gin.Engine) {
+	r.GET("/cal/:file", a.calendarFeed)
+	r.GET("/ws/chat/:id", a.chatSocket)
+	r.GET("/.well-known/jwks.json", a.jwks)
+
 	api := r.Group("/api")
 	api.GET("/table", a.getTable)
 	api.GET("/teams", a.getTeams)
 	api.GET("/players", a.getPlayers)
 	api.GET("/matches", a.getMatches)
-	api.GET("/matchtracker", LiveMatchTrackerHandler)
-	api.GET("/threads", ListMatchThreads)
-	api.POST("/threads/comment", PostComment)
+	api.GET("/calendar/:teamId", a.teamCalendar)
+	api.GET("/matches/:id/events", a.getMatchEvents)
+	api.GET("/matches/:id/stream", a.matchStream)
+	api.GET("/matches/:id/chat", a.chatSnapshot)
+	api.GET("/matchtracker", a.matchTracker)
+	api.GET("/threads", a.listThreads)
+	api.GET("/threads/:id", a.getThread)
+	api.GET("/threads/:id/comments", a.listComments)
 	api.GET("/stats", StatsHandler)
 	api.GET("/historical", HistoricalDataHandler)
 
 	api.POST("/auth/register", a.register)
 	api.POST("/auth/login", a.login)
+	api.POST("/auth/login/2fa", a.loginTwoFactor)
+	api.POST("/auth/refresh", a.refresh)
 	api.POST("/auth/logout", a.logout)
+	api.POST("/auth/forgot-password", a.forgotPassword)
+	api.POST("/auth/reset-password", a.resetPassword)
+	api.POST("/auth/verify-email", a.verifyEmail)
+	api.POST("/auth/accept-invite", a.acceptInvite)
+	api.GET("/auth/oidc/providers", a.oidcProviders)
+	api.GET("/auth/oidc/:provider/login", a.oidcLogin)
+	api.GET("/auth/oidc/:provider/callback", a.oidcCallback)
 
 	auth := api.Group("/")
-	auth.Use(middleware.Auth(a.JWTSecret))
+	auth.Use(middleware.Auth(a.Keys, a.Auth.SessionActive))
+	auth.POST("/auth/logout-all", a.logoutAll)
+	auth.POST("/auth/resend-verification", a.resendVerification)
 	auth.POST("/profile/favorite", a.setFavoriteTeam)
 	auth.GET("/profile/me", a.me)
+	auth.GET("/profile/calendar", a.getCalendarFeed)
+	auth.PUT("/profile/calendar", a.updateCalendarFeed)
+	auth.POST("/profile/calendar/rotate", a.rotateCalendarFeed)
+	auth.DELETE("/profile/calendar", a.revokeCalendarFeed)
+	auth.GET("/profile/sessions", a.listSessions)
+	auth.DELETE("/profile/sessions/:id", a.revokeSession)
+	auth.GET("/profile/2fa", a.twoFactorStatus)
+	auth.POST("/profile/2fa/setup", a.setupTwoFactor)
+	auth.POST("/profile/2fa/enable", a.enableTwoFactor)
+	auth.POST("/profile/2fa/disable", a.disableTwoFactor)
+	auth.POST("/profile/2fa/recovery-codes", a.regenerateRecoveryCodes)
 	auth.GET("/feed", PersonalizedFeedHandler)
+	auth.POST("/threads/comment", a.postComment)
+	auth.POST("/comments/:id/vote", a.voteComment)
+	auth.POST("/comments/:id/report", a.reportComment)
+
+	// Staff routes ask for a permission, not a role; see internal/rbac for
+	// which roles grant what.
+	comments := middleware.RequirePermission(rbac.CommentModerate)
+	bans := middleware.RequirePermission(rbac.UserBan)
+	chatMod := middleware.RequirePermission(rbac.ChatModerate)
+	mod := auth.Group("/mod")
+	mod.Use(middleware.RequireAdminTwoFactor(a.Auth.RequireAdmin2FA))
+	mod.GET("/queue", comments, a.moderationQueue)
+	mod.POST("/comments/:id/remove", comments, a.commentAction(a.Moderation.RemoveComment))
+	mod.POST("/comments/:id/approve", comments, a.commentAction(a.Moderation.ApproveComment))
+	mod.POST("/comments/:id/restore", comments, a.commentAction(a.Moderation.RestoreComment))
+	mod.POST("/comments/:id/dismiss", comments, a.commentAction(a.Moderation.DismissReports))
+	mod.GET("/users/:id/bans", bans, a.userBans)
+	mod.POST("/users/:id/ban", bans, a.banUser)
+	mod.DELETE("/users/:id/ban", bans, a.unbanUser)
+	mod.GET("/log", comments, a.moderationLog)
+	mod.DELETE("/chat/:id/messages/:msgId", chatMod, a.deleteChatMessage)
+	mod.POST("/chat/:id/mute", chatMod, a.muteChatUser)
+	mod.PUT("/chat/:id/slow-mode", chatMod, a.setChatSlowMode)
 
 	admin := auth.Group("/admin")
-	admin.Use(middleware.RequireAdmin())
-	admin.POST("/teams", a.upsertTeam)
-	admin.POST("/players", a.upsertPlayer)
-	admin.POST("/matches/:id/result", a.updateMatchResult)
+	admin.Use(middleware.RequireAdminTwoFactor(a.Auth.RequireAdmin2FA))
+	admin.POST("/teams", middleware.RequirePermission(rbac.TeamWrite), a.upsertTeam)
+	admin.POST("/players", middleware.RequirePermission(rbac.PlayerWrite, rbac.PlayerWriteOwn), a.upsertPlayer)
+	admin.POST("/matches/:id/result", middleware.RequirePermission(rbac.MatchResultWrite), a.updateMatchResult)
+	admin.POST("/matches/:id/events", middleware.RequirePermission(rbac.MatchEventWrite), a.addMatchEvent)
+	admin.POST("/threads", middleware.RequirePermission(rbac.ThreadWrite), a.createThread)
+	admin.GET("/roles", middleware.RequirePermission(rbac.UserRoleWrite), a.listRoles)
+	admin.PUT("/users/:id/role", middleware.RequirePermission(rbac.UserRoleWrite), a.setUserRole)
+
+	users := middleware.RequirePermission(rbac.UserManage)
+	admin.GET("/users", users, a.listUsers)
+	admin.POST("/users/:id/suspend", users, a.userAction(a.Auth.SuspendUser))
+	admin.DELETE("/users/:id/suspend", users, a.userAction(a.Auth.UnsuspendUser))
+	admin.POST("/users/:id/password-reset", users, a.userAction(a.Auth.ForcePasswordReset))
+	admin.DELETE("/users/:id", users, a.userAction(a.Auth.DeleteUser))
+	admin.POST("/invites", users, a.inviteUser)
 }
 
 func (a *API) register(c *gin.Context) {
@@ -81,22 +171,177 @@ func (a *API) login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
 		return
 	}
-	token, u, err := a.Auth.Login(body.Email, body.Password)
+	pair, u, err := a.Auth.Login(body.Email, body.Password, clientInfo(c))
+	var challenge *services.TwoFactorRequiredError
+	if errors.As(err, &challenge) {
+		c.JSON(http.StatusOK, gin.H{"twoFactorRequired": true, "challenge": challenge.Challenge, "expiresIn": challenge.ExpiresIn})
+		return
+	}
 	if err != nil {
+		loginError(c, err)
+		return
+	}
+	a.setAuthCookies(c, pair)
+	c.JSON(http.StatusOK, gin.H{"token": pair.AccessToken, "refreshToken": pair.RefreshToken, "expiresIn": pair.ExpiresIn, "user": u})
+}
+
+// loginTwoFactor is the second step of a login for accounts with 2FA. Body:
+// {"challenge":"...","code":"123456"}; a recovery code works in place of
+// the 6-digit code.
+func (a *API) loginTwoFactor(c *gin.Context) {
+	var body struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Challenge == "" || body.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "challenge and code are required"})
+		return
+	}
+	pair, u, err := a.Auth.CompleteTwoFactorLogin(body.Challenge, body.Code, clientInfo(c))
+	if err != nil {
+		loginError(c, err)
+		return
+	}
+	a.setAuthCookies(c, pair)
+	c.JSON(http.StatusOK, gin.H{"token": pair.AccessToken, "refreshToken": pair.RefreshToken, "expiresIn": pair.ExpiresIn, "user": u})
+}
+
+func loginError(c *gin.Context, err error) {
+	var throttled *services.LoginThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		secs := int(throttled.RetryAfter.Seconds() + 0.999)
+		c.Header("Retry-After", strconv.Itoa(secs))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "retryAfter": secs, "locked": throttled.Locked})
+	case errors.Is(err, services.ErrInvalidCredentials), errors.Is(err, services.ErrInvalidCode), errors.Is(err, services.ErrInvalidChallenge):
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAccountSuspended):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// refresh swaps a refresh token, from the body or the refresh cookie, for a
+// new access/refresh pair. The old refresh token stops working. Using the
+// cookie requires the CSRF header.
+func (a *API) refresh(c *gin.Context) {
+	raw, fromCookie := refreshToken(c)
+	if fromCookie && !middleware.CheckCSRF(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": middleware.ErrCSRF.Error()})
+		return
+	}
+	pair, u, err := a.Auth.Refresh(raw, clientInfo(c))
+	if err != nil {
+		a.clearAuthCookies(c)
+		if errors.Is(err, services.ErrInvalidRefresh) || errors.Is(err, services.ErrRefreshReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	// Set token in HTTP-only cookie for better security
-	c.SetCookie("auth_token", token, 86400, "/", "", false, true) // 24 hours, httpOnly
-	c.JSON(http.StatusOK, gin.H{"token": token, "user": u})
+	a.setAuthCookies(c, pair)
+	c.JSON(http.StatusOK, gin.H{"token": pair.AccessToken, "refreshToken": pair.RefreshToken, "expiresIn": pair.ExpiresIn, "user": u})
 }
 
+// logout ends the current session, found from the refresh token or the
+// access token, and clears the auth cookies. A cookie-only request needs
+// the CSRF header, so other sites cannot sign users out.
 func (a *API) logout(c *gin.Context) {
-	// Clear auth cookie
-	c.SetCookie("auth_token", "", -1, "/", "", false, true)
+	if raw, fromCookie := refreshToken(c); raw != "" {
+		if fromCookie && !middleware.CheckCSRF(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": middleware.ErrCSRF.Error()})
+			return
+		}
+		a.Auth.LogoutRefresh(raw)
+	} else if access, fromCookie := middleware.TokenFromRequest(c); access != "" {
+		if fromCookie && !middleware.CheckCSRF(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": middleware.ErrCSRF.Error()})
+			return
+		}
+		if claims, err := middleware.ParseToken(a.Keys, access); err == nil && claims.SessionID != 0 {
+			a.Auth.Logout(claims.SessionID)
+		}
+	}
+	a.clearAuthCookies(c)
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
+// logoutAll revokes every session of the caller, this one included.
+func (a *API) logoutAll(c *gin.Context) {
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	n, err := a.Auth.LogoutAll(uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	a.clearAuthCookies(c)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "revoked": n})
+}
+
+func clientInfo(c *gin.Context) services.ClientInfo {
+	return services.ClientInfo{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
+
+// refreshToken returns the refresh token from the body or, failing that,
+// the refresh cookie, and whether it came from the cookie.
+func refreshToken(c *gin.Context) (raw string, fromCookie bool) {
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if c.Request.ContentLength != 0 {
+		c.ShouldBindJSON(&body)
+	}
+	if body.RefreshToken != "" {
+		return body.RefreshToken, false
+	}
+	raw, _ = c.Cookie(middleware.RefreshCookie)
+	return raw, raw != ""
+}
+
+// setAuthCookies stores both tokens as httpOnly cookies. The refresh cookie
+// is scoped to /api/auth so it is only sent to refresh and logout. A fresh
+// CSRF token goes alongside in a cookie scripts can read; without one,
+// cookie-authenticated writes fail the CSRF check rather than pass it.
+func (a *API) setAuthCookies(c *gin.Context, pair *services.TokenPair) {
+	refreshAge := int(time.Until(pair.RefreshUntil) / time.Second)
+	secure := a.secureCookies(c)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(middleware.AccessCookie, pair.AccessToken, pair.ExpiresIn, "/", "", secure, true)
+	c.SetCookie(middleware.RefreshCookie, pair.RefreshToken, refreshAge, "/api/auth", "", secure, true)
+	token, err := newCSRFToken()
+	if err != nil {
+		log.Printf("csrf token: %v", err)
+		return
+	}
+	c.SetCookie(middleware.CSRFCookie, token, refreshAge, "/", "", secure, false)
+}
+
+func (a *API) clearAuthCookies(c *gin.Context) {
+	secure := a.secureCookies(c)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(middleware.AccessCookie, "", -1, "/", "", secure, true)
+	c.SetCookie(middleware.RefreshCookie, "", -1, "/api/auth", "", secure, true)
+	c.SetCookie(middleware.CSRFCookie, "", -1, "/", "", secure, false)
+}
+
+// secureCookies reports whether cookies must only travel over HTTPS: the
+// request arrived over TLS, or the site is served from an https base URL
+// behind a TLS-terminating proxy.
+func (a *API) secureCookies(c *gin.Context) bool {
+	return c.Request.TLS != nil || strings.HasPrefix(strings.ToLower(a.BaseURL), "https://")
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func (a *API) getTeams(c *gin.Context) {
 	list, err := a.Teams.List()
 	if err != nil {
@@ -135,13 +380,26 @@ func (a *API) getPlayers(c *gin.Context) {
 	c.JSON(http.StatusOK, list)
 }
 
+// upsertPlayer saves a player. Club officials may only touch players of
+// the team they represent.
 func (a *API) upsertPlayer(c *gin.Context) {
 	var p models.Player
 	if err := c.ShouldBindJSON(&p); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
 		return
 	}
-	if err := a.Players.Upsert(&p); err != nil {
+	var err error
+	if middleware.Can(c, rbac.PlayerWrite) {
+		err = a.Players.Upsert(&p)
+	} else {
+		uidVal, _ := c.Get("uid")
+		err = a.Players.UpsertForClub(uidVal.(uint), &p)
+	}
+	if errors.Is(err, services.ErrNotYourClub) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -157,6 +415,31 @@ func (a *API) getMatches(c *gin.Context) {
 	c.JSON(http.StatusOK, list)
 }
 
+func (a *API) teamCalendar(c *gin.Context) {
+	id64, err := strconv.ParseUint(strings.TrimSuffix(c.Param("teamId"), ".ics"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+		return
+	}
+	team, err := a.Teams.Get(uint(id64))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "team not found"})
+		return
+	}
+	list, err := a.Matches.ForTeams([]uint{team.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var buf bytes.Buffer
+	if err := calendar.Write(&buf, team.Name+" fixtures", list); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%s.ics", strings.ToLower(team.ShortName)))
+	c.Data(http.StatusOK, calendar.ContentType, buf.Bytes())
+}
+
 func (a *API) updateMatchResult(c *gin.Context) {
 	idStr := c.Param("id")
 	id64, err := strconv.ParseUint(idStr, 10, 64)
@@ -173,7 +456,15 @@ func (a *API) updateMatchResult(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
 		return
 	}
-	if err := a.Matches.UpdateResult(uint(id64), body.Home, body.Away, body.Status); err != nil {
+	err = a.Matches.UpdateResult(uint(id64), body.Home, body.Away, body.Status)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "match not found"})
+		return
+	case errors.Is(err, services.ErrInvalidStatus), errors.Is(err, services.ErrNegativeScore):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -181,7 +472,11 @@ func (a *API) updateMatchResult(c *gin.Context) {
 }
 
 func (a *API) getTable(c *gin.Context) {
-	rows, err := a.Table.Compute()
+	compute := a.Table.Compute
+	if c.Query("live") == "true" {
+		compute = a.Table.LiveTable
+	}
+	rows, err := compute()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
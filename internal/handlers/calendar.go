@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+
+	"project/internal/calendar"
+	"project/internal/models"
+	"project/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// calendarFeed serves GET /cal/:file where file is "{token}.ics". The token
+// is the only credential, so unknown tokens get a bare 404.
+func (a *API) calendarFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("file"), ".ics")
+	u, list, err := a.Calendar.Resolve(token, a.Matches)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	var buf bytes.Buffer
+	if err := calendar.Write(&buf, u.Name+"'s EPL fixtures", list); err != nil {
+		log.Printf("calendar feed for user %d: %v", u.ID, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Cache-Control", "private, max-age=900")
+	c.Data(http.StatusOK, calendar.ContentType, buf.Bytes())
+}
+
+func (a *API) getCalendarFeed(c *gin.Context) {
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	f, err := a.Calendar.Feed(uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, a.calendarFeedJSON(f))
+}
+
+func (a *API) rotateCalendarFeed(c *gin.Context) {
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	f, err := a.Calendar.Rotate(uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, a.calendarFeedJSON(f))
+}
+
+func (a *API) revokeCalendarFeed(c *gin.Context) {
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	if err := a.Calendar.Revoke(uid); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (a *API) updateCalendarFeed(c *gin.Context) {
+	var body struct {
+		TeamIDs         []uint   `json:"teamIds"`
+		Competitions    []string `json:"competitions"`
+		IncludeFavorite *bool    `json:"includeFavorite"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	includeFavorite := true
+	if body.IncludeFavorite != nil {
+		includeFavorite = *body.IncludeFavorite
+	}
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	f, err := a.Calendar.UpdateSelection(uid, body.TeamIDs, body.Competitions, includeFavorite)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, a.calendarFeedJSON(f))
+}
+
+// calendarFeedJSON describes a feed. The subscription URL is built from
+// the configured BaseURL, never from request headers, since it carries the
+// feed's secret token.
+func (a *API) calendarFeedJSON(f *models.CalendarFeed) gin.H {
+	teamIDs := make([]uint, 0, len(f.Teams))
+	for _, t := range f.Teams {
+		teamIDs = append(teamIDs, t.ID)
+	}
+	out := gin.H{
+		"enabled":         f.TokenHash != "",
+		"includeFavorite": f.IncludeFavorite,
+		"teamIds":         teamIDs,
+		"competitions":    services.FeedCompetitions(f),
+	}
+	if f.Token != "" {
+		feedURL := strings.TrimRight(a.BaseURL, "/") + "/cal/" + f.Token + ".ics"
+		_, rest, _ := strings.Cut(feedURL, "://")
+		out["url"] = feedURL
+		out["webcal"] = "webcal://" + rest
+	}
+	return out
+}
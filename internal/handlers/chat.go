@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"project/internal/chat"
+	"project/internal/middleware"
+	"project/internal/models"
+	"project/internal/rbac"
+	"project/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// AttachChat wires the match chat rooms to the API: moderator actions go to
+// the moderation log, and a room is closed as soon as its match stops being
+// live.
+func (a *API) AttachChat(m *chat.Manager) {
+	a.Chat = m
+	m.Audit = func(modID uint, action string, matchID uint, reason, detail string) {
+		if a.Moderation == nil {
+			return
+		}
+		if err := a.Moderation.Record(modID, action, "match", matchID, reason, detail); err != nil {
+			log.Printf("chat: audit %s: %v", action, err)
+		}
+	}
+	a.Events.Subscribe(services.EventMatchResultChanged, func(e services.Event) {
+		p, ok := e.Payload.(services.MatchResultChanged)
+		if ok && p.PreviousStatus == "live" && p.Status != "live" {
+			m.Close(p.MatchID)
+		}
+	})
+}
+
+// chatUser identifies the caller from a bearer header, the auth cookie or
+// the chat.TokenProtocol subprotocol (browsers cannot set headers on a
+// WebSocket). Tokens are never taken from the URL, which ends up in logs.
+// No token means an anonymous viewer; a bad token is an error.
+func (a *API) chatUser(c *gin.Context) (*chat.User, error) {
+	raw, _ := middleware.TokenFromRequest(c)
+	if p := websocket.Subprotocols(c.Request); raw == "" && len(p) == 2 && p[0] == chat.TokenProtocol {
+		raw = p[1]
+	}
+	if raw == "" {
+		return nil, nil
+	}
+	claims, err := middleware.ParseToken(a.Keys, raw)
+	if err != nil {
+		return nil, err
+	}
+	if !a.Auth.SessionActive(claims.SessionID) {
+		return nil, services.ErrSessionRevoked
+	}
+	var u models.User
+	if err := a.Auth.DB.First(&u, claims.UserID).Error; err != nil {
+		return nil, err
+	}
+	// Admins who must use 2FA only moderate from a two-factor session, as
+	// on the REST moderation routes.
+	mfaMissing := a.Auth.RequireAdmin2FA && claims.Role == rbac.Admin && !claims.MFA
+	cu := &chat.User{ID: u.ID, Name: u.Name, Moderator: rbac.Can(claims.Role, rbac.ChatModerate) && !mfaMissing}
+	// Unverified accounts may watch but not post, as with comments.
+	if u.EmailVerifiedAt == nil {
+		cu.ReadOnly, cu.Unverified = true, true
+	}
+	if a.Moderation != nil {
+		if ban, _ := a.Moderation.ActiveBan(u.ID); ban != nil {
+			cu.ReadOnly = true
+		}
+	}
+	return cu, nil
+}
+
+// liveMatch parses :id and checks the match is being played and chat is
+// wired up.
+func (a *API) liveMatch(c *gin.Context) (uint, bool) {
+	if a.Chat == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "chat is not available"})
+		return 0, false
+	}
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	m, err := a.Matches.Get(uint(id64))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "match not found"})
+		return 0, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	if m.Status != "live" {
+		c.JSON(http.StatusConflict, gin.H{"error": "chat is only open while the match is live"})
+		return 0, false
+	}
+	return m.ID, true
+}
+
+// chatSocket joins the match's chat room over WebSocket.
+func (a *API) chatSocket(c *gin.Context) {
+	matchID, ok := a.liveMatch(c)
+	if !ok {
+		return
+	}
+	u, err := a.chatUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+	a.Chat.Serve(c.Writer, c.Request, matchID, u)
+}
+
+// chatSnapshot returns the viewer count, slow mode and backlog without
+// joining the room.
+func (a *API) chatSnapshot(c *gin.Context) {
+	matchID, ok := a.liveMatch(c)
+	if !ok {
+		return
+	}
+	snap, _ := a.Chat.Snapshot(matchID)
+	c.JSON(http.StatusOK, snap)
+}
+
+func chatError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, chat.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, chat.ErrNotModerator):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// moderator builds the chat identity for a request that passed
+// RequirePermission(rbac.ChatModerate).
+func moderator(c *gin.Context) *chat.User {
+	uidVal, _ := c.Get("uid")
+	return &chat.User{ID: uidVal.(uint), Moderator: true}
+}
+
+func (a *API) deleteChatMessage(c *gin.Context) {
+	matchID, ok := a.liveMatch(c)
+	if !ok {
+		return
+	}
+	msgID, err := strconv.ParseUint(c.Param("msgId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+	if err := a.Chat.Delete(moderator(c), matchID, msgID, reasonBody(c)); err != nil {
+		chatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// muteChatUser mutes a user in a match's chat. Body:
+// {"userId":3,"duration":"10m","reason":"..."}; "0s" unmutes.
+func (a *API) muteChatUser(c *gin.Context) {
+	matchID, ok := a.liveMatch(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		UserID   uint   `json:"userId"`
+		Duration string `json:"duration"`
+		Reason   string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId and duration are required"})
+		return
+	}
+	d, err := time.ParseDuration(req.Duration)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duration must look like 30s, 10m or 1h"})
+		return
+	}
+	if err := a.Chat.Mute(moderator(c), matchID, req.UserID, d, req.Reason); err != nil {
+		chatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// setChatSlowMode sets the minimum gap between a user's messages. Body:
+// {"seconds":30}; 0 turns it off.
+func (a *API) setChatSlowMode(c *gin.Context) {
+	matchID, ok := a.liveMatch(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Seconds int `json:"seconds"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if err := a.Chat.SetSlowMode(moderator(c), matchID, time.Duration(req.Seconds)*time.Second); err != nil {
+		chatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
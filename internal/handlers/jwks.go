@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jwks publishes the public keys access tokens are signed with, so other
+// services can verify them. With the HS256 secret the key list is empty.
+func (a *API) jwks(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, a.Keys.JWKS())
+}
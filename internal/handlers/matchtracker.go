@@ -1,28 +1,105 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+
+	"project/internal/models"
+	"project/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// LiveMatchTrackerHandler streams real-time match data (stub for now)
-func LiveMatchTrackerHandler(c *gin.Context) {
-	// TODO: Replace with real-time data source (WebSocket or SSE)
-	c.JSON(http.StatusOK, gin.H{
-		"matchId":  1,
-		"homeTeam": "Arsenal",
-		"awayTeam": "Chelsea",
-		"score":    "2-1",
-		"minute":   67,
-		"commentary": []string{
-			"67' GOAL! Arsenal take the lead!",
-			"65' Substitution: Smith Rowe on for Saka.",
-			"60' Yellow card for Chelsea.",
-		},
-		"playerStats": []gin.H{
-			{"name": "Bukayo Saka", "goals": 1, "assists": 0, "minutes": 67},
-			{"name": "Kai Havertz", "goals": 1, "assists": 0, "minutes": 67},
-		},
-	})
+// matchTracker returns the live view of ?matchId=, built from the match's
+// recorded events. Without matchId it picks the most recent live match.
+func (a *API) matchTracker(c *gin.Context) {
+	var matchID uint
+	if v := c.Query("matchId"); v != "" {
+		id64, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid matchId"})
+			return
+		}
+		matchID = uint(id64)
+	} else {
+		m, err := a.Matches.LatestLive()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no live match"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		matchID = m.ID
+	}
+	t, err := a.MatchEvents.Tracker(matchID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "match not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+func (a *API) getMatchEvents(c *gin.Context) {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	list, err := a.MatchEvents.Timeline(uint(id64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (a *API) addMatchEvent(c *gin.Context) {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var body struct {
+		Type            string `json:"type"`
+		Minute          int    `json:"minute"`
+		ExtraMinute     int    `json:"extraMinute"`
+		TeamID          *uint  `json:"teamId"`
+		PlayerID        *uint  `json:"playerId"`
+		RelatedPlayerID *uint  `json:"relatedPlayerId"`
+		ReversesEventID *uint  `json:"reversesEventId"`
+		Detail          string `json:"detail"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	e := models.MatchEvent{
+		Type:            body.Type,
+		Minute:          body.Minute,
+		ExtraMinute:     body.ExtraMinute,
+		TeamID:          body.TeamID,
+		PlayerID:        body.PlayerID,
+		RelatedPlayerID: body.RelatedPlayerID,
+		ReversesEventID: body.ReversesEventID,
+		Detail:          body.Detail,
+	}
+	err = a.MatchEvents.Append(uint(id64), &e)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, e)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "match not found"})
+	case errors.Is(err, services.ErrMatchNotLive):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidEvent), errors.Is(err, services.ErrPlayerMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
 }
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"project/internal/rbac"
+	"project/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// modError maps moderation service errors to HTTP statuses.
+func modError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrCommentNotFound), errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, services.ErrNoActiveBan):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlreadyReported), errors.Is(err, services.ErrLastAdmin),
+		errors.Is(err, services.ErrBanStaff):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrReasonRequired), errors.Is(err, services.ErrInvalidBan),
+		errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrClubTeamNeeded):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// reasonBody is the optional {"reason": "..."} body moderator actions take.
+func reasonBody(c *gin.Context) string {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	c.ShouldBindJSON(&req)
+	return req.Reason
+}
+
+// reportComment files a report as the authenticated user.
+func (a *API) reportComment(c *gin.Context) {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	if err := a.Moderation.Report(uint(id64), uid, reasonBody(c)); err != nil {
+		modError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "reported"})
+}
+
+func (a *API) moderationQueue(c *gin.Context) {
+	page, size := pagination(c)
+	items, total, err := a.Moderation.Queue(page, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": total, "page": page, "pageSize": size})
+}
+
+// commentAction runs one of the per-comment moderator actions.
+func (a *API) commentAction(act func(moderatorID, commentID uint, reason string) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		uidVal, _ := c.Get("uid")
+		uid := uidVal.(uint)
+		if err := act(uid, uint(id64), reasonBody(c)); err != nil {
+			modError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+// banUser bans a user from posting. Body: {"duration":"72h","reason":"..."}.
+func (a *API) banUser(c *gin.Context) {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req struct {
+		Duration string `json:"duration"`
+		Reason   string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	d, err := time.ParseDuration(req.Duration)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duration must look like 30m, 24h or 168h"})
+		return
+	}
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	ban, err := a.Moderation.Ban(uid, uint(id64), d, req.Reason)
+	if err != nil {
+		modError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ban)
+}
+
+func (a *API) unbanUser(c *gin.Context) {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	if err := a.Moderation.Unban(uid, uint(id64), reasonBody(c)); err != nil {
+		modError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (a *API) userBans(c *gin.Context) {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	list, err := a.Moderation.Bans(uint(id64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// moderationLog returns the audit log, filtered by ?action= and ?moderatorId=.
+func (a *API) moderationLog(c *gin.Context) {
+	page, size := pagination(c)
+	var modID uint
+	if v, err := strconv.ParseUint(c.Query("moderatorId"), 10, 64); err == nil {
+		modID = uint(v)
+	}
+	items, total, err := a.Moderation.Log(c.Query("action"), modID, page, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": total, "page": page, "pageSize": size})
+}
+
+// setUserRole assigns a role. Body: {"role":"club_official","teamId":3};
+// teamId is only used for club officials.
+func (a *API) setUserRole(c *gin.Context) {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req struct {
+		Role   string `json:"role"`
+		TeamID *uint  `json:"teamId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	if err := a.Moderation.SetRole(uid, uint(id64), req.Role, req.TeamID); err != nil {
+		modError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// listRoles describes every role and the permissions it grants.
+func (a *API) listRoles(c *gin.Context) {
+	out := make([]gin.H, 0)
+	for _, r := range rbac.Roles() {
+		out = append(out, gin.H{"role": r, "permissions": rbac.Permissions(r)})
+	}
+	c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"project/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStateCookie carries a provider sign-in from login to callback.
+const oidcStateCookie = "oidc_state"
+
+func (a *API) oidcProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, a.Auth.OIDCProviders())
+}
+
+// oidcLogin sends the browser to the provider. ?next= is where to land
+// after signing in.
+func (a *API) oidcLogin(c *gin.Context) {
+	redirect, cookie, err := a.Auth.BeginOIDC(c.Request.Context(), c.Param("provider"), localPath(c.Query("next")))
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownProvider) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("oidc %s: %v", c.Param("provider"), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider is unavailable"})
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, cookie, 600, "/api/auth/oidc", "", a.secureCookies(c), true)
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// oidcCallback is where the provider sends the browser back. The outcome
+// goes to the auth page, which picks up the new session from the refresh
+// cookie (or asks for a 2FA code) and continues to next.
+func (a *API) oidcCallback(c *gin.Context) {
+	cookie, _ := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, "/api/auth/oidc", "", a.secureCookies(c), true)
+	if c.Query("error") != "" {
+		c.Redirect(http.StatusFound, "/auth?oidcError=denied")
+		return
+	}
+	pair, _, next, err := a.Auth.CompleteOIDC(c.Request.Context(), c.Param("provider"), c.Query("code"), c.Query("state"), cookie, clientInfo(c))
+	if next == "" {
+		next = "/feed"
+	}
+	var challenge *services.TwoFactorRequiredError
+	switch {
+	case err == nil:
+		a.setAuthCookies(c, pair)
+		c.Redirect(http.StatusFound, "/auth?next="+url.QueryEscape(next))
+	case errors.As(err, &challenge):
+		c.Redirect(http.StatusFound, "/auth?twofactor="+url.QueryEscape(challenge.Challenge)+"&next="+url.QueryEscape(next))
+	default:
+		code := "failed"
+		switch {
+		case errors.Is(err, services.ErrOIDCState):
+			code = "expired"
+		case errors.Is(err, services.ErrOIDCNoEmail):
+			code = "no_email"
+		case errors.Is(err, services.ErrOIDCEmailUnverified):
+			code = "email_unverified"
+		case errors.Is(err, services.ErrAccountSuspended):
+			code = "suspended"
+		default:
+			log.Printf("oidc %s: %v", c.Param("provider"), err)
+		}
+		c.Redirect(http.StatusFound, "/auth?oidcError="+code)
+	}
+}
+
+// localPath returns p if it is a path on this site, so ?next= cannot send
+// users elsewhere.
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return ""
+	}
+	return p
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"project/internal/hub"
+	"project/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Realtime topics served over /ws.
+const (
+	TopicStandings   = "standings"
+	topicMatchPrefix = "match:"
+	topicTeamPrefix  = "team:"
+)
+
+func matchTopic(id uint) string { return fmt.Sprintf("%s%d", topicMatchPrefix, id) }
+func teamTopic(id uint) string  { return fmt.Sprintf("%s%d", topicTeamPrefix, id) }
+
+// AttachHub wires the WebSocket hub to the API: it restricts topics to
+// standings, match:{id} and team:{id}, sends a snapshot on subscribe, and
+// forwards domain events from the bus to the matching topics.
+func (a *API) AttachHub(h *hub.Hub) {
+	a.Hub = h
+	h.AllowTopic = validTopic
+	h.OnSubscribe = a.sendSnapshot
+
+	a.Events.Subscribe(services.EventStandingsUpdated, func(e services.Event) {
+		if p, ok := e.Payload.(services.StandingsUpdated); ok {
+			h.Publish(TopicStandings, p.Rows)
+		}
+	})
+	a.Events.Subscribe(services.EventMatchEventAdded, func(e services.Event) {
+		p, ok := e.Payload.(services.MatchEventAdded)
+		if !ok {
+			return
+		}
+		msg := gin.H{"kind": "match_event", "matchId": p.MatchID, "event": p.Event}
+		h.Publish(matchTopic(p.MatchID), msg)
+		if p.Event.TeamID != nil {
+			h.Publish(teamTopic(*p.Event.TeamID), msg)
+		}
+	})
+	a.Events.Subscribe(services.EventMatchResultChanged, func(e services.Event) {
+		p, ok := e.Payload.(services.MatchResultChanged)
+		if !ok {
+			return
+		}
+		msg := gin.H{
+			"kind":           "score",
+			"matchId":        p.MatchID,
+			"homeScore":      p.HomeScore,
+			"awayScore":      p.AwayScore,
+			"status":         p.Status,
+			"previousStatus": p.PreviousStatus,
+		}
+		h.Publish(matchTopic(p.MatchID), msg)
+		h.Publish(teamTopic(p.HomeTeamID), msg)
+		h.Publish(teamTopic(p.AwayTeamID), msg)
+	})
+}
+
+func validTopic(topic string) bool {
+	if topic == TopicStandings {
+		return true
+	}
+	for _, prefix := range []string{topicMatchPrefix, topicTeamPrefix} {
+		if strings.HasPrefix(topic, prefix) {
+			_, err := strconv.ParseUint(strings.TrimPrefix(topic, prefix), 10, 64)
+			return err == nil
+		}
+	}
+	return false
+}
+
+func (a *API) sendSnapshot(c *hub.Client, topic string) {
+	switch {
+	case topic == TopicStandings:
+		if rows, err := a.Table.LiveTable(); err == nil {
+			c.Send(hub.Message{Type: hub.TypeUpdate, Topic: topic, Data: rows})
+		}
+	case strings.HasPrefix(topic, topicMatchPrefix):
+		id, _ := strconv.ParseUint(strings.TrimPrefix(topic, topicMatchPrefix), 10, 64)
+		if t, err := a.MatchEvents.Tracker(uint(id)); err == nil {
+			c.Send(hub.Message{Type: hub.TypeUpdate, Topic: topic, Data: gin.H{"kind": "snapshot", "matchId": t.MatchID, "tracker": t}})
+		}
+	}
+}
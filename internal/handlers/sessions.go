@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"project/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listSessions returns the caller's signed-in devices, marking the one
+// making the request.
+func (a *API) listSessions(c *gin.Context) {
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	sidVal, _ := c.Get("sid")
+	sid, _ := sidVal.(uint)
+	list, err := a.Auth.Sessions(uid, sid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// revokeSession signs out one of the caller's devices. Revoking the current
+// session also clears the auth cookies.
+func (a *API) revokeSession(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	if err := a.Auth.RevokeSession(uid, uint(id)); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sidVal, _ := c.Get("sid")
+	if sid, _ := sidVal.(uint); sid == uint(id) {
+		a.clearAuthCookies(c)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"project/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	streamHeartbeat = 15 * time.Second
+	streamBuffer    = 64
+)
+
+type sseMessage struct {
+	id    uint
+	event string
+	data  interface{}
+}
+
+// matchStream serves GET /api/matches/:id/stream as Server-Sent Events.
+// Match events carry their database ID as the SSE id, so a reconnecting
+// client's Last-Event-ID replays exactly what it missed. Score and status
+// messages have no id; a snapshot of both is sent on every (re)connect.
+// A client that cannot keep up is disconnected and recovers by replay.
+func (a *API) matchStream(c *gin.Context) {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	matchID := uint(id64)
+	if _, err := a.Matches.Get(matchID); errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "match not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("lastEventId")
+	}
+	var after uint
+	if v, err := strconv.ParseUint(lastID, 10, 64); err == nil {
+		after = uint(v)
+	}
+
+	// Subscribe before replaying so nothing published in between is lost;
+	// duplicates are filtered by ID below.
+	out := make(chan sseMessage, streamBuffer)
+	overflow := make(chan struct{})
+	var once sync.Once
+	send := func(msg sseMessage) {
+		select {
+		case out <- msg:
+		default:
+			once.Do(func() { close(overflow) })
+		}
+	}
+	unsubEvents := a.Events.Subscribe(services.EventMatchEventAdded, func(e services.Event) {
+		if p, ok := e.Payload.(services.MatchEventAdded); ok && p.MatchID == matchID {
+			send(sseMessage{id: p.Event.ID, event: "match_event", data: p.Event})
+		}
+	})
+	defer unsubEvents()
+	unsubResults := a.Events.Subscribe(services.EventMatchResultChanged, func(e services.Event) {
+		p, ok := e.Payload.(services.MatchResultChanged)
+		if !ok || p.MatchID != matchID {
+			return
+		}
+		send(sseMessage{event: "score", data: gin.H{"homeScore": p.HomeScore, "awayScore": p.AwayScore, "status": p.Status}})
+		if p.Status != p.PreviousStatus {
+			send(sseMessage{event: "status", data: gin.H{"status": p.Status, "previousStatus": p.PreviousStatus}})
+		}
+	})
+	defer unsubResults()
+
+	missed, err := a.MatchEvents.Since(matchID, after)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Read the score after subscribing, so a change in between is not lost.
+	m, err := a.Matches.Get(matchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	fmt.Fprint(w, "retry: 3000\n\n")
+	for _, e := range missed {
+		writeSSE(w, sseMessage{id: e.ID, event: "match_event", data: e})
+		after = e.ID
+	}
+	writeSSE(w, sseMessage{event: "score", data: gin.H{"homeScore": scoreOrZero(m.HomeScore), "awayScore": scoreOrZero(m.AwayScore), "status": m.Status}})
+	w.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-overflow:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			w.Flush()
+		case msg := <-out:
+			if msg.id != 0 {
+				if msg.id <= after {
+					continue
+				}
+				after = msg.id
+			}
+			writeSSE(w, msg)
+			w.Flush()
+		}
+	}
+}
+
+func writeSSE(w io.Writer, msg sseMessage) {
+	data, err := json.Marshal(msg.data)
+	if err != nil {
+		return
+	}
+	if msg.id != 0 {
+		fmt.Fprintf(w, "id: %d\n", msg.id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.event, data)
+}
+
+func scoreOrZero(v *int) int {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
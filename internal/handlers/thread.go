@@ -1,57 +1,190 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+
+	"project/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	// maxPage keeps (page-1)*pageSize far from overflowing an offset.
+	maxPage = 1 << 20
 )
 
-type Thread struct {
-	ID       int       `json:"id"`
-	MatchID  int       `json:"matchId"`
-	Title    string    `json:"title"`
-	Comments []Comment `json:"comments"`
+// pagination reads ?page= and ?pageSize=, falling back to sane defaults.
+func pagination(c *gin.Context) (page, size int) {
+	page, _ = strconv.Atoi(c.Query("page"))
+	if page < 1 {
+		page = 1
+	}
+	if page > maxPage {
+		page = maxPage
+	}
+	size, _ = strconv.Atoi(c.Query("pageSize"))
+	if size < 1 {
+		size = defaultPageSize
+	}
+	if size > maxPageSize {
+		size = maxPageSize
+	}
+	return page, size
 }
 
-type Comment struct {
-	User    string `json:"user"`
-	Message string `json:"message"`
-	Time    string `json:"time"`
+// listThreads returns all match threads, or only those of ?matchId=.
+func (a *API) listThreads(c *gin.Context) {
+	var matchID uint
+	if v, err := strconv.ParseUint(c.Query("matchId"), 10, 64); err == nil {
+		matchID = uint(v)
+	}
+	list, err := a.Threads.List(matchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
 }
 
-// In-memory stub for threads
-var threads = []Thread{
-	{
-		ID: 1, MatchID: 1, Title: "Arsenal vs Chelsea Match Thread",
-		Comments: []Comment{
-			{User: "fan1", Message: "What a goal!", Time: "2026-02-10T18:10:00Z"},
-			{User: "fan2", Message: "VAR check incoming...", Time: "2026-02-10T18:12:00Z"},
-		},
-	},
+func (a *API) getThread(c *gin.Context) {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	t, err := a.Threads.View(uint(id64))
+	if errors.Is(err, services.ErrThreadNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, t)
 }
 
-// ListMatchThreads returns all match threads
-func ListMatchThreads(c *gin.Context) {
-	c.JSON(http.StatusOK, threads)
+func (a *API) listComments(c *gin.Context) {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	page, size := pagination(c)
+	sort := c.DefaultQuery("sort", services.SortNew)
+	switch sort {
+	case services.SortNew, services.SortOld, services.SortTop, services.SortControversial:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be new, old, top or controversial"})
+		return
+	}
+	depth := services.MaxCommentDepth
+	if v := c.Query("depth"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid depth"})
+			return
+		}
+		if d < depth {
+			depth = d
+		}
+	}
+	items, total, err := a.Threads.Comments(uint(id64), services.CommentQuery{Page: page, PageSize: size, Sort: sort, Depth: depth})
+	if errors.Is(err, services.ErrThreadNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": total, "page": page, "pageSize": size, "sort": sort})
 }
 
-// PostComment adds a comment to a thread (stub, no auth)
-func PostComment(c *gin.Context) {
+// postComment adds a comment as the authenticated user, as a reply when
+// parentId is given.
+func (a *API) postComment(c *gin.Context) {
 	var req struct {
-		ThreadID int    `json:"threadId"`
-		User     string `json:"user"`
+		ThreadID uint   `json:"threadId"`
+		ParentID *uint  `json:"parentId"`
 		Message  string `json:"message"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
 		return
 	}
-	for i := range threads {
-		if threads[i].ID == req.ThreadID {
-			threads[i].Comments = append(threads[i].Comments, Comment{User: req.User, Message: req.Message, Time: "2026-02-10T18:20:00Z"})
-			c.JSON(http.StatusOK, threads[i])
-			return
-		}
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	cm, err := a.Threads.AddComment(req.ThreadID, uid, req.ParentID, req.Message)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, cm)
+	case errors.Is(err, services.ErrThreadNotFound), errors.Is(err, services.ErrCommentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrCommentRejected):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPostingTooFast):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrEmailNotVerified):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPostingBanned):
+		ban, _ := a.Moderation.ActiveBan(uid)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "ban": ban})
+	case errors.Is(err, services.ErrEmptyComment), errors.Is(err, services.ErrCommentTooLong), errors.Is(err, services.ErrTooDeep):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// voteComment sets the caller's vote on a comment: 1, -1, or 0 to clear it.
+func (a *API) voteComment(c *gin.Context) {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req struct {
+		Value *int `json:"value"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Value == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "value is required"})
+		return
+	}
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	cm, err := a.Threads.Vote(uint(id64), uid, *req.Value)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, cm)
+	case errors.Is(err, services.ErrCommentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidVote):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (a *API) createThread(c *gin.Context) {
+	var req struct {
+		MatchID uint   `json:"matchId"`
+		Title   string `json:"title"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	t, err := a.Threads.Create(req.MatchID, req.Title)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "match not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	c.JSON(http.StatusNotFound, gin.H{"error": "thread not found"})
+	c.JSON(http.StatusOK, t)
 }
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"project/internal/middleware"
+	"project/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func twoFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCode), errors.Is(err, services.ErrPasswordIncorrect):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorEnabled), errors.Is(err, services.ErrTwoFactorDisabled),
+		errors.Is(err, services.ErrNoPendingSetup), errors.Is(err, services.ErrTwoFactorMandatory):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (a *API) twoFactorStatus(c *gin.Context) {
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	st, err := a.Auth.TwoFactorStatus(uid)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, st)
+}
+
+// setupTwoFactor returns a new secret and its otpauth:// URI for the
+// authenticator app. Nothing changes until enableTwoFactor confirms it.
+func (a *API) setupTwoFactor(c *gin.Context) {
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	setup, err := a.Auth.SetupTwoFactor(uid)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, setup)
+}
+
+// enableTwoFactor turns 2FA on with the first code from the app. Body:
+// {"code":"123456"}. The recovery codes in the response are not shown again.
+func (a *API) enableTwoFactor(c *gin.Context) {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	sidVal, _ := c.Get("sid")
+	sid, _ := sidVal.(uint)
+	codes, pair, err := a.Auth.EnableTwoFactor(uid, sid, body.Code)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	resp := gin.H{"status": "ok", "recoveryCodes": codes}
+	if pair != nil {
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(middleware.AccessCookie, pair.AccessToken, pair.ExpiresIn, "/", "", a.secureCookies(c), true)
+		resp["token"] = pair.AccessToken
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// disableTwoFactor needs the password and a current code. Body:
+// {"password":"...","code":"123456"}.
+func (a *API) disableTwoFactor(c *gin.Context) {
+	var body struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Password == "" || body.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password and code are required"})
+		return
+	}
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	if err := a.Auth.DisableTwoFactor(uid, body.Password, body.Code); err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// regenerateRecoveryCodes replaces every recovery code. Body:
+// {"code":"123456"}.
+func (a *API) regenerateRecoveryCodes(c *gin.Context) {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	codes, err := a.Auth.RegenerateRecoveryCodes(uid, body.Code)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"project/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userAdminError maps user management errors to HTTP statuses.
+func userAdminError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSelfAction), errors.Is(err, services.ErrLastAdmin),
+		errors.Is(err, services.ErrEmailTaken), errors.Is(err, services.ErrNotSuspended):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrReasonRequired), errors.Is(err, services.ErrInvalidRole),
+		errors.Is(err, services.ErrClubTeamNeeded), errors.Is(err, services.ErrInvalidEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// listUsers searches accounts: ?q= matches name or email, ?role= and
+// ?suspended=true|false filter.
+func (a *API) listUsers(c *gin.Context) {
+	page, size := pagination(c)
+	f := services.UserFilter{Query: c.Query("q"), Role: c.Query("role")}
+	if v, err := strconv.ParseBool(c.Query("suspended")); err == nil {
+		f.Suspended = &v
+	}
+	items, total, err := a.Auth.ListUsers(f, page, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": total, "page": page, "pageSize": size})
+}
+
+// userAction adapts an admin action on the user in :id, with an optional
+// {"reason": "..."} body.
+func (a *API) userAction(fn func(adminID, userID uint, reason string) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		uidVal, _ := c.Get("uid")
+		if err := fn(uidVal.(uint), uint(id64), reasonBody(c)); err != nil {
+			userAdminError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+// inviteUser creates an account with a role and emails the person a link
+// to choose a password. Body: {"email","name","role","teamId"}; role is
+// required so nobody becomes an admin by omission.
+func (a *API) inviteUser(c *gin.Context) {
+	var req struct {
+		Email  string `json:"email"`
+		Name   string `json:"name"`
+		Role   string `json:"role"`
+		TeamID *uint  `json:"teamId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if req.Role == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role is required"})
+		return
+	}
+	uidVal, _ := c.Get("uid")
+	u, err := a.Auth.InviteUser(uidVal.(uint), req.Email, req.Name, req.Role, req.TeamID)
+	if err != nil {
+		userAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": u.ID, "email": u.Email, "role": u.Role})
+}
+
+// acceptInvite finishes an invited account and signs it in. Body:
+// {"token","name","password"}.
+func (a *API) acceptInvite(c *gin.Context) {
+	var body struct {
+		Token    string `json:"token"`
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token and password are required"})
+		return
+	}
+	pair, u, err := a.Auth.AcceptInvite(body.Token, body.Name, body.Password, clientInfo(c))
+	switch {
+	case errors.Is(err, services.ErrInvalidLink), errors.Is(err, services.ErrWeakPassword):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrAccountSuspended):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	a.setAuthCookies(c, pair)
+	c.JSON(http.StatusOK, gin.H{"token": pair.AccessToken, "refreshToken": pair.RefreshToken, "expiresIn": pair.ExpiresIn, "user": u})
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"project/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// forgotPassword emails a reset link. It answers the same whether or not the
+// address is registered.
+func (a *API) forgotPassword(c *gin.Context) {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
+		return
+	}
+	if err := a.Auth.RequestPasswordReset(body.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not send the reset email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// resetPassword sets a new password from a reset link and signs the user out
+// everywhere.
+func (a *API) resetPassword(c *gin.Context) {
+	var body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token and password are required"})
+		return
+	}
+	if err := a.Auth.ResetPassword(body.Token, body.Password); err != nil {
+		authLinkError(c, err)
+		return
+	}
+	a.clearAuthCookies(c)
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (a *API) verifyEmail(c *gin.Context) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+	u, err := a.Auth.VerifyEmail(body.Token)
+	if err != nil {
+		authLinkError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "emailVerifiedAt": u.EmailVerifiedAt})
+}
+
+// resendVerification emails the signed-in user a new verification link.
+func (a *API) resendVerification(c *gin.Context) {
+	uidVal, _ := c.Get("uid")
+	uid := uidVal.(uint)
+	if err := a.Auth.SendVerification(uid); err != nil {
+		authLinkError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func authLinkError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidLink), errors.Is(err, services.ErrWeakPassword):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlreadyVerified):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,299 @@
+package hub
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = (pongWait * 9) / 10
+	maxMessageSize = 4096
+	sendBuffer     = 64
+	// maxTopics bounds how many topics one client may follow, and so how
+	// much of the hub's topic index a single socket can occupy.
+	maxTopics = 32
+)
+
+// Message is the envelope for everything the hub writes to a socket.
+type Message struct {
+	Type  string      `json:"type"`
+	Topic string      `json:"topic,omitempty"`
+	Data  interface{} `json:"data,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+// Message types.
+const (
+	TypeUpdate       = "update"
+	TypeSubscribed   = "subscribed"
+	TypeUnsubscribed = "unsubscribed"
+	TypeError        = "error"
+)
+
+// request is what clients send: {"action":"subscribe","topic":"match:12"}.
+type request struct {
+	Action string `json:"action"`
+	Topic  string `json:"topic"`
+}
+
+// Hub fans topic messages out to WebSocket clients. Every client has its own
+// buffered send queue drained by a writer goroutine, so a slow socket never
+// blocks Publish; a client whose queue is full is dropped.
+type Hub struct {
+	// AllowTopic reports whether clients may subscribe to a topic. Nil
+	// allows every topic.
+	AllowTopic func(topic string) bool
+	// OnSubscribe runs after a client joins a topic, typically to send it a
+	// snapshot of the current state.
+	OnSubscribe func(c *Client, topic string)
+	// CheckOrigin decides which browser origins may open a socket. Nil
+	// allows only the request's own host.
+	CheckOrigin func(r *http.Request) bool
+
+	mu      sync.RWMutex
+	clients map[*Client]struct{}
+	topics  map[string]map[*Client]struct{}
+}
+
+func New() *Hub {
+	return &Hub{
+		clients: make(map[*Client]struct{}),
+		topics:  make(map[string]map[*Client]struct{}),
+	}
+}
+
+// Client is one WebSocket connection.
+type Client struct {
+	hub    *Hub
+	conn   *websocket.Conn
+	send   chan []byte
+	topics map[string]struct{} // guarded by hub.mu
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// ServeHTTP upgrades the request and serves the socket until it closes.
+// Topics listed in ?topics=a,b are subscribed straight away.
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: h.CheckOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &Client{
+		hub:    h,
+		conn:   conn,
+		send:   make(chan []byte, sendBuffer),
+		topics: make(map[string]struct{}),
+	}
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+
+	go c.writePump()
+	if q := r.URL.Query().Get("topics"); q != "" {
+		for _, t := range strings.Split(q, ",") {
+			h.subscribe(c, strings.TrimSpace(t))
+		}
+	}
+	c.readPump()
+}
+
+// Publish sends data to every subscriber of topic.
+func (h *Hub) Publish(topic string, data interface{}) {
+	b, err := json.Marshal(Message{Type: TypeUpdate, Topic: topic, Data: data})
+	if err != nil {
+		log.Printf("hub: marshal %s: %v", topic, err)
+		return
+	}
+	h.mu.RLock()
+	targets := make([]*Client, 0, len(h.topics[topic]))
+	for c := range h.topics[topic] {
+		targets = append(targets, c)
+	}
+	h.mu.RUnlock()
+	for _, c := range targets {
+		c.enqueue(b)
+	}
+}
+
+// Subscribers returns how many clients currently follow topic.
+func (h *Hub) Subscribers(topic string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.topics[topic])
+}
+
+func (h *Hub) subscribe(c *Client, topic string) {
+	if topic == "" || (h.AllowTopic != nil && !h.AllowTopic(topic)) {
+		c.Send(Message{Type: TypeError, Topic: topic, Error: "unknown topic"})
+		return
+	}
+	h.mu.Lock()
+	if _, ok := h.clients[c]; !ok {
+		h.mu.Unlock()
+		return
+	}
+	if _, ok := c.topics[topic]; !ok && len(c.topics) >= maxTopics {
+		h.mu.Unlock()
+		c.Send(Message{Type: TypeError, Topic: topic, Error: "too many topics"})
+		return
+	}
+	subs, ok := h.topics[topic]
+	if !ok {
+		subs = make(map[*Client]struct{})
+		h.topics[topic] = subs
+	}
+	subs[c] = struct{}{}
+	c.topics[topic] = struct{}{}
+	h.mu.Unlock()
+
+	c.Send(Message{Type: TypeSubscribed, Topic: topic})
+	if h.OnSubscribe != nil {
+		h.OnSubscribe(c, topic)
+	}
+}
+
+func (h *Hub) unsubscribe(c *Client, topic string) {
+	h.mu.Lock()
+	h.removeFromTopic(c, topic)
+	h.mu.Unlock()
+	c.Send(Message{Type: TypeUnsubscribed, Topic: topic})
+}
+
+// removeFromTopic must be called with h.mu held.
+func (h *Hub) removeFromTopic(c *Client, topic string) {
+	delete(c.topics, topic)
+	if subs, ok := h.topics[topic]; ok {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+func (h *Hub) remove(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	delete(h.clients, c)
+	for topic := range c.topics {
+		h.removeFromTopic(c, topic)
+	}
+}
+
+// Send queues a message for this client only.
+func (c *Client) Send(m Message) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	c.enqueue(b)
+}
+
+// Topics returns the topics the client is subscribed to.
+func (c *Client) Topics() []string {
+	c.hub.mu.RLock()
+	defer c.hub.mu.RUnlock()
+	out := make([]string, 0, len(c.topics))
+	for t := range c.topics {
+		out = append(out, t)
+	}
+	return out
+}
+
+// enqueue never blocks: a client that cannot keep up is disconnected.
+func (c *Client) enqueue(b []byte) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	select {
+	case c.send <- b:
+		c.mu.Unlock()
+	default:
+		c.mu.Unlock()
+		c.close()
+	}
+}
+
+// close detaches the client and stops its writer, which closes the socket.
+func (c *Client) close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	close(c.send)
+	c.mu.Unlock()
+	c.hub.remove(c)
+}
+
+func (c *Client) readPump() {
+	defer c.close()
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, b, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req request
+		if err := json.Unmarshal(b, &req); err != nil {
+			c.Send(Message{Type: TypeError, Error: "invalid message"})
+			continue
+		}
+		switch req.Action {
+		case "subscribe":
+			c.hub.subscribe(c, req.Topic)
+		case "unsubscribe":
+			c.hub.unsubscribe(c, req.Topic)
+		default:
+			c.Send(Message{Type: TypeError, Error: "unknown action"})
+		}
+	}
+}
+
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case b, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, b); err != nil {
+				c.close()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
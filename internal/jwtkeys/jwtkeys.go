@@ -0,0 +1,395 @@
+// Package jwtkeys holds the keys access tokens are signed and verified with.
+// One key signs; any number of older keys keep verifying during a rotation.
+// Asymmetric keys (RS256, ES256, EdDSA) are published as a JWKS so other
+// services can verify tokens without sharing a secret. The HS256 shared
+// secret is the fallback when no key file is configured and is never
+// published. A Set can also be built from someone else's JWKS to verify
+// their tokens.
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+const minRSABits = 2048
+
+var (
+	ErrUnknownKey   = errors.New("token signed with an unknown key")
+	ErrAlgMismatch  = errors.New("token algorithm does not match its key")
+	ErrNoSigningKey = errors.New("no signing key configured")
+)
+
+// Config selects the keys. SigningKeyFile is a PEM private key (RSA, P-256
+// or Ed25519); when empty, tokens are signed with Secret using HS256.
+// VerifyKeyFiles are PEM keys (public or private) of earlier signing keys
+// that are still accepted.
+type Config struct {
+	Secret         string
+	SigningKeyFile string
+	VerifyKeyFiles []string
+}
+
+// Key is one signing or verification key.
+type Key struct {
+	ID     string // RFC 7638 thumbprint (or the JWKS kid); empty for HS256
+	Alg    string
+	sign   interface{} // nil for verify-only keys
+	verify interface{}
+}
+
+// Set is the signing key plus every key tokens are accepted from. Sets
+// built by ParseJWKS have no signing key.
+type Set struct {
+	signing *Key
+	keys    []*Key // asymmetric keys in configuration order
+	byID    map[string]*Key
+}
+
+// New loads the keys described by cfg.
+func New(cfg Config) (*Set, error) {
+	var s *Set
+	if cfg.SigningKeyFile != "" {
+		s = &Set{byID: make(map[string]*Key)}
+		if err := s.addFile(cfg.SigningKeyFile, true); err != nil {
+			return nil, err
+		}
+	} else if cfg.Secret != "" {
+		s = NewHMAC(cfg.Secret)
+	} else {
+		return nil, ErrNoSigningKey
+	}
+	for _, path := range cfg.VerifyKeyFiles {
+		if err := s.addFile(path, false); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// NewHMAC returns a set that signs and verifies with a shared secret.
+func NewHMAC(secret string) *Set {
+	k := &Key{Alg: HS256, sign: []byte(secret), verify: []byte(secret)}
+	return &Set{signing: k, byID: make(map[string]*Key)}
+}
+
+// FromPrivateKey returns a set that signs with key (RSA, P-256 ECDSA or
+// Ed25519).
+func FromPrivateKey(key crypto.Signer) (*Set, error) {
+	k, err := newKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Set{signing: k, keys: []*Key{k}, byID: map[string]*Key{k.ID: k}}, nil
+}
+
+// ParseJWKS builds a verification-only set from a JWKS document. Keys keep
+// the kid they were published under; keys not meant for signatures and
+// key types this package does not know are skipped.
+func ParseJWKS(data []byte) (*Set, error) {
+	var doc JWKS
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	s := &Set{byID: make(map[string]*Key)}
+	for _, j := range doc.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		k, err := fromJWK(j)
+		if err != nil {
+			continue
+		}
+		if _, dup := s.byID[k.ID]; !dup {
+			s.byID[k.ID] = k
+			s.keys = append(s.keys, k)
+		}
+	}
+	if len(s.keys) == 0 {
+		return nil, errors.New("JWKS has no usable signing keys")
+	}
+	return s, nil
+}
+
+// Alg is the algorithm new tokens are signed with.
+func (s *Set) Alg() string {
+	if s.signing == nil {
+		return ""
+	}
+	return s.signing.Alg
+}
+
+// Has reports whether a key with this kid is in the set.
+func (s *Set) Has(kid string) bool {
+	_, ok := s.byID[kid]
+	return ok
+}
+
+// Sign signs claims with the current key, naming it in the kid header.
+func (s *Set) Sign(claims jwt.Claims) (string, error) {
+	if s == nil || s.signing == nil {
+		return "", ErrNoSigningKey
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(s.signing.Alg), claims)
+	if s.signing.ID != "" {
+		token.Header["kid"] = s.signing.ID
+	}
+	return token.SignedString(s.signing.sign)
+}
+
+// Keyfunc finds the verification key for a token by its kid and refuses
+// tokens whose alg header does not match that key, so a public key can
+// never be used as an HMAC secret and "none" is never accepted. The HS256
+// secret only verifies while it is also the signing key. A token without a
+// kid is accepted from a set that holds exactly one asymmetric key.
+func (s *Set) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	var k *Key
+	if kid == "" {
+		if s.signing != nil && s.signing.Alg == HS256 {
+			k = s.signing
+		} else if s.signing == nil && len(s.keys) == 1 {
+			k = s.keys[0]
+		}
+	} else {
+		k = s.byID[kid]
+	}
+	if k == nil {
+		return nil, ErrUnknownKey
+	}
+	if t.Method == nil || t.Method.Alg() != k.Alg {
+		return nil, ErrAlgMismatch
+	}
+	return k.verify, nil
+}
+
+// Methods lists the algorithms of all accepted keys, for jwt.WithValidMethods.
+func (s *Set) Methods() []string {
+	seen := map[string]bool{}
+	var out []string
+	if s.signing != nil {
+		seen[s.signing.Alg] = true
+		out = append(out, s.signing.Alg)
+	}
+	for _, k := range s.keys {
+		if !seen[k.Alg] {
+			seen[k.Alg] = true
+			out = append(out, k.Alg)
+		}
+	}
+	return out
+}
+
+// JWK is a public key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public halves of the asymmetric keys, signing key first.
+func (s *Set) JWKS() JWKS {
+	out := JWKS{Keys: make([]JWK, 0, len(s.keys))}
+	for _, k := range s.keys {
+		out.Keys = append(out.Keys, toJWK(k))
+	}
+	return out
+}
+
+func toJWK(k *Key) JWK {
+	j := JWK{Kid: k.ID, Use: "sig", Alg: k.Alg}
+	switch pub := k.verify.(type) {
+	case *rsa.PublicKey:
+		j.Kty = "RSA"
+		j.N = b64(pub.N.Bytes())
+		j.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		j.Kty = "EC"
+		j.Crv = "P-256"
+		j.X = b64(pub.X.FillBytes(make([]byte, 32)))
+		j.Y = b64(pub.Y.FillBytes(make([]byte, 32)))
+	case ed25519.PublicKey:
+		j.Kty = "OKP"
+		j.Crv = "Ed25519"
+		j.X = b64(pub)
+	}
+	return j
+}
+
+func fromJWK(j JWK) (*Key, error) {
+	var pub interface{}
+	switch {
+	case j.Kty == "RSA":
+		n, err1 := base64.RawURLEncoding.DecodeString(j.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(j.E)
+		if err1 != nil || err2 != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("bad RSA key")
+		}
+		pub = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case j.Kty == "EC" && j.Crv == "P-256":
+		x, err1 := base64.RawURLEncoding.DecodeString(j.X)
+		y, err2 := base64.RawURLEncoding.DecodeString(j.Y)
+		if err1 != nil || err2 != nil {
+			return nil, errors.New("bad EC key")
+		}
+		ec := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !ec.Curve.IsOnCurve(ec.X, ec.Y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		pub = ec
+	case j.Kty == "OKP" && j.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("bad Ed25519 key")
+		}
+		pub = ed25519.PublicKey(x)
+	default:
+		return nil, fmt.Errorf("unsupported key type %s %s", j.Kty, j.Crv)
+	}
+	k, err := newKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	if j.Alg != "" && j.Alg != k.Alg {
+		return nil, fmt.Errorf("key %s is for %s", j.Kid, j.Alg)
+	}
+	if j.Kid != "" {
+		k.ID = j.Kid
+	}
+	return k, nil
+}
+
+// thumbprint is the RFC 7638 key ID: the SHA-256 of the required members in
+// lexicographic order.
+func thumbprint(j JWK) string {
+	var canonical string
+	switch j.Kty {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, j.E, j.N)
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, j.Crv, j.X, j.Y)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, j.Crv, j.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return b64(sum[:])
+}
+
+func (s *Set) addFile(path string, signing bool) error {
+	k, err := loadKey(path)
+	if err != nil {
+		return fmt.Errorf("jwt key %s: %w", path, err)
+	}
+	if signing {
+		if k.sign == nil {
+			return fmt.Errorf("jwt key %s: signing key must be a private key", path)
+		}
+		s.signing = k
+	} else {
+		// Verification keys never sign, even when the file holds the
+		// private key (the usual case for a key that was just retired).
+		k.sign = nil
+	}
+	if _, dup := s.byID[k.ID]; !dup {
+		s.byID[k.ID] = k
+		s.keys = append(s.keys, k)
+	}
+	return nil
+}
+
+func loadKey(path string) (*Key, error) {
+	data, err := os.ReadFile(strings.TrimSpace(path))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newKey(parsed)
+}
+
+// newKey wraps a parsed private or public key.
+func newKey(parsed interface{}) (*Key, error) {
+	k := &Key{}
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.Alg, k.sign, k.verify = RS256, key, &key.PublicKey
+	case *rsa.PublicKey:
+		k.Alg, k.verify = RS256, key
+	case *ecdsa.PrivateKey:
+		k.Alg, k.sign, k.verify = ES256, key, &key.PublicKey
+	case *ecdsa.PublicKey:
+		k.Alg, k.verify = ES256, key
+	case ed25519.PrivateKey:
+		k.Alg, k.sign, k.verify = EdDSA, key, key.Public().(ed25519.PublicKey)
+	case ed25519.PublicKey:
+		k.Alg, k.verify = EdDSA, key
+	default:
+		return nil, fmt.Errorf("unsupported key type %T (use RSA, P-256 or Ed25519)", parsed)
+	}
+	if pub, ok := k.verify.(*rsa.PublicKey); ok && pub.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA key has %d bits, need at least %d", pub.N.BitLen(), minRSABits)
+	}
+	if pub, ok := k.verify.(*ecdsa.PublicKey); ok && pub.Curve != elliptic.P256() {
+		return nil, errors.New("only P-256 EC keys are supported")
+	}
+	k.ID = thumbprint(toJWK(k))
+	return k, nil
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
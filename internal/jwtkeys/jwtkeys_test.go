@@ -0,0 +1,152 @@
+package jwtkeys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func claims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{Subject: "auth", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+}
+
+func verify(s *Set, raw string) error {
+	_, err := jwt.Parse(raw, s.Keyfunc, jwt.WithValidMethods(s.Methods()))
+	return err
+}
+
+// writeKey stores key as a PKCS#8 PEM file and returns its path.
+func writeKey(t *testing.T, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRotationKeepsOldTokensValid(t *testing.T) {
+	_, oldKey, _ := ed25519.GenerateKey(rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	oldSet, err := New(Config{SigningKeyFile: writeKey(t, oldKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, _ := oldSet.Sign(claims())
+
+	rotated, err := New(Config{SigningKeyFile: writeKey(t, newKey), VerifyKeyFiles: []string{writeKey(t, oldKey)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Alg() != ES256 {
+		t.Fatalf("signing alg = %s, want ES256", rotated.Alg())
+	}
+	newToken, _ := rotated.Sign(claims())
+	for name, tok := range map[string]string{"old": oldToken, "new": newToken} {
+		if err := verify(rotated, tok); err != nil {
+			t.Errorf("%s token: %v", name, err)
+		}
+	}
+	if err := verify(oldSet, newToken); err == nil {
+		t.Error("old set accepted a token from the new key")
+	}
+	if len(rotated.JWKS().Keys) != 2 {
+		t.Errorf("JWKS has %d keys, want 2", len(rotated.JWKS().Keys))
+	}
+}
+
+func TestKeyfuncRejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	s, err := FromPrivateKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := s.signing.ID
+
+	// HS256 "signed" with the public key, naming the RSA kid.
+	pubDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	forged.Header["kid"] = kid
+	raw, _ := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	if err := verify(s, raw); err == nil {
+		t.Fatal("HS256 token accepted with an RSA kid")
+	}
+	if _, err := s.Keyfunc(forged); !errors.Is(err, ErrAlgMismatch) {
+		t.Fatalf("Keyfunc: err = %v, want ErrAlgMismatch", err)
+	}
+
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, claims())
+	none.Header["kid"] = kid
+	raw, _ = none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err := verify(s, raw); err == nil {
+		t.Fatal("alg none accepted")
+	}
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodRS256, claims())
+	unknown.Header["kid"] = "not-a-key"
+	raw, _ = unknown.SignedString(rsaKey)
+	if err := verify(s, raw); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("unknown kid: err = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestHMACSecretIsNeverPublishedOrTrustedWithoutKid(t *testing.T) {
+	hmacSet := NewHMAC("secret")
+	if len(hmacSet.JWKS().Keys) != 0 {
+		t.Fatal("HS256 secret published in JWKS")
+	}
+	raw, _ := hmacSet.Sign(claims())
+	if err := verify(hmacSet, raw); err != nil {
+		t.Fatalf("HS256 token: %v", err)
+	}
+
+	// Once an asymmetric key signs, a kid-less HS256 token is refused.
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	s, _ := FromPrivateKey(edKey)
+	if err := verify(s, raw); err == nil {
+		t.Fatal("HS256 token accepted by an EdDSA set")
+	}
+}
+
+func TestParseJWKSVerifiesPublishedKeys(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	s, _ := FromPrivateKey(edKey)
+	raw, _ := s.Sign(claims())
+
+	doc, _ := json.Marshal(s.JWKS())
+	remote, err := ParseJWKS(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(remote, raw); err != nil {
+		t.Fatalf("verify with parsed JWKS: %v", err)
+	}
+	if _, err := remote.Sign(claims()); !errors.Is(err, ErrNoSigningKey) {
+		t.Fatalf("parsed JWKS signed a token: %v", err)
+	}
+
+	// A key published for one algorithm cannot be used for another.
+	var bad JWKS
+	json.Unmarshal(doc, &bad)
+	bad.Keys[0].Alg = RS256
+	doc, _ = json.Marshal(bad)
+	if _, err := ParseJWKS(doc); err == nil {
+		t.Fatal("JWKS with a mislabelled key accepted")
+	}
+}
@@ -0,0 +1,151 @@
+// Package mail sends transactional email. Everything goes through the Mailer
+// interface so the SMTP server can be swapped for a directory of .eml files
+// or the log in development.
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(m Message) error
+}
+
+// Config selects and configures a Mailer.
+type Config struct {
+	Driver   string // smtp | file | log
+	From     string
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Dir      string // file driver
+}
+
+// New returns the Mailer for cfg.Driver. An empty driver logs.
+func New(cfg Config) (Mailer, error) {
+	switch cfg.Driver {
+	case "", "log":
+		return LogMailer{From: cfg.From}, nil
+	case "file":
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("mail: file driver needs a directory")
+		}
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return nil, err
+		}
+		return &FileMailer{Dir: cfg.Dir, From: cfg.From}, nil
+	case "smtp":
+		if cfg.Host == "" {
+			return nil, fmt.Errorf("mail: smtp driver needs a host")
+		}
+		if _, err := netmail.ParseAddress(cfg.From); err != nil {
+			return nil, fmt.Errorf("mail: invalid sender %q: %v", cfg.From, err)
+		}
+		return &SMTPMailer{Host: cfg.Host, Port: cfg.Port, Username: cfg.Username, Password: cfg.Password, From: cfg.From}, nil
+	}
+	return nil, fmt.Errorf("mail: unknown driver %q", cfg.Driver)
+}
+
+// SMTPMailer sends through an SMTP server, using STARTTLS when the server
+// offers it and PLAIN auth when a username is set. From may carry a display
+// name ("EPL Stats <no-reply@example.com>"); only the bare address is used
+// as the envelope sender.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPMailer) Send(m Message) error {
+	port := s.Port
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	from, err := netmail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("mail: invalid sender %q: %v", s.From, err)
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(port))
+	return smtp.SendMail(addr, auth, from.Address, []string{m.To}, render(s.From, m))
+}
+
+// FileMailer writes each message to its own .eml file in Dir, for tests and
+// local development.
+type FileMailer struct {
+	Dir  string
+	From string
+
+	seq uint64
+}
+
+func (f *FileMailer) Send(m Message) error {
+	n := atomic.AddUint64(&f.seq, 1)
+	name := fmt.Sprintf("%s-%04d-%s.eml", time.Now().UTC().Format("20060102T150405"), n, sanitize(m.To))
+	return os.WriteFile(filepath.Join(f.Dir, name), render(f.From, m), 0o600)
+}
+
+// LogMailer prints messages to the log instead of sending them.
+type LogMailer struct {
+	From string
+}
+
+func (l LogMailer) Send(m Message) error {
+	log.Printf("mail: to=%s subject=%q\n%s", m.To, m.Subject, m.Body)
+	return nil
+}
+
+// render builds an RFC 5322 message. Header values come from our own
+// templates and addresses, but CR/LF is stripped anyway so a crafted name or
+// address cannot inject headers.
+func render(from string, m Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", oneLine(from))
+	fmt.Fprintf(&b, "To: %s\r\n", oneLine(m.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", oneLine(m.Subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -1,10 +1,15 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
+	"project/internal/jwtkeys"
+	"project/internal/rbac"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -12,85 +17,157 @@ import (
 type Claims struct {
 	UserID uint   `json:"uid"`
 	Role   string `json:"role"`
+	// SessionID ties the token to a server-side session so it can be
+	// revoked before it expires.
+	SessionID uint `json:"sid,omitempty"`
+	// MFA is set when the session was opened with a second factor.
+	MFA bool `json:"mfa,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(secret string, uid uint, role string, ttl time.Duration) (string, error) {
+// SessionChecker reports whether a session is still active.
+type SessionChecker func(sessionID uint) bool
+
+// GenerateToken signs an access token with the current key.
+func GenerateToken(keys *jwtkeys.Set, uid, sid uint, role string, mfa bool, ttl time.Duration) (string, error) {
 	claims := &Claims{
-		UserID: uid,
-		Role:   role,
+		UserID:    uid,
+		Role:      role,
+		SessionID: sid,
+		MFA:       mfa,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Subject:   "auth",
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return keys.Sign(claims)
+}
+
+// ParseToken validates a raw JWT against the key named in its kid header
+// and returns its claims.
+func ParseToken(keys *jwtkeys.Set, raw string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(raw, claims, keys.Keyfunc,
+		jwt.WithValidMethods(keys.Methods()), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
 }
 
-func Auth(secret string) gin.HandlerFunc {
+// Cookie names. The access token cookie is sent with every request; the
+// refresh cookie only to /api/auth.
+const (
+	AccessCookie  = "auth_token"
+	RefreshCookie = "refresh_token"
+)
+
+var (
+	ErrMissingToken   = errors.New("missing token")
+	ErrInvalidToken   = errors.New("invalid token")
+	ErrSessionRevoked = errors.New("session revoked")
+)
+
+// TokenFromRequest returns the access token from the Authorization header
+// or, failing that, the access cookie. fromCookie tells the caller the
+// browser attached it on its own, which is what CSRF protection is about.
+func TokenFromRequest(c *gin.Context) (raw string, fromCookie bool) {
+	if h := c.GetHeader("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer "), false
+	}
+	if raw, _ = c.Cookie(AccessCookie); raw != "" {
+		return raw, true
+	}
+	return "", false
+}
+
+// Authenticate validates the request's access token (header or cookie) and,
+// when active is set, its session, and stores the claims on the context
+// ("uid", "role", "sid", "mfa"). Both the API and page guards use it.
+func Authenticate(c *gin.Context, keys *jwtkeys.Set, active SessionChecker) (claims *Claims, fromCookie bool, err error) {
+	raw, fromCookie := TokenFromRequest(c)
+	if raw == "" {
+		return nil, false, ErrMissingToken
+	}
+	claims, err = ParseToken(keys, raw)
+	if err != nil {
+		return nil, fromCookie, ErrInvalidToken
+	}
+	if active != nil && (claims.SessionID == 0 || !active(claims.SessionID)) {
+		return nil, fromCookie, ErrSessionRevoked
+	}
+	c.Set("uid", claims.UserID)
+	c.Set("role", claims.Role)
+	c.Set("sid", claims.SessionID)
+	c.Set("mfa", claims.MFA)
+	return claims, fromCookie, nil
+}
+
+// Auth guards API routes. It accepts a bearer token or the access cookie;
+// cookie-authenticated requests that change state must also pass the CSRF
+// check. When active is set, the token's session must also still be
+// active, so logging out or revoking a session takes effect immediately
+// instead of when the token expires.
+func Auth(keys *jwtkeys.Set, active SessionChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		h := c.GetHeader("Authorization")
-		if h == "" || !strings.HasPrefix(h, "Bearer ") {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+		_, fromCookie, err := Authenticate(c, keys, active)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
-		raw := strings.TrimPrefix(h, "Bearer ")
-		claims := &Claims{}
-		_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		})
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		if fromCookie && !CheckCSRF(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrCSRF.Error()})
 			return
 		}
-		c.Set("uid", claims.UserID)
-		c.Set("role", claims.Role)
 		c.Next()
 	}
 }
 
-func RequireAdmin() gin.HandlerFunc {
+// RequirePermission lets users through whose role grants any of perms.
+func RequirePermission(perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, p := range perms {
+			if Can(c, p) {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing permission " + strings.Join(perms, " or ")})
+	}
+}
+
+// Can reports whether the authenticated user's role grants perm.
+func Can(c *gin.Context, perm string) bool {
+	role, _ := c.Get("role")
+	r, _ := role.(string)
+	return rbac.Can(r, perm)
+}
+
+// RequireAdminTwoFactor, when required is set, turns away admins whose
+// access token did not come from a two-factor sign-in. Other roles pass.
+func RequireAdminTwoFactor(required bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role, _ := c.Get("role")
-		if role != "admin" {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		if mfa, _ := c.Get("mfa"); required && role == rbac.Admin && mfa != true {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "two-factor authentication is required for admin access", "twoFactorRequired": true})
 			return
 		}
 		c.Next()
 	}
 }
 
-// AuthHTML checks for JWT token in cookie and validates it
-func AuthHTML(secret string) gin.HandlerFunc {
+// AuthHTML guards HTML pages with the same checks as Auth. Visitors
+// without a valid session are sent to /auth?next=<page>, which brings them
+// back after signing in (or after refreshing an expired access cookie).
+func AuthHTML(keys *jwtkeys.Set, active SessionChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Check for token in cookie first
-		token, err := c.Cookie("auth_token")
-		if err != nil || token == "" {
-			// Check Authorization header as fallback
-			h := c.GetHeader("Authorization")
-			if h != "" && strings.HasPrefix(h, "Bearer ") {
-				token = strings.TrimPrefix(h, "Bearer ")
-			} else {
-				// No token found, redirect to auth page
-				c.Redirect(http.StatusFound, "/auth")
-				c.Abort()
-				return
-			}
-		}
-		
-		claims := &Claims{}
-		_, err = jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		})
-		if err != nil {
-			c.Redirect(http.StatusFound, "/auth")
+		if _, _, err := Authenticate(c, keys, active); err != nil {
+			c.Header("Cache-Control", "no-store")
+			c.Redirect(http.StatusFound, "/auth?next="+url.QueryEscape(c.Request.URL.RequestURI()))
 			c.Abort()
 			return
 		}
-		c.Set("uid", claims.UserID)
-		c.Set("role", claims.Role)
 		c.Next()
 	}
 }
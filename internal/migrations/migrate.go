@@ -1,11 +1,14 @@
 package migrations
 
 import (
+	"log"
+	"strings"
 	"time"
 
 	"project/internal/config"
 	"project/internal/database"
 	"project/internal/models"
+	"project/internal/rbac"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -16,11 +19,42 @@ func AutoMigrateAndSeed(cfg config.Config) error {
 	if db == nil {
 		return gorm.ErrInvalidDB
 	}
-	if err := db.AutoMigrate(&models.User{}, &models.Team{}, &models.Player{}, &models.PlayerStat{}, &models.Match{}); err != nil {
+	// Accounts created before email verification existed are treated as
+	// verified rather than locked out of commenting.
+	grandfather := db.Migrator().HasTable(&models.User{}) && !db.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+	// Matches finished before FinishedAt existed take their last update.
+	backfillFinished := db.Migrator().HasTable(&models.Match{}) && !db.Migrator().HasColumn(&models.Match{}, "FinishedAt")
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Team{},
+		&models.Player{},
+		&models.PlayerStat{},
+		&models.Match{},
+		&models.MatchEvent{},
+		&models.Thread{},
+		&models.Comment{},
+		&models.CommentVote{},
+		&models.CommentReport{},
+		&models.PostingBan{},
+		&models.ModerationAction{},
+		&models.CalendarFeed{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.UserToken{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+	); err != nil {
 		return err
 	}
+	if grandfather {
+		db.Model(&models.User{}).Where("email_verified_at IS NULL").Update("email_verified_at", gorm.Expr("created_at"))
+	}
+	if backfillFinished {
+		db.Model(&models.Match{}).Where("status = ?", "finished").UpdateColumn("finished_at", gorm.Expr("updated_at"))
+	}
 	seedTop6(db)
-	ensureAdmin(db, cfg.AdminEmail)
+	lockLegacyAdmin(db)
+	ensureAdmin(db, cfg.AdminEmail, cfg.AdminPassword)
 	seedMatches(db)
 	return nil
 }
@@ -44,18 +78,64 @@ func seedTop6(db *gorm.DB) {
 	}
 }
 
-func ensureAdmin(db *gorm.DB, email string) {
+// LegacyAdminEmail is the admin that older versions seeded with a password
+// written in the source code.
+const LegacyAdminEmail = "zhalgasandalisher@gmail.com"
+
+const legacyAdminPassword = "UnitedNom1!"
+
+// lockLegacyAdmin clears the published password of the admin older versions
+// seeded and signs it out everywhere. The startup bootstrap link (or a
+// password reset) sets a new one.
+func lockLegacyAdmin(db *gorm.DB) {
 	var u models.User
-	if err := db.Where("email = ?", email).First(&u).Error; err == nil {
+	if err := db.Where("email = ?", LegacyAdminEmail).First(&u).Error; err != nil || u.PasswordHash == "" {
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(legacyAdminPassword)) != nil {
+		return
+	}
+	now := time.Now()
+	if err := db.Model(&u).Update("password_hash", "").Error; err != nil {
+		log.Printf("migrate: clearing the default password of %s: %v", u.Email, err)
 		return
 	}
-	// Default admin credentials: zhalgasandalisher@gmail.com / UnitedNom1!
-	pw, _ := bcrypt.GenerateFromPassword([]byte("UnitedNom1!"), bcrypt.DefaultCost)
+	db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", u.ID).
+		Updates(map[string]interface{}{"revoked_at": now, "revoked_reason": "password_reset"})
+	log.Printf("migrate: %s still had the published default password; it has been cleared", u.Email)
+}
+
+// ensureAdmin creates the first admin when the database has none. The
+// password comes from ADMIN_PASSWORD; without it the account starts with no
+// password and the server logs a one-time link to set one (see
+// AuthService.BootstrapAdmin). Existing admins are never touched.
+func ensureAdmin(db *gorm.DB, email, password string) {
+	var n int64
+	db.Model(&models.User{}).Where("role = ?", rbac.Admin).Count(&n)
+	if n > 0 {
+		return
+	}
+	email = strings.TrimSpace(strings.ToLower(email))
+	var existing models.User
+	if err := db.Where("email = ?", email).First(&existing).Error; err == nil {
+		log.Printf("migrate: %s already has a non-admin account, so no admin was created; promote an account with the database or choose another ADMIN_EMAIL", email)
+		return
+	}
+	now := time.Now()
 	admin := models.User{
-		Name:         "Admin",
-		Email:        "zhalgasandalisher@gmail.com",
-		PasswordHash: string(pw),
-		Role:         "admin",
+		Name:            "Admin",
+		Email:           email,
+		Role:            rbac.Admin,
+		EmailVerifiedAt: &now,
+	}
+	if password != "" {
+		pw, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			log.Printf("migrate: hashing ADMIN_PASSWORD: %v", err)
+			return
+		}
+		admin.PasswordHash = string(pw)
 	}
 	db.Create(&admin)
 }
@@ -1,59 +1,311 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
 	Name           string `gorm:"size:100"`
 	Email          string `gorm:"size:180;uniqueIndex"`
-	PasswordHash   string `gorm:"size:255"`
-	Role           string `gorm:"size:20;default:user"`
+	PasswordHash   string `gorm:"size:255" json:"-"`
+	Role           string `gorm:"size:20;default:user"` // see internal/rbac
 	FavoriteTeamID *uint
 	FavoriteTeam   *Team
+	// ClubTeamID is the team a club_official represents; they may edit
+	// only that team's players.
+	ClubTeamID *uint
+	// EmailVerifiedAt is set once the user follows the link in the
+	// verification email. Unverified users cannot comment.
+	EmailVerifiedAt *time.Time
+	// TOTPSecret is the enrolled authenticator secret; TOTPPendingSecret
+	// holds a new one until the first code confirms it. TOTPLastStep is the
+	// last accepted time step, so each code works once.
+	TOTPSecret        string `gorm:"size:64" json:"-"`
+	TOTPPendingSecret string `gorm:"size:64" json:"-"`
+	TOTPEnabledAt     *time.Time
+	TOTPLastStep      int64 `json:"-"`
+	// SuspendedAt blocks sign-in until an admin lifts the suspension;
+	// suspending also revokes every session.
+	SuspendedAt     *time.Time
+	SuspendedReason string `gorm:"size:255"`
+	// InvitedByID is the admin who invited the account by email.
+	InvitedByID *uint
 }
 
 type Team struct {
 	gorm.Model
-	Name          string `gorm:"size:100;uniqueIndex"`
-	ShortName     string `gorm:"size:20"`
-	LogoURL       string `gorm:"size:255"`
-	PrimaryColor  string `gorm:"size:20"`
+	Name           string `gorm:"size:100;uniqueIndex"`
+	ShortName      string `gorm:"size:20"`
+	LogoURL        string `gorm:"size:255"`
+	PrimaryColor   string `gorm:"size:20"`
 	SecondaryColor string `gorm:"size:20"`
-	Points        int  `gorm:"default:0"`
-	MatchesPlayed int  `gorm:"default:0"`
-	GoalDiff      int  `gorm:"default:0"`
-	Players       []Player
+	Points         int    `gorm:"default:0"`
+	MatchesPlayed  int    `gorm:"default:0"`
+	GoalDiff       int    `gorm:"default:0"`
+	Players        []Player
 }
 
 type Player struct {
 	gorm.Model
-	Name    string `gorm:"size:120"`
-	TeamID  uint
-	Team    Team
+	Name     string `gorm:"size:120"`
+	TeamID   uint
+	Team     Team
 	Position string `gorm:"size:30"`
-	Stats   []PlayerStat
+	Stats    []PlayerStat
 }
 
 type PlayerStat struct {
 	gorm.Model
-	PlayerID     uint
-	Player       Player
-	Season       string `gorm:"size:10"`
-	Goals        int    `gorm:"default:0"`
-	Assists      int    `gorm:"default:0"`
-	CleanSheets  int    `gorm:"default:0"`
-	MinutesPlayed int   `gorm:"default:0"`
+	PlayerID      uint
+	Player        Player
+	Season        string `gorm:"size:10"`
+	Goals         int    `gorm:"default:0"`
+	Assists       int    `gorm:"default:0"`
+	CleanSheets   int    `gorm:"default:0"`
+	MinutesPlayed int    `gorm:"default:0"`
 }
 
 type Match struct {
 	gorm.Model
-	HomeTeamID uint
-	AwayTeamID uint
-	HomeTeam   Team
-	AwayTeam   Team
-	HomeScore  *int
-	AwayScore  *int
-	Date       int64
-	Stadium    string `gorm:"size:120"`
-	Status     string `gorm:"size:20"` // upcoming | finished | live
+	HomeTeamID  uint
+	AwayTeamID  uint
+	HomeTeam    Team
+	AwayTeam    Team
+	HomeScore   *int
+	AwayScore   *int
+	Date        int64
+	Stadium     string `gorm:"size:120"`
+	Status      string `gorm:"size:20"` // upcoming | finished | live
+	Competition string `gorm:"size:60;default:Premier League"`
+	// FinishedAt is when the match went to full time. Later score
+	// corrections leave it alone, unlike UpdatedAt.
+	FinishedAt *time.Time
+}
+
+// MatchEvent types.
+const (
+	EventGoal         = "goal"
+	EventOwnGoal      = "own_goal"
+	EventYellowCard   = "yellow_card"
+	EventRedCard      = "red_card"
+	EventSubstitution = "substitution"
+	EventVAR          = "var"
+	EventPeriod       = "period"
+)
+
+// Period markers carried in MatchEvent.Detail for EventPeriod.
+const (
+	PeriodKickOff    = "kick_off"
+	PeriodHalfTime   = "half_time"
+	PeriodSecondHalf = "second_half"
+	PeriodFullTime   = "full_time"
+)
+
+// MatchEvent is one entry in a match timeline. TeamID is the side the event
+// belongs to (for an own goal, the scorer's side). RelatedPlayerID is the
+// assist provider on a goal or the player going off on a substitution.
+// A VAR event with ReversesEventID set cancels that earlier event.
+type MatchEvent struct {
+	gorm.Model
+	MatchID         uint   `gorm:"index"`
+	Type            string `gorm:"size:20"`
+	Minute          int
+	ExtraMinute     int
+	TeamID          *uint
+	PlayerID        *uint
+	Player          *Player
+	RelatedPlayerID *uint
+	RelatedPlayer   *Player
+	ReversesEventID *uint
+	Detail          string `gorm:"size:255"`
+}
+
+// Thread kinds. Pre-match, match and post-match threads are created
+// automatically, at most one of each per match.
+const (
+	ThreadDiscussion = "discussion"
+	ThreadPreMatch   = "pre_match"
+	ThreadMatch      = "match"
+	ThreadPostMatch  = "post_match"
+)
+
+// Thread is a discussion attached to a match.
+type Thread struct {
+	gorm.Model
+	MatchID  uint `gorm:"index"`
+	Match    Match
+	Kind     string `gorm:"size:20;default:discussion"`
+	Title    string `gorm:"size:200"`
+	Body     string `gorm:"type:text"`
+	Views    int64  `gorm:"default:0"`
+	Comments []Comment
+}
+
+// Comment is a post in a thread. Replies point at their parent; Depth is 0
+// for top-level comments. Upvotes/Downvotes mirror the CommentVote rows.
+// A comment removed by a moderator keeps its row so replies stay attached;
+// RemovedAt is set and the message is hidden from listings. Held comments
+// were flagged by the content filter and stay hidden until a moderator
+// approves them.
+type Comment struct {
+	gorm.Model
+	ThreadID      uint  `gorm:"index"`
+	ParentID      *uint `gorm:"index"`
+	Depth         int   `gorm:"default:0"`
+	UserID        uint  `gorm:"index"`
+	User          User
+	Message       string `gorm:"type:text"`
+	Upvotes       int    `gorm:"default:0"`
+	Downvotes     int    `gorm:"default:0"`
+	RemovedAt     *time.Time
+	RemovedByID   *uint
+	RemovalReason string `gorm:"size:255"`
+	Held          bool   `gorm:"default:false;index"`
+	HeldReason    string `gorm:"size:255"`
+}
+
+// CommentVote is one user's vote on a comment: +1 or -1.
+type CommentVote struct {
+	gorm.Model
+	CommentID uint `gorm:"uniqueIndex:idx_comment_vote_user"`
+	UserID    uint `gorm:"uniqueIndex:idx_comment_vote_user"`
+	Value     int
+}
+
+// CommentReport statuses.
+const (
+	ReportOpen      = "open"
+	ReportActioned  = "actioned"
+	ReportDismissed = "dismissed"
+)
+
+// CommentReport is a user's report of a comment. Each user can report a
+// comment once; the report stays open until a moderator acts on it.
+type CommentReport struct {
+	gorm.Model
+	CommentID  uint `gorm:"uniqueIndex:idx_comment_report_user"`
+	Comment    Comment
+	ReporterID uint   `gorm:"uniqueIndex:idx_comment_report_user"`
+	Reason     string `gorm:"size:255"`
+	Status     string `gorm:"size:20;default:open;index"`
+	ResolvedBy *uint
+	ResolvedAt *time.Time
+}
+
+// PostingBan stops a user from commenting until ExpiresAt. Lifting a ban
+// early sets LiftedAt rather than deleting it, so the history is kept.
+type PostingBan struct {
+	gorm.Model
+	UserID    uint `gorm:"index"`
+	IssuedBy  uint
+	Reason    string `gorm:"size:255"`
+	ExpiresAt time.Time
+	LiftedAt  *time.Time
+}
+
+// Moderation actions recorded in the audit log.
+const (
+	ModRemoveComment  = "remove_comment"
+	ModRestoreComment = "restore_comment"
+	ModDismissReports = "dismiss_reports"
+	ModApproveComment = "approve_comment"
+	ModBanUser        = "ban_user"
+	ModUnbanUser      = "unban_user"
+	ModChangeRole     = "change_role"
+	ModSuspendUser    = "suspend_user"
+	ModUnsuspendUser  = "unsuspend_user"
+	ModForceReset     = "force_password_reset"
+	ModDeleteUser     = "delete_user"
+	ModInviteUser     = "invite_user"
+	// ModLoginLockout is written by the system (moderator 0) when repeated
+	// failed logins lock an account or IP.
+	ModLoginLockout = "login_lockout"
+)
+
+// ModerationAction is an append-only audit entry for something a moderator
+// or admin did. TargetType is "comment" or "user".
+type ModerationAction struct {
+	gorm.Model
+	ModeratorID uint   `gorm:"index"`
+	Action      string `gorm:"size:40;index"`
+	TargetType  string `gorm:"size:20"`
+	TargetID    uint   `gorm:"index"`
+	Reason      string `gorm:"size:255"`
+	Detail      string `gorm:"size:255"`
+}
+
+// Session is one signed-in device. Access tokens carry its ID, so revoking
+// the session cuts them off before they expire. ExpiresAt slides forward
+// every time the session's refresh token is rotated.
+type Session struct {
+	gorm.Model
+	UserID        uint   `gorm:"index"`
+	UserAgent     string `gorm:"size:255"`
+	IP            string `gorm:"size:64"`
+	LastUsedAt    time.Time
+	ExpiresAt     time.Time
+	RevokedAt     *time.Time
+	RevokedReason string `gorm:"size:40"`
+	// TwoFactor is set when the session was opened, or later confirmed,
+	// with a second factor.
+	TwoFactor bool
+}
+
+// RefreshToken is one link in a session's rotation chain. Only the SHA-256
+// of the token is stored. A token is single use: UsedAt is set when it is
+// exchanged, and presenting it again revokes the whole session.
+type RefreshToken struct {
+	gorm.Model
+	SessionID uint   `gorm:"index"`
+	TokenHash string `gorm:"size:64;uniqueIndex"`
+	UsedAt    *time.Time
+	ExpiresAt time.Time
+}
+
+// RecoveryCode is a single-use 2FA backup code; only its SHA-256 is kept.
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"index"`
+	CodeHash string `gorm:"size:64;index"`
+	UsedAt   *time.Time
+}
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// provider; Provider and Subject name that account.
+type UserIdentity struct {
+	gorm.Model
+	UserID      uint   `gorm:"index"`
+	Provider    string `gorm:"size:40;uniqueIndex:idx_identity_subject"`
+	Subject     string `gorm:"size:255;uniqueIndex:idx_identity_subject"`
+	Email       string `gorm:"size:180"`
+	LastLoginAt time.Time
+}
+
+// UserToken backs a signed, single-use link sent by email (password reset,
+// email verification, admin invite). The link carries the row ID, purpose and expiry under
+// an HMAC; the row makes it single use.
+type UserToken struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	Purpose   string `gorm:"size:20;index"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// CalendarFeed is a user's secret webcal subscription. The token is the only
+// credential, so it is never serialised and rotating it revokes old URLs.
+type CalendarFeed struct {
+	gorm.Model
+	UserID uint `gorm:"uniqueIndex"`
+	// TokenHash is the SHA-256 of the secret in the feed URL, empty while
+	// the feed is revoked. Token holds the secret itself only right after
+	// it is issued; it is never stored.
+	TokenHash       string `gorm:"size:64;index" json:"-"`
+	Token           string `gorm:"-" json:"-"`
+	IncludeFavorite bool   `gorm:"default:true"`
+	Teams           []Team `gorm:"many2many:calendar_feed_teams"`
+	Competitions    string `gorm:"size:255"` // JSON array (comma-separated in older rows); empty means all
 }
@@ -0,0 +1,294 @@
+package oidc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"project/internal/jwtkeys"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Mock is a minimal OpenID Connect provider for development and tests. It
+// serves discovery, authorize, token, userinfo and JWKS under its issuer
+// URL, signs ID tokens with a fresh Ed25519 key and enforces S256 PKCE.
+// The authorize page lets you type any email; adding login_hint (and
+// optionally name and email_verified=false) to the authorize URL skips the
+// page, which is how scripts drive it.
+type Mock struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	keys *jwtkeys.Set
+
+	mu     sync.Mutex
+	codes  map[string]mockGrant
+	tokens map[string]mockGrant
+}
+
+type mockGrant struct {
+	ClientID    string
+	RedirectURI string
+	Challenge   string
+	Nonce       string
+	Email       string
+	Name        string
+	Verified    bool
+	Expires     time.Time
+}
+
+const mockCodeTTL = time.Minute
+
+// NewMock returns a provider at issuer (the full URL it is mounted at, e.g.
+// http://localhost:8080/oidc-mock) that accepts one client.
+func NewMock(issuer, clientID, clientSecret string) (*Mock, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := jwtkeys.FromPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return &Mock{
+		Issuer:       strings.TrimRight(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		keys:         keys,
+		codes:        make(map[string]mockGrant),
+		tokens:       make(map[string]mockGrant),
+	}, nil
+}
+
+// HTTPClient talks to the mock without going through the network, so the
+// server can reach its own mock whatever address it listens on.
+func (m *Mock) HTTPClient() *http.Client {
+	return &http.Client{Transport: mockTransport{m}, Timeout: 10 * time.Second}
+}
+
+type mockTransport struct{ m *Mock }
+
+func (t mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.m.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
+
+func (m *Mock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Path
+	switch {
+	case strings.HasSuffix(p, "/.well-known/openid-configuration"):
+		m.discovery(w)
+	case strings.HasSuffix(p, "/authorize"):
+		m.authorize(w, r)
+	case strings.HasSuffix(p, "/token"):
+		m.token(w, r)
+	case strings.HasSuffix(p, "/userinfo"):
+		m.userinfo(w, r)
+	case strings.HasSuffix(p, "/jwks"):
+		writeJSON(w, http.StatusOK, m.keys.JWKS())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *Mock) discovery(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                m.Issuer,
+		"authorization_endpoint":                m.Issuer + "/authorize",
+		"token_endpoint":                        m.Issuer + "/token",
+		"userinfo_endpoint":                     m.Issuer + "/userinfo",
+		"jwks_uri":                              m.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{jwtkeys.EdDSA},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+var mockPage = template.Must(template.New("mock").Parse(`<!doctype html>
+<html><head><title>Mock identity provider</title></head>
+<body style="font-family:sans-serif;max-width:28em;margin:4em auto">
+<h1>Mock identity provider</h1>
+<p>Development sign-in for <b>{{.ClientID}}</b>. Nothing is checked: pick who you want to be.</p>
+<form method="get">
+{{range $k, $v := .Params}}<input type="hidden" name="{{$k}}" value="{{$v}}">
+{{end}}<p><label>Email<br><input name="login_hint" type="email" required></label></p>
+<p><label>Name<br><input name="name"></label></p>
+<p><label><input type="checkbox" name="email_verified" value="true" checked> Email verified</label>
+<input type="hidden" name="email_verified" value="false"></p>
+<p><button type="submit">Sign in</button></p>
+</form></body></html>`))
+
+func (m *Mock) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirect := q.Get("redirect_uri")
+	switch {
+	case q.Get("client_id") != m.ClientID:
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	case redirect == "":
+		http.Error(w, "redirect_uri is required", http.StatusBadRequest)
+		return
+	case q.Get("response_type") != "code":
+		http.Error(w, "only response_type=code is supported", http.StatusBadRequest)
+		return
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		http.Error(w, "PKCE with code_challenge_method=S256 is required", http.StatusBadRequest)
+		return
+	}
+	email := strings.TrimSpace(q.Get("login_hint"))
+	if email == "" {
+		params := map[string]string{}
+		for k := range q {
+			params[k] = q.Get(k)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		mockPage.Execute(w, map[string]interface{}{"ClientID": m.ClientID, "Params": params})
+		return
+	}
+	code := randomHex()
+	m.mu.Lock()
+	m.codes[code] = mockGrant{
+		ClientID:    m.ClientID,
+		RedirectURI: redirect,
+		Challenge:   q.Get("code_challenge"),
+		Nonce:       q.Get("nonce"),
+		Email:       email,
+		Name:        q.Get("name"),
+		Verified:    q.Get("email_verified") != "false",
+		Expires:     time.Now().Add(mockCodeTTL),
+	}
+	m.mu.Unlock()
+	back, err := url.Parse(redirect)
+	if err != nil {
+		http.Error(w, "bad redirect_uri", http.StatusBadRequest)
+		return
+	}
+	bq := back.Query()
+	bq.Set("code", code)
+	bq.Set("state", q.Get("state"))
+	back.RawQuery = bq.Encode()
+	http.Redirect(w, r, back.String(), http.StatusFound)
+}
+
+func (m *Mock) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != m.ClientID || subtle.ConstantTimeCompare([]byte(secret), []byte(m.ClientSecret)) != 1 {
+		tokenError(w, "invalid_client")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+	code := r.PostForm.Get("code")
+	m.mu.Lock()
+	g, found := m.codes[code]
+	delete(m.codes, code)
+	m.mu.Unlock()
+	if !found || time.Now().After(g.Expires) || g.RedirectURI != r.PostForm.Get("redirect_uri") ||
+		Challenge(r.PostForm.Get("code_verifier")) != g.Challenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            m.Issuer,
+		"aud":            m.ClientID,
+		"sub":            mockSubject(g.Email),
+		"email":          g.Email,
+		"email_verified": g.Verified,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+	if g.Nonce != "" {
+		claims["nonce"] = g.Nonce
+	}
+	if g.Name != "" {
+		claims["name"] = g.Name
+	}
+	idToken, err := m.keys.Sign(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	access := randomHex()
+	g.Expires = now.Add(time.Hour)
+	m.mu.Lock()
+	m.tokens[access] = g
+	m.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": access,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (m *Mock) userinfo(w http.ResponseWriter, r *http.Request) {
+	access := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	m.mu.Lock()
+	g, ok := m.tokens[access]
+	m.mu.Unlock()
+	if !ok || time.Now().After(g.Expires) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sub":            mockSubject(g.Email),
+		"email":          g.Email,
+		"email_verified": g.Verified,
+		"name":           g.Name,
+	})
+}
+
+// mockSubject keeps the subject stable per email, like a real provider's
+// account ID.
+func mockSubject(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return "mock-" + hex.EncodeToString(sum[:8])
+}
+
+func randomHex() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
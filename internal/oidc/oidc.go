@@ -0,0 +1,350 @@
+// Package oidc signs users in with an external OpenID Connect identity
+// provider using the authorization code flow with PKCE. Providers are
+// behind the Provider interface; Client is the generic implementation that
+// works with any standard issuer, and Mock is a small provider that runs
+// inside this server for development and end-to-end testing.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"project/internal/jwtkeys"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Identity is who the provider says signed in.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is an identity provider the login flow can send users to.
+type Provider interface {
+	// Name is the provider's URL segment, e.g. "google".
+	Name() string
+	DisplayName() string
+	// AuthCodeURL is where to send the browser. challenge is the S256 PKCE
+	// code challenge; state and nonce come back in the callback and the ID
+	// token.
+	AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error)
+	// Exchange redeems the code with the PKCE verifier and returns the
+	// verified identity. The ID token must carry nonce.
+	Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error)
+}
+
+var (
+	ErrExchange     = errors.New("identity provider rejected the sign-in")
+	ErrInvalidToken = errors.New("identity provider returned an invalid ID token")
+)
+
+// Config describes a provider. Endpoints left empty are read from the
+// issuer's /.well-known/openid-configuration on first use.
+type Config struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	JWKSURL      string
+}
+
+// Client is a Provider for any standard OpenID Connect issuer.
+type Client struct {
+	cfg  Config
+	http *http.Client
+
+	mu          sync.Mutex
+	discovered  bool
+	keys        *jwtkeys.Set
+	keysFetched time.Time
+}
+
+// jwksRefetchEvery limits how often an unknown kid triggers a JWKS fetch.
+const jwksRefetchEvery = time.Minute
+
+// NewClient returns a client for cfg. httpClient may be nil.
+func NewClient(cfg Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if cfg.DisplayName == "" {
+		cfg.DisplayName = cfg.Name
+	}
+	return &Client{cfg: cfg, http: httpClient}
+}
+
+func (c *Client) Name() string        { return c.cfg.Name }
+func (c *Client) DisplayName() string { return c.cfg.DisplayName }
+
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	if err := c.discover(ctx); err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.cfg.ClientID},
+		"redirect_uri":          {c.cfg.RedirectURL},
+		"scope":                 {strings.Join(c.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(c.cfg.AuthURL, "?") {
+		sep = "&"
+	}
+	return c.cfg.AuthURL + sep + q.Encode(), nil
+}
+
+func (c *Client) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	if err := c.discover(ctx); err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+	}
+	if err := c.doJSON(req, &tok); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if tok.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in response", ErrExchange)
+	}
+	claims, err := c.verifyIDToken(ctx, tok.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+	id := &Identity{
+		Provider:      c.cfg.Name,
+		Subject:       claims.Subject,
+		Email:         strings.TrimSpace(strings.ToLower(claims.Email)),
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}
+	if id.Email == "" && c.cfg.UserInfoURL != "" && tok.AccessToken != "" {
+		c.userInfo(ctx, tok.AccessToken, id)
+	}
+	return id, nil
+}
+
+// idClaims are the ID token claims the login flow uses.
+type idClaims struct {
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+	Nonce         string   `json:"nonce"`
+	AuthorizedBy  string   `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// flexBool accepts true and "true": some providers send email_verified as
+// a string.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	*b = flexBool(s == "true")
+	return nil
+}
+
+func (c *Client) verifyIDToken(ctx context.Context, raw, nonce string) (*idClaims, error) {
+	keys, err := c.keySet(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	claims := &idClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, keys.Keyfunc,
+		jwt.WithValidMethods(keys.Methods()),
+		jwt.WithIssuer(c.cfg.Issuer),
+		jwt.WithAudience(c.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedBy != c.cfg.ClientID {
+		return nil, fmt.Errorf("%w: token was issued to another client", ErrInvalidToken)
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// keySet returns the provider's keys, fetching them again when the token
+// names a kid the cached set does not have (the provider rotated).
+func (c *Client) keySet(ctx context.Context, raw string) (*jwtkeys.Set, error) {
+	kid := ""
+	if t, _, err := jwt.NewParser().ParseUnverified(raw, jwt.MapClaims{}); err == nil {
+		kid, _ = t.Header["kid"].(string)
+	}
+	c.mu.Lock()
+	keys, fetched := c.keys, c.keysFetched
+	c.mu.Unlock()
+	if keys != nil && (kid == "" || keys.Has(kid) || time.Since(fetched) < jwksRefetchEvery) {
+		return keys, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: fetching keys: %v", ErrInvalidToken, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: fetching keys: status %d", ErrInvalidToken, resp.StatusCode)
+	}
+	keys, err = jwtkeys.ParseJWKS(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	c.mu.Lock()
+	c.keys, c.keysFetched = keys, time.Now()
+	c.mu.Unlock()
+	return keys, nil
+}
+
+// userInfo fills in the email from the userinfo endpoint for providers that
+// leave it out of the ID token. The subject must match.
+func (c *Client) userInfo(ctx context.Context, accessToken string, id *Identity) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.UserInfoURL, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	var info struct {
+		Subject       string   `json:"sub"`
+		Email         string   `json:"email"`
+		EmailVerified flexBool `json:"email_verified"`
+		Name          string   `json:"name"`
+	}
+	if c.doJSON(req, &info) != nil || info.Subject != id.Subject {
+		return
+	}
+	id.Email = strings.TrimSpace(strings.ToLower(info.Email))
+	id.EmailVerified = bool(info.EmailVerified)
+	if id.Name == "" {
+		id.Name = info.Name
+	}
+}
+
+// discover fills in missing endpoints from the issuer's metadata. It is
+// retried on the next call after a failure.
+func (c *Client) discover(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.discovered {
+		return nil
+	}
+	if c.cfg.AuthURL == "" || c.cfg.TokenURL == "" || c.cfg.JWKSURL == "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+			strings.TrimRight(c.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+		if err != nil {
+			return err
+		}
+		var meta struct {
+			Issuer      string `json:"issuer"`
+			AuthURL     string `json:"authorization_endpoint"`
+			TokenURL    string `json:"token_endpoint"`
+			UserInfoURL string `json:"userinfo_endpoint"`
+			JWKSURL     string `json:"jwks_uri"`
+		}
+		if err := c.doJSON(req, &meta); err != nil {
+			return fmt.Errorf("oidc %s: discovery: %w", c.cfg.Name, err)
+		}
+		if meta.Issuer != c.cfg.Issuer {
+			return fmt.Errorf("oidc %s: discovery returned issuer %q", c.cfg.Name, meta.Issuer)
+		}
+		if c.cfg.AuthURL == "" {
+			c.cfg.AuthURL = meta.AuthURL
+		}
+		if c.cfg.TokenURL == "" {
+			c.cfg.TokenURL = meta.TokenURL
+		}
+		if c.cfg.UserInfoURL == "" {
+			c.cfg.UserInfoURL = meta.UserInfoURL
+		}
+		if c.cfg.JWKSURL == "" {
+			c.cfg.JWKSURL = meta.JWKSURL
+		}
+	}
+	c.discovered = true
+	return nil
+}
+
+func (c *Client) doJSON(req *http.Request, out interface{}) error {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: status %d: %s", req.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// RandomString returns n random bytes, base64url encoded; used for state,
+// nonce and PKCE verifiers.
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge is the S256 PKCE code challenge for verifier (RFC 7636).
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,88 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+const (
+	testIssuer   = "http://idp.test/oidc-mock"
+	testRedirect = "http://app.test/api/auth/oidc/mock/callback"
+)
+
+func newTestClient(t *testing.T) (*Mock, *Client) {
+	t.Helper()
+	m, err := NewMock(testIssuer, "app", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(Config{Name: "mock", Issuer: testIssuer, ClientID: "app", ClientSecret: "s3cret", RedirectURL: testRedirect}, m.HTTPClient())
+	return m, c
+}
+
+// authorize follows the authorize URL for email and returns the code the
+// provider sends back.
+func authorize(t *testing.T, m *Mock, authURL, email string) string {
+	t.Helper()
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	q.Set("login_hint", email)
+	u.RawQuery = q.Encode()
+	hc := m.HTTPClient()
+	hc.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := hc.Get(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, err := resp.Location()
+	if err != nil {
+		t.Fatalf("authorize: status %d, no redirect", resp.StatusCode)
+	}
+	return back.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	ctx := context.Background()
+	m, c := newTestClient(t)
+	verifier, _ := RandomString(32)
+
+	authURL, err := c.AuthCodeURL(ctx, "state", "nonce", Challenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := c.Exchange(ctx, authorize(t, m, authURL, "Fan@Example.com"), verifier, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Provider != "mock" || id.Subject == "" || id.Email != "fan@example.com" || !id.EmailVerified {
+		t.Fatalf("identity = %+v", id)
+	}
+
+	// Codes are single use.
+	code := authorize(t, m, authURL, "fan@example.com")
+	if _, err := c.Exchange(ctx, code, verifier, "nonce"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Exchange(ctx, code, verifier, "nonce"); !errors.Is(err, ErrExchange) {
+		t.Fatalf("replayed code: err = %v, want ErrExchange", err)
+	}
+}
+
+func TestExchangeRejectsWrongVerifierAndNonce(t *testing.T) {
+	ctx := context.Background()
+	m, c := newTestClient(t)
+	verifier, _ := RandomString(32)
+	authURL, _ := c.AuthCodeURL(ctx, "state", "nonce", Challenge(verifier))
+
+	other, _ := RandomString(32)
+	if _, err := c.Exchange(ctx, authorize(t, m, authURL, "fan@example.com"), other, "nonce"); !errors.Is(err, ErrExchange) {
+		t.Fatalf("wrong verifier: err = %v, want ErrExchange", err)
+	}
+	if _, err := c.Exchange(ctx, authorize(t, m, authURL, "fan@example.com"), verifier, "another"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("wrong nonce: err = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,73 @@
+// Package rbac maps user roles to the permissions that guard staff
+// endpoints. Roles are stored on the user and carried in the access token;
+// handlers and middleware ask for a permission, never for a role, so a new
+// role only needs an entry in the table below.
+package rbac
+
+import "sort"
+
+// Roles.
+const (
+	Admin        = "admin"
+	Editor       = "editor"
+	Moderator    = "moderator"
+	ClubOfficial = "club_official"
+	User         = "user"
+)
+
+// Permissions.
+const (
+	MatchResultWrite = "match.result.write" // set scores and status
+	MatchEventWrite  = "match.event.write"  // record goals, cards and substitutions
+	TeamWrite        = "team.write"
+	PlayerWrite      = "player.write"     // players of any team
+	PlayerWriteOwn   = "player.write.own" // players of the club the user represents
+	ThreadWrite      = "thread.write"     // open discussion threads
+	CommentModerate  = "comment.moderate" // review queue, remove/restore comments, moderation log
+	UserBan          = "user.ban"
+	ChatModerate     = "chat.moderate"
+	UserRoleWrite    = "user.role.write"
+	UserManage       = "user.manage" // list, suspend, reset, delete and invite accounts
+)
+
+var roles = map[string][]string{
+	Admin: {
+		MatchResultWrite, MatchEventWrite, TeamWrite, PlayerWrite, ThreadWrite,
+		CommentModerate, UserBan, ChatModerate, UserRoleWrite, UserManage,
+	},
+	Editor:       {MatchResultWrite, MatchEventWrite, TeamWrite, PlayerWrite, ThreadWrite},
+	Moderator:    {CommentModerate, UserBan, ChatModerate},
+	ClubOfficial: {PlayerWriteOwn},
+	User:         {},
+}
+
+// Valid reports whether role is known.
+func Valid(role string) bool {
+	_, ok := roles[role]
+	return ok
+}
+
+// Can reports whether role grants perm. Unknown roles grant nothing.
+func Can(role, perm string) bool {
+	for _, p := range roles[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions role grants.
+func Permissions(role string) []string {
+	return append([]string{}, roles[role]...)
+}
+
+// Roles returns every role name, sorted.
+func Roles() []string {
+	out := make([]string, 0, len(roles))
+	for r := range roles {
+		out = append(out, r)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,33 @@
+package rbac
+
+import "testing"
+
+func TestCan(t *testing.T) {
+	cases := []struct {
+		role, perm string
+		want       bool
+	}{
+		{Admin, UserRoleWrite, true},
+		{Editor, MatchResultWrite, true},
+		{Editor, UserBan, false},
+		{Moderator, CommentModerate, true},
+		{Moderator, PlayerWrite, false},
+		{ClubOfficial, PlayerWriteOwn, true},
+		{ClubOfficial, PlayerWrite, false},
+		{User, ThreadWrite, false},
+		{"root", UserManage, false},
+	}
+	for _, c := range cases {
+		if got := Can(c.role, c.perm); got != c.want {
+			t.Errorf("Can(%q, %q) = %v, want %v", c.role, c.perm, got, c.want)
+		}
+	}
+}
+
+func TestPermissionsReturnsACopy(t *testing.T) {
+	p := Permissions(Editor)
+	p[0] = UserRoleWrite
+	if Can(Editor, UserRoleWrite) {
+		t.Fatal("editing the result of Permissions changed the role table")
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"project/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// CalendarService manages per-user webcal subscriptions. Feeds are looked
+// up by an unguessable token instead of a JWT because calendar clients
+// cannot send Authorization headers. Only the token's hash is stored, so
+// the URL can be shown once, when it is issued.
+type CalendarService struct{ DB *gorm.DB }
+
+var ErrFeedNotFound = errors.New("calendar feed not found")
+
+// Feed returns the user's subscription, creating one with a fresh token on
+// first use; Token is only set in that case. A revoked feed has an empty
+// TokenHash until rotated.
+func (s *CalendarService) Feed(userID uint) (*models.CalendarFeed, error) {
+	var f models.CalendarFeed
+	err := s.DB.Preload("Teams").Where("user_id = ?", userID).First(&f).Error
+	if err == nil {
+		return &f, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	token, err := newCalendarToken()
+	if err != nil {
+		return nil, err
+	}
+	f = models.CalendarFeed{UserID: userID, TokenHash: hashToken(token), IncludeFavorite: true}
+	if err := s.DB.Create(&f).Error; err != nil {
+		return nil, err
+	}
+	f.Token = token
+	return &f, nil
+}
+
+// Rotate replaces the token, immediately invalidating the previous URL, and
+// returns the feed with the new Token. It also re-enables a revoked feed.
+func (s *CalendarService) Rotate(userID uint) (*models.CalendarFeed, error) {
+	f, err := s.Feed(userID)
+	if err != nil {
+		return nil, err
+	}
+	token, err := newCalendarToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.DB.Model(f).Update("token_hash", hashToken(token)).Error; err != nil {
+		return nil, err
+	}
+	f.Token = token
+	return f, nil
+}
+
+// Revoke clears the token so the subscription URL stops working. The feed
+// stays disabled until the user rotates it.
+func (s *CalendarService) Revoke(userID uint) error {
+	return s.DB.Model(&models.CalendarFeed{}).Where("user_id = ?", userID).Update("token_hash", "").Error
+}
+
+// UpdateSelection sets which teams and competitions appear in the feed.
+// An empty competitions list means every competition.
+func (s *CalendarService) UpdateSelection(userID uint, teamIDs []uint, competitions []string, includeFavorite bool) (*models.CalendarFeed, error) {
+	f, err := s.Feed(userID)
+	if err != nil {
+		return nil, err
+	}
+	var teams []models.Team
+	if len(teamIDs) > 0 {
+		if err := s.DB.Where("id IN ?", teamIDs).Find(&teams).Error; err != nil {
+			return nil, err
+		}
+	}
+	clean := make([]string, 0, len(competitions))
+	for _, c := range competitions {
+		if c = strings.TrimSpace(c); c != "" {
+			clean = append(clean, c)
+		}
+	}
+	// Competition names may contain commas, so the list is stored as JSON.
+	stored := ""
+	if len(clean) > 0 {
+		b, err := json.Marshal(clean)
+		if err != nil {
+			return nil, err
+		}
+		stored = string(b)
+	}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(f).Association("Teams").Replace(teams); err != nil {
+			return err
+		}
+		return tx.Model(f).Updates(map[string]interface{}{
+			"competitions":     stored,
+			"include_favorite": includeFavorite,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.Teams = teams
+	return f, nil
+}
+
+// Resolve looks up a feed by token and returns its owner's fixtures.
+func (s *CalendarService) Resolve(token string, matches *MatchService) (*models.User, []models.Match, error) {
+	if token == "" {
+		return nil, nil, ErrFeedNotFound
+	}
+	var f models.CalendarFeed
+	if err := s.DB.Preload("Teams").Where("token_hash = ?", hashToken(token)).First(&f).Error; err != nil {
+		return nil, nil, ErrFeedNotFound
+	}
+	var u models.User
+	if err := s.DB.First(&u, f.UserID).Error; err != nil {
+		return nil, nil, ErrFeedNotFound
+	}
+	teamIDs := make([]uint, 0, len(f.Teams)+1)
+	if f.IncludeFavorite && u.FavoriteTeamID != nil {
+		teamIDs = append(teamIDs, *u.FavoriteTeamID)
+	}
+	for _, t := range f.Teams {
+		teamIDs = append(teamIDs, t.ID)
+	}
+	if len(teamIDs) == 0 {
+		return &u, nil, nil
+	}
+	list, err := matches.ForTeams(teamIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &u, filterCompetitions(list, FeedCompetitions(&f)), nil
+}
+
+// FeedCompetitions returns the competitions a feed is limited to; none
+// means every competition.
+func FeedCompetitions(f *models.CalendarFeed) []string {
+	out := []string{}
+	if f.Competitions == "" {
+		return out
+	}
+	if strings.HasPrefix(f.Competitions, "[") {
+		if err := json.Unmarshal([]byte(f.Competitions), &out); err == nil {
+			return out
+		}
+	}
+	return strings.Split(f.Competitions, ",")
+}
+
+func filterCompetitions(list []models.Match, competitions []string) []models.Match {
+	if len(competitions) == 0 {
+		return list
+	}
+	allowed := make(map[string]bool)
+	for _, c := range competitions {
+		allowed[strings.ToLower(c)] = true
+	}
+	out := list[:0]
+	for _, m := range list {
+		if allowed[strings.ToLower(m.Competition)] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func newCalendarToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken is how bearer tokens are kept at rest: a lookup by hash finds
+// the row, and a leaked table does not leak working tokens.
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
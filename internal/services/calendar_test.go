@@ -0,0 +1,75 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"project/internal/models"
+)
+
+func TestCalendarFeedTokenIsHashed(t *testing.T) {
+	db := newTestDB(t)
+	s := &CalendarService{DB: db}
+	u := createUser(t, db, "fan@example.com", "user")
+
+	f, err := s.Feed(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Token == "" || f.TokenHash != hashToken(f.Token) {
+		t.Fatalf("new feed: token %q, hash %q", f.Token, f.TokenHash)
+	}
+	var stored models.CalendarFeed
+	db.First(&stored, f.ID)
+	if stored.TokenHash == f.Token {
+		t.Fatal("raw token stored")
+	}
+	if again, _ := s.Feed(u.ID); again.Token != "" {
+		t.Fatal("existing feed returned its token again")
+	}
+	if _, _, err := s.Resolve(f.Token, &MatchService{DB: db}); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if _, _, err := s.Resolve(f.TokenHash, &MatchService{DB: db}); !errors.Is(err, ErrFeedNotFound) {
+		t.Fatalf("resolve by hash: err = %v, want ErrFeedNotFound", err)
+	}
+
+	rotated, err := s.Rotate(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Resolve(f.Token, &MatchService{DB: db}); !errors.Is(err, ErrFeedNotFound) {
+		t.Fatalf("old token after rotate: err = %v", err)
+	}
+	if _, _, err := s.Resolve(rotated.Token, &MatchService{DB: db}); err != nil {
+		t.Fatalf("new token: %v", err)
+	}
+}
+
+func TestCalendarCompetitionsWithCommas(t *testing.T) {
+	db := newTestDB(t)
+	s := &CalendarService{DB: db}
+	u := createUser(t, db, "fan@example.com", "user")
+	team := models.Team{Name: "Home"}
+	db.Create(&team)
+	for _, comp := range []string{"Cup, Round 3", "Cup", "Premier League"} {
+		db.Create(&models.Match{HomeTeamID: team.ID, AwayTeamID: team.ID, Competition: comp})
+	}
+	f, _ := s.Feed(u.ID)
+	if _, err := s.UpdateSelection(u.ID, []uint{team.ID}, []string{" Cup, Round 3 "}, false); err != nil {
+		t.Fatal(err)
+	}
+	_, list, err := s.Resolve(f.Token, &MatchService{DB: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Competition != "Cup, Round 3" {
+		t.Fatalf("got %d matches %v, want only Cup, Round 3", len(list), list)
+	}
+
+	// Rows written before the JSON format are comma-separated.
+	legacy := models.CalendarFeed{Competitions: "Cup,Premier League"}
+	if got := FeedCompetitions(&legacy); len(got) != 2 || got[1] != "Premier League" {
+		t.Fatalf("legacy competitions = %q", got)
+	}
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"log"
+	"sync"
+)
+
+// Event names published on the EventBus.
+const (
+	EventMatchResultChanged = "match.result_changed"
+	EventStandingsUpdated   = "standings.updated"
+	EventMatchEventAdded    = "match.event_added"
+)
+
+// Event is a domain event. Payload holds one of the typed structs below,
+// matching Name.
+type Event struct {
+	Name    string
+	Payload interface{}
+}
+
+// MatchResultChanged is published after MatchService.UpdateResult writes a
+// score or status.
+type MatchResultChanged struct {
+	MatchID        uint
+	HomeTeamID     uint
+	AwayTeamID     uint
+	HomeScore      int
+	AwayScore      int
+	Status         string
+	PreviousStatus string
+}
+
+// StandingsUpdated carries a freshly computed league table.
+type StandingsUpdated struct {
+	Rows []TableRow
+}
+
+// EventBus is an in-process publish/subscribe dispatcher. Handlers run
+// synchronously in subscription order, so by the time Publish returns every
+// subscriber has seen the event; a panicking handler is logged and skipped.
+type EventBus struct {
+	mu     sync.RWMutex
+	nextID int
+	subs   map[string][]subscription
+}
+
+type subscription struct {
+	id int
+	fn func(Event)
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[string][]subscription)}
+}
+
+// Subscribe registers fn for events called name. The returned function
+// removes the subscription; long-lived subscribers can ignore it.
+func (b *EventBus) Subscribe(name string, fn func(Event)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	id := b.nextID
+	b.subs[name] = append(b.subs[name], subscription{id: id, fn: fn})
+	return func() { b.unsubscribe(name, id) }
+}
+
+func (b *EventBus) unsubscribe(name string, id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	list := b.subs[name]
+	for i, sub := range list {
+		if sub.id == id {
+			b.subs[name] = append(list[:i:i], list[i+1:]...)
+			return
+		}
+	}
+}
+
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	handlers := append([]subscription{}, b.subs[e.Name]...)
+	b.mu.RUnlock()
+	for _, sub := range handlers {
+		dispatch(e, sub.fn)
+	}
+}
+
+func dispatch(e Event, fn func(Event)) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("event %s: subscriber panic: %v", e.Name, r)
+		}
+	}()
+	fn(e)
+}
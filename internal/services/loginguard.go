@@ -0,0 +1,153 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"project/internal/cache"
+	"project/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// LoginLimit is the failed-login policy for one kind of key (an account or
+// a client IP). The first Free failures cost nothing; after that each
+// failure makes the next attempt wait BaseDelay, doubling up to MaxDelay.
+// LockAfter failures within Window lock the key for LockFor.
+type LoginLimit struct {
+	Free      int
+	LockAfter int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Window    time.Duration
+	LockFor   time.Duration
+}
+
+// LoginGuard throttles password guessing per account and per IP. Counters
+// live in Redis when it is configured, otherwise in memory.
+type LoginGuard struct {
+	DB       *gorm.DB
+	Counters *cache.Counters
+	Account  LoginLimit
+	IP       LoginLimit
+}
+
+// LoginThrottledError is returned by Login while a backoff or lockout is in
+// force. The password is not checked at all in that case.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return "too many failed login attempts; try again later"
+	}
+	return fmt.Sprintf("too many failed login attempts; wait %ds", int(e.RetryAfter.Seconds()+0.999))
+}
+
+// NewLoginGuard returns a guard with the default policy: accounts back off
+// after 3 failures and lock for 15 minutes after 10; an IP gets 20 free
+// failures and locks after 100, so one address cannot spray many accounts.
+func NewLoginGuard(db *gorm.DB, counters *cache.Counters) *LoginGuard {
+	return &LoginGuard{
+		DB:       db,
+		Counters: counters,
+		Account: LoginLimit{
+			Free: 3, LockAfter: 10,
+			BaseDelay: time.Second, MaxDelay: time.Minute,
+			Window: 15 * time.Minute, LockFor: 15 * time.Minute,
+		},
+		IP: LoginLimit{
+			Free: 20, LockAfter: 100,
+			BaseDelay: time.Second, MaxDelay: time.Minute,
+			Window: 15 * time.Minute, LockFor: 15 * time.Minute,
+		},
+	}
+}
+
+func accountKey(email string) string {
+	return "acct:" + strings.TrimSpace(strings.ToLower(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns a *LoginThrottledError if the account or the IP must wait.
+func (g *LoginGuard) Check(email, ip string) error {
+	now := time.Now()
+	var wait time.Duration
+	locked := false
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		if until := g.Counters.Until("lock:" + key); until.After(now) {
+			locked = true
+			if d := until.Sub(now); d > wait {
+				wait = d
+			}
+		}
+		if until := g.Counters.Until("wait:" + key); until.After(now) {
+			if d := until.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	if wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait, Locked: locked}
+	}
+	return nil
+}
+
+// Failed records a failed attempt. userID is the account the email belongs
+// to, or 0 when there is none.
+func (g *LoginGuard) Failed(email, ip string, userID uint) {
+	email = strings.TrimSpace(strings.ToLower(email))
+	if g.fail(accountKey(email), g.Account) {
+		g.audit("user", userID, fmt.Sprintf("%s locked for %s after %d failed logins (last from %s)",
+			email, g.Account.LockFor, g.Account.LockAfter, ip))
+	}
+	if g.fail(ipKey(ip), g.IP) {
+		g.audit("ip", 0, fmt.Sprintf("%s locked for %s after %d failed logins (last for %s)",
+			ip, g.IP.LockFor, g.IP.LockAfter, email))
+	}
+}
+
+// Succeeded resets the account's counters. The IP's are left alone so an
+// attacker cannot clear them by logging in to an account of their own.
+func (g *LoginGuard) Succeeded(email string) {
+	key := accountKey(email)
+	g.Counters.Del("fail:"+key, "wait:"+key)
+}
+
+// fail counts a failure against key and reports whether it triggered a
+// lockout.
+func (g *LoginGuard) fail(key string, limit LoginLimit) bool {
+	now := time.Now()
+	n := g.Counters.Incr("fail:"+key, limit.Window)
+	if limit.LockAfter > 0 && n >= int64(limit.LockAfter) {
+		g.Counters.SetUntil("lock:"+key, now.Add(limit.LockFor))
+		// Start over once the lockout ends.
+		g.Counters.Del("fail:"+key, "wait:"+key)
+		return true
+	}
+	if n > int64(limit.Free) {
+		delay := limit.BaseDelay
+		for i := int64(limit.Free) + 1; i < n && delay < limit.MaxDelay; i++ {
+			delay *= 2
+		}
+		if delay > limit.MaxDelay {
+			delay = limit.MaxDelay
+		}
+		g.Counters.SetUntil("wait:"+key, now.Add(delay))
+	}
+	return false
+}
+
+// audit writes the lockout to the moderation log as a system action.
+func (g *LoginGuard) audit(targetType string, targetID uint, detail string) {
+	if g.DB == nil {
+		return
+	}
+	_ = audit(g.DB, 0, models.ModLoginLockout, targetType, targetID, "", detail)
+}
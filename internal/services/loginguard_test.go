@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"project/internal/cache"
+	"project/internal/models"
+)
+
+func throttled(t *testing.T, err error) *LoginThrottledError {
+	t.Helper()
+	var te *LoginThrottledError
+	if !errors.As(err, &te) {
+		t.Fatalf("err = %v, want *LoginThrottledError", err)
+	}
+	return te
+}
+
+func TestLoginBackoffDoublesUpToMax(t *testing.T) {
+	g := NewLoginGuard(nil, cache.NewCounters(t.Name()))
+	g.Account = LoginLimit{Free: 3, LockAfter: 100, BaseDelay: time.Second, MaxDelay: 8 * time.Second, Window: time.Hour, LockFor: time.Hour}
+
+	for i := 0; i < 3; i++ {
+		g.Failed("fan@example.com", "", 0)
+	}
+	if err := g.Check("fan@example.com", ""); err != nil {
+		t.Fatalf("free failures throttled: %v", err)
+	}
+	// Failures 4, 5, 6, 7 and 8 wait 1s, 2s, 4s, then the 8s cap.
+	for _, want := range []time.Duration{1, 2, 4, 8, 8} {
+		g.Failed("FAN@example.com ", "", 0)
+		got := throttled(t, g.Check("fan@example.com", "")).RetryAfter
+		if got > want*time.Second || got < want*time.Second-time.Second {
+			t.Fatalf("wait = %s, want about %s", got, want*time.Second)
+		}
+	}
+	g.Succeeded("fan@example.com")
+	if err := g.Check("fan@example.com", ""); err != nil {
+		t.Fatalf("after success: %v", err)
+	}
+}
+
+func TestLoginLockoutIsAudited(t *testing.T) {
+	db := newTestDB(t)
+	g := NewLoginGuard(db, cache.NewCounters(t.Name()))
+	g.Account.BaseDelay, g.Account.MaxDelay = 0, 0
+	u := createUser(t, db, "fan@example.com", "user")
+
+	for i := 0; i < g.Account.LockAfter; i++ {
+		g.Failed("fan@example.com", "203.0.113.9", u.ID)
+	}
+	te := throttled(t, g.Check("fan@example.com", "198.51.100.1"))
+	if !te.Locked || te.RetryAfter < g.Account.LockFor-time.Minute {
+		t.Fatalf("lockout = %+v", te)
+	}
+	var entry models.ModerationAction
+	if err := db.Where("action = ? AND target_id = ?", models.ModLoginLockout, u.ID).First(&entry).Error; err != nil {
+		t.Fatalf("no lockout audit entry: %v", err)
+	}
+	// Signing in to another account does not clear the IP's count.
+	g.Succeeded("other@example.com")
+	if n := g.Counters.Incr("fail:"+ipKey("203.0.113.9"), time.Hour); n != int64(g.Account.LockAfter)+1 {
+		t.Fatalf("ip failures = %d", n)
+	}
+}
+
+func TestThrottledLoginSkipsPasswordCheck(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuth(db)
+	s.Guard = NewLoginGuard(db, cache.NewCounters(t.Name()))
+	u := createUser(t, db, "fan@example.com", "user")
+	setPassword(t, db, &u, "password1")
+
+	for i := 0; i <= s.Guard.Account.Free; i++ {
+		if _, _, err := s.Login("fan@example.com", "wrong-password", ClientInfo{IP: "203.0.113.9"}); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: err = %v", i+1, err)
+		}
+	}
+	_, _, err := s.Login("fan@example.com", "password1", ClientInfo{IP: "203.0.113.9"})
+	throttled(t, err)
+}
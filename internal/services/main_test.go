@@ -0,0 +1,93 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"project/internal/jwtkeys"
+	"project/internal/mail"
+	"project/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens a private in-memory database with every table migrated.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared&_pragma=busy_timeout(5000)", name)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	err = db.AutoMigrate(
+		&models.User{}, &models.Team{}, &models.Player{}, &models.PlayerStat{},
+		&models.Match{}, &models.MatchEvent{}, &models.Thread{}, &models.Comment{},
+		&models.CommentVote{}, &models.CommentReport{}, &models.PostingBan{},
+		&models.ModerationAction{}, &models.CalendarFeed{}, &models.Session{},
+		&models.RefreshToken{}, &models.UserToken{}, &models.RecoveryCode{},
+		&models.UserIdentity{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// createUser stores a verified account with the given role.
+func createUser(t *testing.T, db *gorm.DB, email, role string) models.User {
+	t.Helper()
+	now := time.Now()
+	u := models.User{Name: strings.Split(email, "@")[0], Email: email, Role: role, EmailVerifiedAt: &now}
+	if err := db.Create(&u).Error; err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// outbox is a Mailer that keeps what it is asked to send.
+type outbox struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (o *outbox) Send(m mail.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sent = append(o.sent, m)
+	return nil
+}
+
+// newTestAuth returns an AuthService on db that signs with an HMAC key and
+// keeps outgoing mail in an outbox.
+func newTestAuth(db *gorm.DB) *AuthService {
+	return &AuthService{
+		DB:        db,
+		Keys:      jwtkeys.NewHMAC("test-secret"),
+		JWTSecret: "test-secret",
+		Mailer:    &outbox{},
+		BaseURL:   "http://localhost:8080",
+	}
+}
+
+// setPassword gives u a password it can sign in with.
+func setPassword(t *testing.T, db *gorm.DB, u *models.User, password string) {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.PasswordHash = string(hash)
+	if err := db.Model(u).Update("password_hash", u.PasswordHash).Error; err != nil {
+		t.Fatal(err)
+	}
+}
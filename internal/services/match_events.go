@@ -0,0 +1,474 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"project/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrMatchNotLive   = errors.New("match is not live")
+	ErrInvalidEvent   = errors.New("invalid match event")
+	ErrPlayerMismatch = errors.New("player does not belong to the event team")
+)
+
+// MatchEventService records live match timelines and derives the tracker
+// view (score, minute, commentary, player stats) from them.
+type MatchEventService struct {
+	DB      *gorm.DB
+	Matches *MatchService
+	Events  *EventBus
+}
+
+// MatchEventAdded is published after an event is appended to a timeline.
+type MatchEventAdded struct {
+	MatchID uint
+	Event   models.MatchEvent
+}
+
+// Timeline returns a match's events in the order they happened.
+func (s *MatchEventService) Timeline(matchID uint) ([]models.MatchEvent, error) {
+	var events []models.MatchEvent
+	err := s.DB.Preload("Player").Preload("RelatedPlayer").
+		Where("match_id = ?", matchID).
+		Order("minute asc, extra_minute asc, id asc").Find(&events).Error
+	return events, err
+}
+
+// Since returns events recorded after the event with ID afterID, in the
+// order they were recorded. It backs replay for reconnecting stream clients.
+func (s *MatchEventService) Since(matchID, afterID uint) ([]models.MatchEvent, error) {
+	var events []models.MatchEvent
+	err := s.DB.Preload("Player").Preload("RelatedPlayer").
+		Where("match_id = ? AND id > ?", matchID, afterID).
+		Order("id asc").Find(&events).Error
+	return events, err
+}
+
+// Append validates and stores an event. Only a kick-off may be added to a
+// match that is not live yet.
+//
+// The score and status on models.Match are the source of truth; events
+// adjust them rather than replace them. A goal adds one to the stored
+// score and a VAR reversal of a goal takes one off, so a score corrected
+// through MatchService.UpdateResult stays corrected when the next goal is
+// recorded. The event and the match update are stored in one transaction,
+// and the bus hears about them only after it commits.
+func (s *MatchEventService) Append(matchID uint, e *models.MatchEvent) error {
+	var changed *MatchResultChanged
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var m models.Match
+		if err := tx.First(&m, matchID).Error; err != nil {
+			return err
+		}
+		kickOff := e.Type == models.EventPeriod && e.Detail == models.PeriodKickOff
+		if m.Status != "live" && !(kickOff && m.Status == "upcoming") {
+			return ErrMatchNotLive
+		}
+		if err := validateEvent(tx, &m, e); err != nil {
+			return err
+		}
+		e.ID = 0
+		e.MatchID = matchID
+		if err := tx.Create(e).Error; err != nil {
+			return err
+		}
+		if err := tx.Preload("Player").Preload("RelatedPlayer").First(e, e.ID).Error; err != nil {
+			return err
+		}
+		home, away, err := scoreAfter(tx, &m, e)
+		if err != nil {
+			return err
+		}
+		status := statusAfter(m.Status, e)
+		if sameScore(m.HomeScore, home) && sameScore(m.AwayScore, away) && status == m.Status {
+			return nil
+		}
+		c, err := setResult(tx, &m, home, away, status)
+		changed = &c
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if changed != nil {
+		s.Matches.Events.Publish(Event{Name: EventMatchResultChanged, Payload: *changed})
+	}
+	s.Events.Publish(Event{Name: EventMatchEventAdded, Payload: MatchEventAdded{MatchID: matchID, Event: *e}})
+	return nil
+}
+
+func validateEvent(tx *gorm.DB, m *models.Match, e *models.MatchEvent) error {
+	switch e.Type {
+	case models.EventGoal, models.EventOwnGoal, models.EventYellowCard, models.EventRedCard, models.EventSubstitution:
+		if e.TeamID == nil || e.PlayerID == nil {
+			return ErrInvalidEvent
+		}
+	case models.EventVAR:
+	case models.EventPeriod:
+		switch e.Detail {
+		case models.PeriodKickOff, models.PeriodHalfTime, models.PeriodSecondHalf, models.PeriodFullTime:
+		default:
+			return ErrInvalidEvent
+		}
+	default:
+		return ErrInvalidEvent
+	}
+	if e.Minute < 0 || e.ExtraMinute < 0 {
+		return ErrInvalidEvent
+	}
+	if e.TeamID != nil && *e.TeamID != m.HomeTeamID && *e.TeamID != m.AwayTeamID {
+		return ErrInvalidEvent
+	}
+	for _, pid := range []*uint{e.PlayerID, e.RelatedPlayerID} {
+		if pid == nil {
+			continue
+		}
+		var p models.Player
+		if err := tx.First(&p, *pid).Error; err != nil {
+			return ErrInvalidEvent
+		}
+		if e.TeamID != nil && p.TeamID != *e.TeamID {
+			return ErrPlayerMismatch
+		}
+	}
+	if e.ReversesEventID != nil {
+		var target models.MatchEvent
+		if err := tx.Where("match_id = ?", m.ID).First(&target, *e.ReversesEventID).Error; err != nil {
+			return ErrInvalidEvent
+		}
+	}
+	return nil
+}
+
+func sameScore(stored *int, v int) bool {
+	return stored != nil && *stored == v
+}
+
+func reversedEvents(events []models.MatchEvent) map[uint]bool {
+	reversed := make(map[uint]bool)
+	for _, e := range events {
+		if e.ReversesEventID != nil {
+			reversed[*e.ReversesEventID] = true
+		}
+	}
+	return reversed
+}
+
+// goalFor returns how an event changes the score: one goal for the home or
+// away side, or nothing.
+func goalFor(m *models.Match, e *models.MatchEvent) (home, away int) {
+	if e.TeamID == nil {
+		return 0, 0
+	}
+	forHome := *e.TeamID == m.HomeTeamID
+	switch e.Type {
+	case models.EventGoal:
+	case models.EventOwnGoal:
+		forHome = !forHome
+	default:
+		return 0, 0
+	}
+	if forHome {
+		return 1, 0
+	}
+	return 0, 1
+}
+
+// scoreAfter is the stored score of m with the just-created event e
+// applied. A VAR event takes back the goal it reverses, once: reversing an
+// already reversed event changes nothing.
+func scoreAfter(tx *gorm.DB, m *models.Match, e *models.MatchEvent) (home, away int, err error) {
+	if m.HomeScore != nil {
+		home = *m.HomeScore
+	}
+	if m.AwayScore != nil {
+		away = *m.AwayScore
+	}
+	if e.Type != models.EventVAR || e.ReversesEventID == nil {
+		h, a := goalFor(m, e)
+		return home + h, away + a, nil
+	}
+	var earlier int64
+	if err := tx.Model(&models.MatchEvent{}).
+		Where("reverses_event_id = ? AND id <> ?", *e.ReversesEventID, e.ID).
+		Count(&earlier).Error; err != nil {
+		return 0, 0, err
+	}
+	if earlier > 0 {
+		return home, away, nil
+	}
+	var target models.MatchEvent
+	if err := tx.First(&target, *e.ReversesEventID).Error; err != nil {
+		return 0, 0, err
+	}
+	h, a := goalFor(m, &target)
+	if home -= h; home < 0 {
+		home = 0
+	}
+	if away -= a; away < 0 {
+		away = 0
+	}
+	return home, away, nil
+}
+
+// statusAfter is the match status once event e is recorded: kick-off starts
+// an upcoming match and full time finishes it.
+func statusAfter(current string, e *models.MatchEvent) string {
+	if e.Type != models.EventPeriod {
+		return current
+	}
+	switch {
+	case e.Detail == models.PeriodKickOff && current == "upcoming":
+		return "live"
+	case e.Detail == models.PeriodFullTime:
+		return "finished"
+	}
+	return current
+}
+
+// TrackerPlayer is one player's line in the live tracker.
+type TrackerPlayer struct {
+	PlayerID uint   `json:"playerId"`
+	Name     string `json:"name"`
+	TeamID   uint   `json:"teamId"`
+	Goals    int    `json:"goals"`
+	Assists  int    `json:"assists"`
+	Yellow   int    `json:"yellowCards"`
+	Red      int    `json:"redCards"`
+	Minutes  int    `json:"minutes"`
+}
+
+// Tracker is the live view of a match built from its events.
+type Tracker struct {
+	MatchID     uint                `json:"matchId"`
+	HomeTeam    string              `json:"homeTeam"`
+	AwayTeam    string              `json:"awayTeam"`
+	HomeScore   int                 `json:"homeScore"`
+	AwayScore   int                 `json:"awayScore"`
+	Score       string              `json:"score"`
+	Status      string              `json:"status"`
+	Period      string              `json:"period"`
+	Minute      int                 `json:"minute"`
+	Commentary  []string            `json:"commentary"`
+	PlayerStats []TrackerPlayer     `json:"playerStats"`
+	Events      []models.MatchEvent `json:"events"`
+}
+
+// Tracker builds the live view for a match. The score is the one stored on
+// the match; commentary is newest first.
+func (s *MatchEventService) Tracker(matchID uint) (*Tracker, error) {
+	var m models.Match
+	if err := s.DB.Preload("HomeTeam").Preload("AwayTeam").First(&m, matchID).Error; err != nil {
+		return nil, err
+	}
+	events, err := s.Timeline(matchID)
+	if err != nil {
+		return nil, err
+	}
+	home, away := 0, 0
+	if m.HomeScore != nil {
+		home = *m.HomeScore
+	}
+	if m.AwayScore != nil {
+		away = *m.AwayScore
+	}
+	t := &Tracker{
+		MatchID:     m.ID,
+		HomeTeam:    m.HomeTeam.Name,
+		AwayTeam:    m.AwayTeam.Name,
+		HomeScore:   home,
+		AwayScore:   away,
+		Score:       fmt.Sprintf("%d-%d", home, away),
+		Status:      m.Status,
+		Commentary:  []string{},
+		PlayerStats: []TrackerPlayer{},
+		Events:      events,
+	}
+	t.Period, t.Minute = currentMinute(&m, events, time.Now())
+
+	teamNames := map[uint]string{m.HomeTeamID: m.HomeTeam.Name, m.AwayTeamID: m.AwayTeam.Name}
+	reversed := reversedEvents(events)
+	for i := len(events) - 1; i >= 0; i-- {
+		t.Commentary = append(t.Commentary, commentaryLine(events[i], teamNames, reversed[events[i].ID]))
+	}
+	t.PlayerStats = playerStats(events, reversed, t.Minute)
+	return t, nil
+}
+
+// currentMinute derives the period and match clock. While a half is in
+// progress the clock runs from the wall time of the period event, otherwise
+// it is the latest recorded minute.
+func currentMinute(m *models.Match, events []models.MatchEvent, now time.Time) (string, int) {
+	period := ""
+	minute := 0
+	var last *models.MatchEvent
+	for i := range events {
+		if events[i].Minute > minute {
+			minute = events[i].Minute
+		}
+		if events[i].Type == models.EventPeriod {
+			last = &events[i]
+		}
+	}
+	if last != nil {
+		period = last.Detail
+	}
+	if m.Status != "live" || last == nil {
+		if m.Status == "finished" && minute < 90 {
+			minute = 90
+		}
+		return period, minute
+	}
+	switch last.Detail {
+	case models.PeriodKickOff, models.PeriodSecondHalf:
+		limit := 45
+		if last.Detail == models.PeriodSecondHalf {
+			limit = 90
+		}
+		running := last.Minute + int(now.Sub(last.CreatedAt).Minutes()) + 1
+		if running > limit {
+			running = limit
+		}
+		if running > minute {
+			minute = running
+		}
+	case models.PeriodHalfTime:
+		minute = 45
+	}
+	return period, minute
+}
+
+func playerName(p *models.Player) string {
+	if p == nil {
+		return "Unknown"
+	}
+	return p.Name
+}
+
+func minuteLabel(e models.MatchEvent) string {
+	if e.ExtraMinute > 0 {
+		return fmt.Sprintf("%d+%d'", e.Minute, e.ExtraMinute)
+	}
+	return fmt.Sprintf("%d'", e.Minute)
+}
+
+func commentaryLine(e models.MatchEvent, teams map[uint]string, reversed bool) string {
+	team := ""
+	if e.TeamID != nil {
+		team = teams[*e.TeamID]
+	}
+	var text string
+	withDetail := true
+	switch e.Type {
+	case models.EventGoal:
+		text = fmt.Sprintf("GOAL! %s scores for %s.", playerName(e.Player), team)
+		if e.RelatedPlayer != nil {
+			text += fmt.Sprintf(" Assisted by %s.", e.RelatedPlayer.Name)
+		}
+	case models.EventOwnGoal:
+		text = fmt.Sprintf("Own goal by %s of %s.", playerName(e.Player), team)
+	case models.EventYellowCard:
+		text = fmt.Sprintf("Yellow card for %s (%s).", playerName(e.Player), team)
+	case models.EventRedCard:
+		text = fmt.Sprintf("Red card! %s (%s) is sent off.", playerName(e.Player), team)
+	case models.EventSubstitution:
+		text = fmt.Sprintf("Substitution for %s: %s on for %s.", team, playerName(e.Player), playerName(e.RelatedPlayer))
+	case models.EventVAR:
+		text = "VAR: " + e.Detail
+		withDetail = false
+	case models.EventPeriod:
+		withDetail = false
+		switch e.Detail {
+		case models.PeriodKickOff:
+			text = "Kick-off!"
+		case models.PeriodHalfTime:
+			text = "Half-time."
+		case models.PeriodSecondHalf:
+			text = "The second half is under way."
+		case models.PeriodFullTime:
+			text = "Full-time."
+		}
+	}
+	if withDetail && e.Detail != "" {
+		text += " " + e.Detail
+	}
+	if reversed {
+		text += " (overturned by VAR)"
+	}
+	return minuteLabel(e) + " " + text
+}
+
+// playerStats tallies every player who appears in the timeline. Minutes
+// assume the player started unless a substitution brought them on, and stop
+// when they were substituted off or sent off.
+func playerStats(events []models.MatchEvent, reversed map[uint]bool, clock int) []TrackerPlayer {
+	stats := make(map[uint]*TrackerPlayer)
+	on := make(map[uint]int)
+	off := make(map[uint]int)
+	get := func(p *models.Player) *TrackerPlayer {
+		if p == nil {
+			return nil
+		}
+		if st, ok := stats[p.ID]; ok {
+			return st
+		}
+		st := &TrackerPlayer{PlayerID: p.ID, Name: p.Name, TeamID: p.TeamID}
+		stats[p.ID] = st
+		return st
+	}
+	for _, e := range events {
+		if reversed[e.ID] {
+			continue
+		}
+		player := get(e.Player)
+		related := get(e.RelatedPlayer)
+		if player == nil {
+			continue
+		}
+		switch e.Type {
+		case models.EventGoal:
+			player.Goals++
+			if related != nil {
+				related.Assists++
+			}
+		case models.EventYellowCard:
+			player.Yellow++
+		case models.EventRedCard:
+			player.Red++
+			off[player.PlayerID] = e.Minute
+		case models.EventSubstitution:
+			on[player.PlayerID] = e.Minute
+			if related != nil {
+				off[related.PlayerID] = e.Minute
+			}
+		}
+	}
+	out := make([]TrackerPlayer, 0, len(stats))
+	for id, st := range stats {
+		end := clock
+		if m, ok := off[id]; ok {
+			end = m
+		}
+		st.Minutes = end - on[id]
+		if st.Minutes < 0 {
+			st.Minutes = 0
+		}
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Goals != out[j].Goals {
+			return out[i].Goals > out[j].Goals
+		}
+		if out[i].Assists != out[j].Assists {
+			return out[i].Assists > out[j].Assists
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
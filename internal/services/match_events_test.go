@@ -0,0 +1,103 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"project/internal/models"
+)
+
+func TestAppendAdjustsStoredScore(t *testing.T) {
+	db := newTestDB(t)
+	bus := NewEventBus()
+	matches := &MatchService{DB: db, Events: bus}
+	s := &MatchEventService{DB: db, Matches: matches, Events: bus}
+	teams := createTeams(t, db, "Home", "Away")
+	striker := models.Player{Name: "Striker", TeamID: teams[0].ID}
+	db.Create(&striker)
+	m := models.Match{HomeTeamID: teams[0].ID, AwayTeamID: teams[1].ID, Status: "upcoming"}
+	db.Create(&m)
+	var results []MatchResultChanged
+	bus.Subscribe(EventMatchResultChanged, func(e Event) { results = append(results, e.Payload.(MatchResultChanged)) })
+
+	score := func() (int, int, string) {
+		t.Helper()
+		var got models.Match
+		db.First(&got, m.ID)
+		if got.HomeScore == nil || got.AwayScore == nil {
+			t.Fatal("score not set")
+		}
+		return *got.HomeScore, *got.AwayScore, got.Status
+	}
+	goal := func() *models.MatchEvent {
+		return &models.MatchEvent{Type: models.EventGoal, Minute: 10, TeamID: &teams[0].ID, PlayerID: &striker.ID}
+	}
+
+	if err := s.Append(m.ID, &models.MatchEvent{Type: models.EventPeriod, Detail: models.PeriodKickOff}); err != nil {
+		t.Fatal(err)
+	}
+	if h, a, st := score(); h != 0 || a != 0 || st != "live" {
+		t.Fatalf("after kick-off: %d-%d %s", h, a, st)
+	}
+	first := goal()
+	if err := s.Append(m.ID, first); err != nil {
+		t.Fatal(err)
+	}
+	if first.Player == nil || first.Player.Name != "Striker" {
+		t.Fatal("appended event not reloaded with its player")
+	}
+
+	// An admin correction is kept when the next goal goes in.
+	if err := matches.UpdateResult(m.ID, 1, 1, "live"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(m.ID, goal()); err != nil {
+		t.Fatal(err)
+	}
+	if h, a, _ := score(); h != 2 || a != 1 {
+		t.Fatalf("after correction and goal: %d-%d, want 2-1", h, a)
+	}
+
+	// VAR takes the first goal back, once.
+	for i := 0; i < 2; i++ {
+		if err := s.Append(m.ID, &models.MatchEvent{Type: models.EventVAR, Minute: 12, ReversesEventID: &first.ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if h, a, _ := score(); h != 1 || a != 1 {
+		t.Fatalf("after VAR: %d-%d, want 1-1", h, a)
+	}
+	tr, err := s.Tracker(m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Score != "1-1" {
+		t.Fatalf("tracker score = %s, want the stored 1-1", tr.Score)
+	}
+
+	last := results[len(results)-1]
+	if last.HomeScore != 1 || last.AwayScore != 1 || last.PreviousStatus != "live" {
+		t.Fatalf("last result event = %+v", last)
+	}
+}
+
+func TestAppendRejectsWithoutStoring(t *testing.T) {
+	db := newTestDB(t)
+	bus := NewEventBus()
+	s := &MatchEventService{DB: db, Matches: &MatchService{DB: db, Events: bus}, Events: bus}
+	teams := createTeams(t, db, "Home", "Away", "Other")
+	outsider := models.Player{Name: "Outsider", TeamID: teams[2].ID}
+	db.Create(&outsider)
+	m := models.Match{HomeTeamID: teams[0].ID, AwayTeamID: teams[1].ID, Status: "live"}
+	db.Create(&m)
+
+	err := s.Append(m.ID, &models.MatchEvent{Type: models.EventGoal, TeamID: &teams[0].ID, PlayerID: &outsider.ID})
+	if !errors.Is(err, ErrPlayerMismatch) {
+		t.Fatalf("err = %v, want ErrPlayerMismatch", err)
+	}
+	var n int64
+	db.Model(&models.MatchEvent{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("%d events stored, want 0", n)
+	}
+}
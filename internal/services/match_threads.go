@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"project/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// MatchThreads opens pre-match, match and post-match threads automatically.
+// The match thread follows the status change to live on the event bus; the
+// pre- and post-match threads are opened by Run at the configured offsets
+// from kick-off and full time.
+type MatchThreads struct {
+	DB          *gorm.DB
+	MatchEvents *MatchEventService
+	// PreMatchOffset is how long before kick-off the pre-match thread opens.
+	PreMatchOffset time.Duration
+	// PostMatchOffset is how long after full time the post-match thread opens.
+	PostMatchOffset time.Duration
+
+	mu sync.Mutex
+}
+
+// catchUpWindow bounds how far back Tick looks, so a fresh database full of
+// old fixtures does not get a thread for every one of them.
+const catchUpWindow = 7 * 24 * time.Hour
+
+// Subscribe opens the match thread as soon as a match goes live, and the
+// post-match thread on full time when no delay is configured.
+func (s *MatchThreads) Subscribe(bus *EventBus) {
+	bus.Subscribe(EventMatchResultChanged, func(e Event) {
+		p, ok := e.Payload.(MatchResultChanged)
+		if !ok || p.Status == p.PreviousStatus {
+			return
+		}
+		switch {
+		case p.Status == "live":
+			s.ensure(p.MatchID, models.ThreadMatch)
+		case p.Status == "finished" && s.PostMatchOffset <= 0:
+			s.ensure(p.MatchID, models.ThreadPostMatch)
+		}
+	})
+}
+
+// Run checks for due threads every interval until ctx is cancelled. It also
+// catches up on anything missed while the server was down.
+func (s *MatchThreads) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.Tick(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick opens every thread that is due at now. Post-match threads count from
+// the match's FinishedAt, so a score correction does not delay them.
+func (s *MatchThreads) Tick(now time.Time) {
+	since := now.Add(-catchUpWindow)
+	var upcoming []models.Match
+	err := s.DB.Where("status = ? AND date <= ? AND date >= ?", "upcoming", now.Add(s.PreMatchOffset).Unix(), since.Unix()).Find(&upcoming).Error
+	if err != nil {
+		log.Printf("match threads: upcoming matches: %v", err)
+	}
+	for _, m := range upcoming {
+		s.ensure(m.ID, models.ThreadPreMatch)
+	}
+	var live []models.Match
+	if err := s.DB.Where("status = ?", "live").Find(&live).Error; err != nil {
+		log.Printf("match threads: live matches: %v", err)
+	}
+	for _, m := range live {
+		s.ensure(m.ID, models.ThreadMatch)
+	}
+	var finished []models.Match
+	err = s.DB.Where("status = ? AND finished_at <= ? AND finished_at >= ?", "finished", now.Add(-s.PostMatchOffset), since).Find(&finished).Error
+	if err != nil {
+		log.Printf("match threads: finished matches: %v", err)
+	}
+	for _, m := range finished {
+		s.ensure(m.ID, models.ThreadPostMatch)
+	}
+}
+
+// ensure creates the thread of the given kind unless the match already has
+// one.
+func (s *MatchThreads) ensure(matchID uint, kind string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var existing models.Thread
+	err := s.DB.Where("match_id = ? AND kind = ?", matchID, kind).First(&existing).Error
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("match threads: lookup %s for match %d: %v", kind, matchID, err)
+		return
+	}
+	var m models.Match
+	if err := s.DB.Preload("HomeTeam").Preload("AwayTeam").First(&m, matchID).Error; err != nil {
+		log.Printf("match threads: load match %d: %v", matchID, err)
+		return
+	}
+	t := models.Thread{MatchID: m.ID, Kind: kind, Title: threadTitle(&m, kind)}
+	if kind == models.ThreadPostMatch {
+		t.Body = s.postMatchBody(&m)
+	}
+	if err := s.DB.Create(&t).Error; err != nil {
+		log.Printf("match threads: create %s for match %d: %v", kind, matchID, err)
+	}
+}
+
+func threadTitle(m *models.Match, kind string) string {
+	competition := m.Competition
+	if competition == "" {
+		competition = "Premier League"
+	}
+	date := time.Unix(m.Date, 0).UTC().Format("2 Jan 2006")
+	fixture := fmt.Sprintf("%s vs %s", m.HomeTeam.Name, m.AwayTeam.Name)
+	prefix := "Match Thread"
+	switch kind {
+	case models.ThreadPreMatch:
+		prefix = "Pre-Match Thread"
+	case models.ThreadPostMatch:
+		prefix = "Post-Match Thread"
+		if m.HomeScore != nil && m.AwayScore != nil {
+			fixture = fmt.Sprintf("%s %d-%d %s", m.HomeTeam.Name, *m.HomeScore, *m.AwayScore, m.AwayTeam.Name)
+		}
+	}
+	return fmt.Sprintf("%s: %s | %s | %s", prefix, fixture, competition, date)
+}
+
+// postMatchBody seeds the post-match thread with the final score and the
+// goals, red cards and VAR decisions from the timeline.
+func (s *MatchThreads) postMatchBody(m *models.Match) string {
+	var b strings.Builder
+	home, away := 0, 0
+	if m.HomeScore != nil {
+		home = *m.HomeScore
+	}
+	if m.AwayScore != nil {
+		away = *m.AwayScore
+	}
+	fmt.Fprintf(&b, "Full time: %s %d-%d %s", m.HomeTeam.Name, home, away, m.AwayTeam.Name)
+	if m.Stadium != "" {
+		fmt.Fprintf(&b, " at %s", m.Stadium)
+	}
+	b.WriteString(".")
+	if s.MatchEvents == nil {
+		return b.String()
+	}
+	events, err := s.MatchEvents.Timeline(m.ID)
+	if err != nil {
+		return b.String()
+	}
+	teams := map[uint]string{m.HomeTeamID: m.HomeTeam.Name, m.AwayTeamID: m.AwayTeam.Name}
+	reversed := reversedEvents(events)
+	var key []string
+	for _, e := range events {
+		switch e.Type {
+		case models.EventGoal, models.EventOwnGoal, models.EventRedCard, models.EventVAR:
+			key = append(key, "- "+commentaryLine(e, teams, reversed[e.ID]))
+		}
+	}
+	if len(key) > 0 {
+		b.WriteString("\n\nKey events:\n")
+		b.WriteString(strings.Join(key, "\n"))
+	}
+	return b.String()
+}
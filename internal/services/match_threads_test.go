@@ -0,0 +1,49 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"project/internal/models"
+)
+
+func TestPostMatchThreadCountsFromFullTime(t *testing.T) {
+	db := newTestDB(t)
+	matches := &MatchService{DB: db, Events: NewEventBus()}
+	threads := &MatchThreads{DB: db, PostMatchOffset: time.Hour}
+	home, away := models.Team{Name: "Home"}, models.Team{Name: "Away"}
+	db.Create(&home)
+	db.Create(&away)
+	m := models.Match{HomeTeamID: home.ID, AwayTeamID: away.ID, Status: "live", Date: time.Now().Add(-2 * time.Hour).Unix()}
+	db.Create(&m)
+
+	if err := matches.UpdateResult(m.ID, 1, 0, "finished"); err != nil {
+		t.Fatal(err)
+	}
+	// Backdate full time, then correct the score: the correction must not
+	// restart the post-match delay.
+	db.Model(&models.Match{}).Where("id = ?", m.ID).Update("finished_at", time.Now().Add(-90*time.Minute))
+	if err := matches.UpdateResult(m.ID, 2, 0, "finished"); err != nil {
+		t.Fatal(err)
+	}
+
+	threads.Tick(time.Now())
+	var n int64
+	db.Model(&models.Thread{}).Where("match_id = ? AND kind = ?", m.ID, models.ThreadPostMatch).Count(&n)
+	if n != 1 {
+		t.Fatalf("post-match threads = %d, want 1", n)
+	}
+}
+
+func TestFinishedAtClearedWhenMatchReopens(t *testing.T) {
+	db := newTestDB(t)
+	matches := &MatchService{DB: db, Events: NewEventBus()}
+	m := models.Match{Status: "live"}
+	db.Create(&m)
+	matches.UpdateResult(m.ID, 0, 0, "finished")
+	matches.UpdateResult(m.ID, 0, 0, "live")
+	db.First(&m, m.ID)
+	if m.FinishedAt != nil {
+		t.Fatalf("FinishedAt = %v after reopening, want nil", m.FinishedAt)
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"project/internal/models"
+
+	"gorm.io/gorm"
+)
+
+func TestUpdateResultPublishesChange(t *testing.T) {
+	db := newTestDB(t)
+	bus := NewEventBus()
+	s := &MatchService{DB: db, Events: bus}
+	teams := createTeams(t, db, "Home", "Away")
+	m := models.Match{HomeTeamID: teams[0].ID, AwayTeamID: teams[1].ID, Status: "live"}
+	db.Create(&m)
+	var got []MatchResultChanged
+	bus.Subscribe(EventMatchResultChanged, func(e Event) { got = append(got, e.Payload.(MatchResultChanged)) })
+
+	if err := s.UpdateResult(m.ID, 2, 1, "finished"); err != nil {
+		t.Fatal(err)
+	}
+	want := MatchResultChanged{
+		MatchID: m.ID, HomeTeamID: teams[0].ID, AwayTeamID: teams[1].ID,
+		HomeScore: 2, AwayScore: 1, Status: "finished", PreviousStatus: "live",
+	}
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("events = %+v, want [%+v]", got, want)
+	}
+}
+
+func TestUpdateResultRejectsBadInput(t *testing.T) {
+	db := newTestDB(t)
+	bus := NewEventBus()
+	s := &MatchService{DB: db, Events: bus}
+	teams := createTeams(t, db, "Home", "Away")
+	m := models.Match{HomeTeamID: teams[0].ID, AwayTeamID: teams[1].ID, Status: "upcoming"}
+	db.Create(&m)
+	published := 0
+	bus.Subscribe(EventMatchResultChanged, func(Event) { published++ })
+
+	cases := []struct {
+		id         uint
+		home, away int
+		status     string
+		want       error
+	}{
+		{m.ID, 1, 0, "", ErrInvalidStatus},
+		{m.ID, 1, 0, "abandoned", ErrInvalidStatus},
+		{m.ID, -1, 0, "live", ErrNegativeScore},
+		{m.ID + 1, 1, 0, "live", gorm.ErrRecordNotFound},
+	}
+	for _, c := range cases {
+		if err := s.UpdateResult(c.id, c.home, c.away, c.status); !errors.Is(err, c.want) {
+			t.Errorf("UpdateResult(%d, %d, %d, %q) = %v, want %v", c.id, c.home, c.away, c.status, err, c.want)
+		}
+	}
+	if published != 0 {
+		t.Fatalf("%d events published for rejected updates", published)
+	}
+	var stored models.Match
+	db.First(&stored, m.ID)
+	if stored.Status != "upcoming" || stored.HomeScore != nil {
+		t.Fatalf("match changed: %+v", stored)
+	}
+}
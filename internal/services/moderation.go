@@ -0,0 +1,468 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"project/internal/models"
+	"project/internal/rbac"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ModerationService handles comment reports, removals and posting bans.
+// Every moderator action is written to the audit log in the same
+// transaction as the change itself.
+type ModerationService struct{ DB *gorm.DB }
+
+var (
+	ErrReasonRequired  = errors.New("reason is required")
+	ErrAlreadyReported = errors.New("you have already reported this comment")
+	ErrPostingBanned   = errors.New("you are banned from posting")
+	ErrBanStaff        = errors.New("staff who can ban users or change roles cannot be banned")
+	ErrInvalidBan      = errors.New("ban duration must be positive and at most 365 days")
+	ErrNoActiveBan     = errors.New("user has no active ban")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrInvalidRole     = errors.New("role must be admin, editor, moderator, club_official or user")
+	ErrClubTeamNeeded  = errors.New("club_official needs the teamId of an existing team")
+)
+
+// maxBan keeps "time-limited" honest; permanent removal is account deletion.
+const maxBan = 365 * 24 * time.Hour
+
+// QueueItem is one comment waiting for a moderator: either held by the
+// content filter or reported, with every open report folded together.
+type QueueItem struct {
+	Comment       CommentView `json:"comment"`
+	Removed       bool        `json:"removed"`
+	Held          bool        `json:"held"`
+	ReportCount   int         `json:"reportCount"`
+	Reasons       []string    `json:"reasons"`
+	FirstReported time.Time   `json:"firstReported"`
+}
+
+// BanView describes a posting ban.
+type BanView struct {
+	ID        uint       `json:"id"`
+	UserID    uint       `json:"userId"`
+	IssuedBy  uint       `json:"issuedBy"`
+	Reason    string     `json:"reason"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	LiftedAt  *time.Time `json:"liftedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// AuditEntry is one row of the moderation log.
+type AuditEntry struct {
+	ID          uint      `json:"id"`
+	ModeratorID uint      `json:"moderatorId"`
+	Moderator   string    `json:"moderator"`
+	Action      string    `json:"action"`
+	TargetType  string    `json:"targetType"`
+	TargetID    uint      `json:"targetId"`
+	Reason      string    `json:"reason,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Report files a report against a comment on behalf of reporterID.
+func (s *ModerationService) Report(commentID, reporterID uint, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return ErrReasonRequired
+	}
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	var cm models.Comment
+	if err := s.DB.First(&cm, commentID).Error; err != nil {
+		return ErrCommentNotFound
+	}
+	// The unique index on (comment, reporter) decides, so two reports sent
+	// at once cannot both get in.
+	res := s.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.CommentReport{CommentID: commentID, ReporterID: reporterID, Reason: reason, Status: models.ReportOpen})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrAlreadyReported
+	}
+	return nil
+}
+
+// Queue returns comments held by the content filter and comments with open
+// reports. Held comments come first, then the most reported, then the
+// oldest. Ordering, paging and the total are done in SQL so a page costs
+// the same however long the backlog is.
+func (s *ModerationService) Queue(page, pageSize int) ([]QueueItem, int64, error) {
+	queued := s.DB.Model(&models.Comment{}).Where(
+		"(comments.held = ? AND comments.removed_at IS NULL) OR comments.id IN (?)", true,
+		s.DB.Model(&models.CommentReport{}).Select("comment_id").Where("status = ?", models.ReportOpen))
+	var total int64
+	if err := queued.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var rows []struct {
+		ID          uint
+		ReportCount int
+	}
+	err := queued.Session(&gorm.Session{}).
+		Select("comments.id, (SELECT COUNT(*) FROM comment_reports r WHERE r.comment_id = comments.id AND r.status = ? AND r.deleted_at IS NULL) AS report_count", models.ReportOpen).
+		Order("comments.held DESC, report_count DESC, comments.id ASC").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Scan(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return []QueueItem{}, total, err
+	}
+	ids := make([]uint, len(rows))
+	for i, r := range rows {
+		ids[i] = r.ID
+	}
+	var comments []models.Comment
+	if err := s.DB.Preload("User").Where("id IN ?", ids).Find(&comments).Error; err != nil {
+		return nil, 0, err
+	}
+	var reports []models.CommentReport
+	if err := s.DB.Where("comment_id IN ? AND status = ?", ids, models.ReportOpen).Order("id asc").Find(&reports).Error; err != nil {
+		return nil, 0, err
+	}
+	byComment := make(map[uint]*QueueItem, len(comments))
+	for _, cm := range comments {
+		item := &QueueItem{
+			Comment: commentView(cm),
+			Removed: cm.RemovedAt != nil,
+			Held:    cm.Held,
+			Reasons: []string{},
+		}
+		// Moderators need to see what was said even after removal.
+		item.Comment.Message = cm.Message
+		if cm.Held && cm.RemovedAt == nil {
+			item.Reasons = append(item.Reasons, cm.HeldReason)
+			item.FirstReported = cm.CreatedAt
+		}
+		byComment[cm.ID] = item
+	}
+	for _, r := range reports {
+		item := byComment[r.CommentID]
+		if item == nil {
+			continue
+		}
+		if item.FirstReported.IsZero() {
+			item.FirstReported = r.CreatedAt
+		}
+		item.ReportCount++
+		item.Reasons = append(item.Reasons, r.Reason)
+	}
+	items := make([]QueueItem, 0, len(rows))
+	for _, r := range rows {
+		if item := byComment[r.ID]; item != nil {
+			items = append(items, *item)
+		}
+	}
+	return items, total, nil
+}
+
+// RemoveComment hides a comment and closes its open reports as actioned.
+func (s *ModerationService) RemoveComment(moderatorID, commentID uint, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return ErrReasonRequired
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var cm models.Comment
+		if err := tx.First(&cm, commentID).Error; err != nil {
+			return ErrCommentNotFound
+		}
+		now := time.Now()
+		err := tx.Model(&cm).Updates(map[string]interface{}{
+			"removed_at":     now,
+			"removed_by_id":  moderatorID,
+			"removal_reason": reason,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := resolveReports(tx, commentID, moderatorID, models.ReportActioned, now); err != nil {
+			return err
+		}
+		return audit(tx, moderatorID, models.ModRemoveComment, "comment", commentID, reason, "")
+	})
+}
+
+// ApproveComment publishes a held comment and dismisses any open reports
+// against it.
+func (s *ModerationService) ApproveComment(moderatorID, commentID uint, reason string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var cm models.Comment
+		if err := tx.First(&cm, commentID).Error; err != nil {
+			return ErrCommentNotFound
+		}
+		if err := tx.Model(&cm).Updates(map[string]interface{}{"held": false, "held_reason": ""}).Error; err != nil {
+			return err
+		}
+		if err := resolveReports(tx, commentID, moderatorID, models.ReportDismissed, time.Now()); err != nil {
+			return err
+		}
+		return audit(tx, moderatorID, models.ModApproveComment, "comment", commentID, strings.TrimSpace(reason), "")
+	})
+}
+
+// RestoreComment undoes a removal.
+func (s *ModerationService) RestoreComment(moderatorID, commentID uint, reason string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var cm models.Comment
+		if err := tx.First(&cm, commentID).Error; err != nil {
+			return ErrCommentNotFound
+		}
+		err := tx.Model(&cm).Updates(map[string]interface{}{
+			"removed_at":     nil,
+			"removed_by_id":  nil,
+			"removal_reason": "",
+		}).Error
+		if err != nil {
+			return err
+		}
+		return audit(tx, moderatorID, models.ModRestoreComment, "comment", commentID, strings.TrimSpace(reason), "")
+	})
+}
+
+// DismissReports closes a comment's open reports without removing it.
+func (s *ModerationService) DismissReports(moderatorID, commentID uint, reason string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var cm models.Comment
+		if err := tx.First(&cm, commentID).Error; err != nil {
+			return ErrCommentNotFound
+		}
+		if err := resolveReports(tx, commentID, moderatorID, models.ReportDismissed, time.Now()); err != nil {
+			return err
+		}
+		return audit(tx, moderatorID, models.ModDismissReports, "comment", commentID, strings.TrimSpace(reason), "")
+	})
+}
+
+// Ban stops userID from posting for the given duration. A new ban replaces
+// any active one. Users who could lift the ban themselves, by unbanning or
+// by changing roles, cannot be banned.
+func (s *ModerationService) Ban(moderatorID, userID uint, d time.Duration, reason string) (*BanView, error) {
+	if d <= 0 || d > maxBan {
+		return nil, ErrInvalidBan
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+	var ban models.PostingBan
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var u models.User
+		if err := tx.First(&u, userID).Error; err != nil {
+			return ErrUserNotFound
+		}
+		if rbac.Can(u.Role, rbac.UserBan) || rbac.Can(u.Role, rbac.UserRoleWrite) {
+			return ErrBanStaff
+		}
+		now := time.Now()
+		if err := tx.Model(&models.PostingBan{}).
+			Where("user_id = ? AND lifted_at IS NULL AND expires_at > ?", userID, now).
+			Update("lifted_at", now).Error; err != nil {
+			return err
+		}
+		ban = models.PostingBan{UserID: userID, IssuedBy: moderatorID, Reason: reason, ExpiresAt: now.Add(d)}
+		if err := tx.Create(&ban).Error; err != nil {
+			return err
+		}
+		return audit(tx, moderatorID, models.ModBanUser, "user", userID, reason, fmt.Sprintf("until %s", ban.ExpiresAt.UTC().Format(time.RFC3339)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	v := banView(ban)
+	return &v, nil
+}
+
+// Unban lifts a user's active ban early.
+func (s *ModerationService) Unban(moderatorID, userID uint, reason string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&models.PostingBan{}).
+			Where("user_id = ? AND lifted_at IS NULL AND expires_at > ?", userID, now).
+			Update("lifted_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNoActiveBan
+		}
+		return audit(tx, moderatorID, models.ModUnbanUser, "user", userID, strings.TrimSpace(reason), "")
+	})
+}
+
+// ActiveBan returns the user's current ban, or nil.
+func (s *ModerationService) ActiveBan(userID uint) (*BanView, error) {
+	return activeBan(s.DB, userID)
+}
+
+// Bans lists a user's ban history, newest first.
+func (s *ModerationService) Bans(userID uint) ([]BanView, error) {
+	var list []models.PostingBan
+	if err := s.DB.Where("user_id = ?", userID).Order("id desc").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	out := make([]BanView, 0, len(list))
+	for _, b := range list {
+		out = append(out, banView(b))
+	}
+	return out, nil
+}
+
+// RevokedRoleChanged is the session revocation reason after a role change.
+const RevokedRoleChanged = "role_changed"
+
+// SetRole changes a user's role. Only holders of user.role.write reach
+// this; the change is audited like any other moderation action. Club
+// officials also get the team they represent (clubTeamID); every other role
+// drops it. Access tokens carry the role, so the user's sessions are
+// revoked and the new role applies from their next sign-in.
+func (s *ModerationService) SetRole(adminID, userID uint, role string, clubTeamID *uint) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		clubTeamID, err := checkRole(tx, role, clubTeamID)
+		if err != nil {
+			return err
+		}
+		var u models.User
+		if err := tx.First(&u, userID).Error; err != nil {
+			return ErrUserNotFound
+		}
+		if u.Role == rbac.Admin && role != rbac.Admin {
+			if err := keepAnAdmin(tx, u.ID); err != nil {
+				return err
+			}
+		}
+		detail := u.Role + " -> " + role
+		if clubTeamID != nil {
+			detail += fmt.Sprintf(" (team %d)", *clubTeamID)
+		}
+		if err := tx.Model(&u).Updates(map[string]interface{}{"role": role, "club_team_id": clubTeamID}).Error; err != nil {
+			return err
+		}
+		if err := revokeUserSessions(tx, u.ID, RevokedRoleChanged, time.Now()); err != nil {
+			return err
+		}
+		return audit(tx, adminID, models.ModChangeRole, "user", userID, "", detail)
+	})
+}
+
+// checkRole validates a role assignment and returns the club team to store
+// with it: required for club officials, nil for every other role.
+func checkRole(tx *gorm.DB, role string, clubTeamID *uint) (*uint, error) {
+	if !rbac.Valid(role) {
+		return nil, ErrInvalidRole
+	}
+	if role != rbac.ClubOfficial {
+		return nil, nil
+	}
+	if clubTeamID == nil || tx.First(&models.Team{}, *clubTeamID).Error != nil {
+		return nil, ErrClubTeamNeeded
+	}
+	return clubTeamID, nil
+}
+
+// Log returns the audit log, newest first, optionally filtered by action
+// or moderator.
+func (s *ModerationService) Log(action string, moderatorID uint, page, pageSize int) ([]AuditEntry, int64, error) {
+	q := s.DB.Model(&models.ModerationAction{})
+	if action != "" {
+		q = q.Where("action = ?", action)
+	}
+	if moderatorID != 0 {
+		q = q.Where("moderator_id = ?", moderatorID)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var rows []models.ModerationAction
+	if err := q.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+	names := make(map[uint]string)
+	ids := make([]uint, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.ModeratorID)
+	}
+	if len(ids) > 0 {
+		var users []models.User
+		s.DB.Unscoped().Where("id IN ?", ids).Find(&users)
+		for _, u := range users {
+			names[u.ID] = u.Name
+		}
+	}
+	names[0] = "system"
+	out := make([]AuditEntry, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, AuditEntry{
+			ID:          r.ID,
+			ModeratorID: r.ModeratorID,
+			Moderator:   names[r.ModeratorID],
+			Action:      r.Action,
+			TargetType:  r.TargetType,
+			TargetID:    r.TargetID,
+			Reason:      r.Reason,
+			Detail:      r.Detail,
+			CreatedAt:   r.CreatedAt,
+		})
+	}
+	return out, total, nil
+}
+
+// Record adds an audit entry for an action taken outside this service,
+// such as a chat room mute.
+func (s *ModerationService) Record(moderatorID uint, action, targetType string, targetID uint, reason, detail string) error {
+	return audit(s.DB, moderatorID, action, targetType, targetID, reason, detail)
+}
+
+func activeBan(db *gorm.DB, userID uint) (*BanView, error) {
+	var b models.PostingBan
+	err := db.Where("user_id = ? AND lifted_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("expires_at desc").First(&b).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	v := banView(b)
+	return &v, nil
+}
+
+func resolveReports(tx *gorm.DB, commentID, moderatorID uint, status string, at time.Time) error {
+	return tx.Model(&models.CommentReport{}).
+		Where("comment_id = ? AND status = ?", commentID, models.ReportOpen).
+		Updates(map[string]interface{}{"status": status, "resolved_by": moderatorID, "resolved_at": at}).Error
+}
+
+func audit(tx *gorm.DB, moderatorID uint, action, targetType string, targetID uint, reason, detail string) error {
+	return tx.Create(&models.ModerationAction{
+		ModeratorID: moderatorID,
+		Action:      action,
+		TargetType:  targetType,
+		TargetID:    targetID,
+		Reason:      reason,
+		Detail:      detail,
+	}).Error
+}
+
+func banView(b models.PostingBan) BanView {
+	return BanView{
+		ID:        b.ID,
+		UserID:    b.UserID,
+		IssuedBy:  b.IssuedBy,
+		Reason:    b.Reason,
+		ExpiresAt: b.ExpiresAt,
+		LiftedAt:  b.LiftedAt,
+		CreatedAt: b.CreatedAt,
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"project/internal/models"
+	"project/internal/rbac"
+)
+
+func TestBanRefusesStaff(t *testing.T) {
+	db := newTestDB(t)
+	s := &ModerationService{DB: db}
+	mod := createUser(t, db, "mod@example.com", rbac.Moderator)
+	for _, role := range []string{rbac.Admin, rbac.Moderator} {
+		target := createUser(t, db, role+"-target@example.com", role)
+		if _, err := s.Ban(mod.ID, target.ID, time.Hour, "spam"); !errors.Is(err, ErrBanStaff) {
+			t.Errorf("ban %s: err = %v, want ErrBanStaff", role, err)
+		}
+	}
+	for _, role := range []string{rbac.Editor, rbac.ClubOfficial, rbac.User} {
+		target := createUser(t, db, role+"-target@example.com", role)
+		if _, err := s.Ban(mod.ID, target.ID, time.Hour, "spam"); err != nil {
+			t.Errorf("ban %s: %v", role, err)
+		}
+	}
+}
+
+func TestReportOncePerReporter(t *testing.T) {
+	db := newTestDB(t)
+	s := &ModerationService{DB: db}
+	u := createUser(t, db, "fan@example.com", rbac.User)
+	cm := models.Comment{ThreadID: 1, UserID: u.ID, Message: "m"}
+	db.Create(&cm)
+
+	if err := s.Report(cm.ID, u.ID, "rude"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Report(cm.ID, u.ID, "rude"); !errors.Is(err, ErrAlreadyReported) {
+		t.Fatalf("second report: err = %v, want ErrAlreadyReported", err)
+	}
+	// A soft-deleted report still holds the unique index.
+	db.Where("comment_id = ?", cm.ID).Delete(&models.CommentReport{})
+	if err := s.Report(cm.ID, u.ID, "rude"); !errors.Is(err, ErrAlreadyReported) {
+		t.Fatalf("report after delete: err = %v, want ErrAlreadyReported", err)
+	}
+}
+
+func TestQueueOrdersAndPagesInSQL(t *testing.T) {
+	db := newTestDB(t)
+	s := &ModerationService{DB: db}
+	author := createUser(t, db, "author@example.com", rbac.User)
+	var reporters []models.User
+	for _, e := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		reporters = append(reporters, createUser(t, db, e, rbac.User))
+	}
+	comment := func(held bool) models.Comment {
+		cm := models.Comment{ThreadID: 1, UserID: author.ID, Message: "m", Held: held, HeldReason: "filter"}
+		db.Create(&cm)
+		return cm
+	}
+	report := func(cm models.Comment, n int) {
+		for _, r := range reporters[:n] {
+			if err := s.Report(cm.ID, r.ID, "rude"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	once := comment(false)
+	report(once, 1)
+	comment(false) // not queued
+	thrice := comment(false)
+	report(thrice, 3)
+	held := comment(true)
+	twice := comment(false)
+	report(twice, 2)
+
+	var got []uint
+	for page := 1; page <= 3; page++ {
+		items, total, err := s.Queue(page, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 4 {
+			t.Fatalf("total = %d, want 4", total)
+		}
+		for _, it := range items {
+			got = append(got, it.Comment.ID)
+		}
+	}
+	want := []uint{held.ID, thrice.ID, twice.ID, once.ID}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("queue order = %v, want %v", got, want)
+	}
+
+	items, _, _ := s.Queue(1, 2)
+	if !items[0].Held || len(items[0].Reasons) != 1 || items[1].ReportCount != 3 || len(items[1].Reasons) != 3 {
+		t.Fatalf("first page = %+v", items)
+	}
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"project/internal/models"
+	"project/internal/oidc"
+	"project/internal/rbac"
+
+	"gorm.io/gorm"
+)
+
+// PurposeOIDCState signs the cookie that carries a sign-in between the
+// redirect to the provider and the callback.
+const PurposeOIDCState = "oidc_state"
+
+// RevokedAccountLinked is the session revocation reason when a provider
+// login takes over an unverified account.
+const RevokedAccountLinked = "account_linked"
+
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	ErrUnknownProvider     = errors.New("unknown identity provider")
+	ErrOIDCState           = errors.New("sign-in expired or was started in another browser; try again")
+	ErrOIDCNoEmail         = errors.New("the identity provider did not share an email address")
+	ErrOIDCEmailUnverified = errors.New("an account with this email already exists and the provider has not verified the address; log in with your password")
+)
+
+// ProviderInfo is a sign-in option shown on the login page.
+type ProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// oidcState travels in a signed cookie: it binds the callback to the
+// browser that started the sign-in and keeps the PKCE verifier and nonce
+// out of the URL.
+type oidcState struct {
+	Provider string `json:"p"`
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Next     string `json:"x,omitempty"`
+	Expires  int64  `json:"e"`
+}
+
+// OIDCProviders lists the configured providers.
+func (s *AuthService) OIDCProviders() []ProviderInfo {
+	out := make([]ProviderInfo, 0, len(s.Providers))
+	for _, p := range s.Providers {
+		out = append(out, ProviderInfo{Name: p.Name(), DisplayName: p.DisplayName()})
+	}
+	return out
+}
+
+func (s *AuthService) provider(name string) oidc.Provider {
+	for _, p := range s.Providers {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// BeginOIDC starts a sign-in with the named provider. It returns the
+// provider URL to send the browser to and the state cookie value; next is
+// where to go afterwards.
+func (s *AuthService) BeginOIDC(ctx context.Context, name, next string) (redirect, cookie string, err error) {
+	p := s.provider(name)
+	if p == nil {
+		return "", "", ErrUnknownProvider
+	}
+	st := oidcState{Provider: name, Next: next, Expires: time.Now().Add(oidcStateTTL).Unix()}
+	for _, v := range []*string{&st.State, &st.Nonce, &st.Verifier} {
+		if *v, err = oidc.RandomString(32); err != nil {
+			return "", "", err
+		}
+	}
+	redirect, err = p.AuthCodeURL(ctx, st.State, st.Nonce, oidc.Challenge(st.Verifier))
+	if err != nil {
+		return "", "", err
+	}
+	raw, err := json.Marshal(st)
+	if err != nil {
+		return "", "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return redirect, payload + "." + s.sign(PurposeOIDCState, payload), nil
+}
+
+// CompleteOIDC finishes a sign-in at the callback: it checks state against
+// the cookie, redeems the code and signs the user in, linking or creating
+// the account. It also returns the next path from BeginOIDC. Accounts with
+// 2FA get a *TwoFactorRequiredError instead of a session.
+func (s *AuthService) CompleteOIDC(ctx context.Context, name, code, state, cookie string, client ClientInfo) (*TokenPair, *models.User, string, error) {
+	st, err := s.readOIDCState(cookie)
+	if err != nil || st.Provider != name || !hmac.Equal([]byte(st.State), []byte(state)) {
+		return nil, nil, "", ErrOIDCState
+	}
+	p := s.provider(name)
+	if p == nil {
+		return nil, nil, st.Next, ErrUnknownProvider
+	}
+	id, err := p.Exchange(ctx, code, st.Verifier, st.Nonce)
+	if err != nil {
+		return nil, nil, st.Next, err
+	}
+	u, created, err := s.linkIdentity(id)
+	if err != nil {
+		return nil, nil, st.Next, err
+	}
+	if created && u.EmailVerifiedAt == nil {
+		if err := s.SendVerification(u.ID); err != nil {
+			log.Printf("oidc: verification email for user %d: %v", u.ID, err)
+		}
+	}
+	if u.TOTPEnabledAt != nil {
+		return nil, nil, st.Next, s.twoFactorChallenge(u)
+	}
+	pair, err := s.startSession(u, client, false)
+	if err != nil {
+		return nil, nil, st.Next, err
+	}
+	return pair, u, st.Next, nil
+}
+
+func (s *AuthService) readOIDCState(cookie string) (*oidcState, error) {
+	payload, sig, ok := strings.Cut(cookie, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(PurposeOIDCState, payload))) {
+		return nil, ErrOIDCState
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrOIDCState
+	}
+	var st oidcState
+	if err := json.Unmarshal(raw, &st); err != nil || time.Now().Unix() > st.Expires {
+		return nil, ErrOIDCState
+	}
+	return &st, nil
+}
+
+// linkIdentity finds the user for a provider identity. A known identity
+// signs in its user. Otherwise an existing account with the same email is
+// linked, but only if the provider verified the address, and a new account
+// is created when there is none. created reports the last case.
+func (s *AuthService) linkIdentity(id *oidc.Identity) (*models.User, bool, error) {
+	var (
+		u       models.User
+		created bool
+	)
+	now := time.Now()
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var ident models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", id.Provider, id.Subject).First(&ident).Error
+		if err == nil {
+			if err := tx.First(&u, ident.UserID).Error; err != nil {
+				return err
+			}
+			return tx.Model(&ident).Updates(map[string]interface{}{"last_login_at": now, "email": id.Email}).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if id.Email == "" {
+			return ErrOIDCNoEmail
+		}
+		err = tx.Where("email = ?", id.Email).First(&u).Error
+		switch {
+		case err == nil:
+			if !id.EmailVerified {
+				return ErrOIDCEmailUnverified
+			}
+			if u.EmailVerifiedAt == nil {
+				// Whoever registered this address never proved they own
+				// it, and the provider just did. Drop the password and
+				// sessions so someone who signed up with another
+				// person's email cannot keep access to the account.
+				if err := tx.Model(&u).Updates(map[string]interface{}{"email_verified_at": now, "password_hash": ""}).Error; err != nil {
+					return err
+				}
+				u.EmailVerifiedAt = &now
+				if err := tx.Model(&models.Session{}).
+					Where("user_id = ? AND revoked_at IS NULL", u.ID).
+					Updates(map[string]interface{}{"revoked_at": now, "revoked_reason": RevokedAccountLinked}).Error; err != nil {
+					return err
+				}
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// No password: the account signs in through the provider until
+			// the user sets one with a password reset.
+			u = models.User{Name: oidcName(id), Email: id.Email, Role: rbac.User}
+			if id.EmailVerified {
+				u.EmailVerifiedAt = &now
+			}
+			if err := tx.Create(&u).Error; err != nil {
+				return err
+			}
+			created = true
+		default:
+			return err
+		}
+		return tx.Create(&models.UserIdentity{
+			UserID:      u.ID,
+			Provider:    id.Provider,
+			Subject:     id.Subject,
+			Email:       id.Email,
+			LastLoginAt: now,
+		}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &u, created, nil
+}
+
+func oidcName(id *oidc.Identity) string {
+	name := strings.TrimSpace(id.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(id.Email, "@")
+	}
+	return truncate(name, 100)
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"project/internal/models"
+	"project/internal/oidc"
+)
+
+// withMockProvider configures s with an in-process mock provider.
+func withMockProvider(t *testing.T, s *AuthService) *oidc.Mock {
+	t.Helper()
+	const issuer = "http://localhost:8080/oidc-mock"
+	m, err := oidc.NewMock(issuer, "app", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Providers = []oidc.Provider{oidc.NewClient(oidc.Config{
+		Name: "mock", Issuer: issuer, ClientID: "app", ClientSecret: "s3cret",
+		RedirectURL: s.BaseURL + "/api/auth/oidc/mock/callback",
+	}, m.HTTPClient())}
+	return m
+}
+
+// oidcLogin signs in through the mock as email and returns what the
+// callback would.
+func oidcLogin(t *testing.T, s *AuthService, m *oidc.Mock, email string, verified bool) (*TokenPair, *models.User, error) {
+	t.Helper()
+	ctx := context.Background()
+	redirect, cookie, err := s.BeginOIDC(ctx, "mock", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(redirect)
+	q := u.Query()
+	q.Set("login_hint", email)
+	if !verified {
+		q.Set("email_verified", "false")
+	}
+	u.RawQuery = q.Encode()
+	hc := m.HTTPClient()
+	hc.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := hc.Get(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, err := resp.Location()
+	if err != nil {
+		t.Fatalf("authorize: status %d, no redirect", resp.StatusCode)
+	}
+	pair, user, _, err := s.CompleteOIDC(ctx, "mock", back.Query().Get("code"), back.Query().Get("state"), cookie, ClientInfo{})
+	return pair, user, err
+}
+
+func TestOIDCCreatesAndReusesAccount(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuth(db)
+	m := withMockProvider(t, s)
+
+	pair, u, err := oidcLogin(t, s, m, "new@example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.AccessToken == "" || u.EmailVerifiedAt == nil || u.PasswordHash != "" {
+		t.Fatalf("new account = %+v", u)
+	}
+	_, again, err := oidcLogin(t, s, m, "new@example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != u.ID {
+		t.Fatalf("second sign-in made user %d, want %d", again.ID, u.ID)
+	}
+	var n int64
+	db.Model(&models.UserIdentity{}).Where("user_id = ?", u.ID).Count(&n)
+	if n != 1 {
+		t.Fatalf("%d identities, want 1", n)
+	}
+}
+
+func TestOIDCStateMustMatch(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuth(db)
+	withMockProvider(t, s)
+	ctx := context.Background()
+
+	_, cookie, err := s.BeginOIDC(ctx, "mock", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := s.CompleteOIDC(ctx, "mock", "code", "forged", cookie, ClientInfo{}); !errors.Is(err, ErrOIDCState) {
+		t.Fatalf("wrong state: err = %v, want ErrOIDCState", err)
+	}
+	if _, _, _, err := s.CompleteOIDC(ctx, "mock", "code", "state", cookie+"x", ClientInfo{}); !errors.Is(err, ErrOIDCState) {
+		t.Fatalf("tampered cookie: err = %v, want ErrOIDCState", err)
+	}
+}
+
+func TestOIDCLinkTakesOverUnverifiedAccount(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuth(db)
+	m := withMockProvider(t, s)
+
+	// Someone registered the address without ever verifying it.
+	squatter := models.User{Name: "squatter", Email: "owner@example.com", Role: "user"}
+	db.Create(&squatter)
+	setPassword(t, db, &squatter, "password1")
+	old, _, err := s.Login("owner@example.com", "password1", ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, u, err := oidcLogin(t, s, m, "owner@example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != squatter.ID {
+		t.Fatalf("signed in as %d, want linked account %d", u.ID, squatter.ID)
+	}
+	var got models.User
+	db.First(&got, squatter.ID)
+	if got.PasswordHash != "" || got.EmailVerifiedAt == nil {
+		t.Fatalf("linked account kept its password or stayed unverified: %+v", got)
+	}
+	if _, _, err := s.Refresh(old.RefreshToken, ClientInfo{}); !errors.Is(err, ErrInvalidRefresh) {
+		t.Fatalf("old session refresh: err = %v, want ErrInvalidRefresh", err)
+	}
+	var revoked models.Session
+	db.Where("user_id = ? AND revoked_reason = ?", squatter.ID, RevokedAccountLinked).First(&revoked)
+	if revoked.ID == 0 {
+		t.Fatal("old session not revoked as account_linked")
+	}
+}
+
+func TestOIDCUnverifiedEmailDoesNotLink(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuth(db)
+	m := withMockProvider(t, s)
+	owner := createUser(t, db, "owner@example.com", "user")
+	setPassword(t, db, &owner, "password1")
+
+	if _, _, err := oidcLogin(t, s, m, "owner@example.com", false); !errors.Is(err, ErrOIDCEmailUnverified) {
+		t.Fatalf("err = %v, want ErrOIDCEmailUnverified", err)
+	}
+	var n int64
+	db.Model(&models.UserIdentity{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("%d identities linked, want 0", n)
+	}
+	if _, _, err := s.Login("owner@example.com", "password1", ClientInfo{}); err != nil {
+		t.Fatalf("owner can no longer log in: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"project/internal/models"
+	"project/internal/rbac"
+)
+
+func TestUpsertForClubStaysInOwnTeam(t *testing.T) {
+	db := newTestDB(t)
+	s := &PlayerService{DB: db}
+	home := models.Team{Name: "Home"}
+	away := models.Team{Name: "Away"}
+	db.Create(&home)
+	db.Create(&away)
+	official := createUser(t, db, "official@example.com", rbac.ClubOfficial)
+	db.Model(&official).Update("club_team_id", home.ID)
+	rival := models.Player{Name: "Rival", TeamID: away.ID}
+	db.Create(&rival)
+
+	own := models.Player{Name: "Striker", TeamID: home.ID}
+	if err := s.UpsertForClub(official.ID, &own); err != nil {
+		t.Fatalf("create own player: %v", err)
+	}
+	own.Position = "FW"
+	if err := s.UpsertForClub(official.ID, &own); err != nil {
+		t.Fatalf("edit own player: %v", err)
+	}
+
+	cases := map[string]models.Player{
+		"create in another team": {Name: "Signing", TeamID: away.ID},
+		"edit another team":      {Model: rival.Model, Name: "Renamed", TeamID: away.ID},
+		"move rival into team":   {Model: rival.Model, Name: "Poached", TeamID: home.ID},
+		"move own player out":    {Model: own.Model, Name: own.Name, TeamID: away.ID},
+	}
+	for name, p := range cases {
+		if err := s.UpsertForClub(official.ID, &p); !errors.Is(err, ErrNotYourClub) {
+			t.Errorf("%s: err = %v, want ErrNotYourClub", name, err)
+		}
+	}
+	var got models.Player
+	db.First(&got, rival.ID)
+	if got.Name != "Rival" || got.TeamID != away.ID {
+		t.Fatalf("rival player changed: %+v", got)
+	}
+}
+
+func TestUpsertForClubIgnoresNestedTeam(t *testing.T) {
+	db := newTestDB(t)
+	s := &PlayerService{DB: db}
+	home := models.Team{Name: "Home"}
+	db.Create(&home)
+	official := createUser(t, db, "official@example.com", rbac.ClubOfficial)
+	db.Model(&official).Update("club_team_id", home.ID)
+
+	p := models.Player{Name: "Keeper", TeamID: home.ID, Team: models.Team{Model: home.Model, Name: "Renamed"}}
+	if err := s.UpsertForClub(official.ID, &p); err != nil {
+		t.Fatal(err)
+	}
+	var team models.Team
+	db.First(&team, home.ID)
+	if team.Name != "Home" {
+		t.Fatalf("team renamed through a player: %q", team.Name)
+	}
+}
+
+func TestUpsertForClubNeedsATeam(t *testing.T) {
+	db := newTestDB(t)
+	s := &PlayerService{DB: db}
+	team := models.Team{Name: "Home"}
+	db.Create(&team)
+	official := createUser(t, db, "official@example.com", rbac.ClubOfficial)
+
+	if err := s.UpsertForClub(official.ID, &models.Player{Name: "Anyone", TeamID: team.ID}); !errors.Is(err, ErrNotYourClub) {
+		t.Fatalf("err = %v, want ErrNotYourClub", err)
+	}
+}
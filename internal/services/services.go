@@ -2,28 +2,57 @@ package services
 
 import (
 	"errors"
+	"log"
 	"strings"
 	"time"
 
-	"project/internal/cache"
 	"project/internal/database"
-	"project/internal/middleware"
+	"project/internal/jwtkeys"
+	"project/internal/mail"
 	"project/internal/models"
+	"project/internal/oidc"
+	"project/internal/rbac"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AuthService struct {
-	DB        *gorm.DB
+	DB *gorm.DB
+	// Keys signs access tokens. JWTSecret signs emailed links and login
+	// challenges, which never leave this server's hands.
+	Keys      *jwtkeys.Set
 	JWTSecret string
+	// AccessTTL and RefreshTTL default to 15 minutes and 30 days.
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	// Mailer sends verification and password reset links, which point at
+	// BaseURL. VerifyTTL and ResetTTL default to 48 hours and 1 hour.
+	Mailer    mail.Mailer
+	BaseURL   string
+	VerifyTTL time.Duration
+	ResetTTL  time.Duration
+	// Guard, when set, throttles repeated failed logins.
+	Guard *LoginGuard
+	// TOTPIssuer names the site in authenticator apps. With RequireAdmin2FA
+	// admins must sign in with a second factor to use admin endpoints.
+	TOTPIssuer      string
+	RequireAdmin2FA bool
+	// Providers are the OpenID Connect sign-in options, in display order.
+	Providers []oidc.Provider
 }
 
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
 func (s *AuthService) Register(name, email, password string) (*models.User, error) {
 	email = strings.TrimSpace(strings.ToLower(email))
 	if email == "" || password == "" || name == "" {
 		return nil, errors.New("missing fields")
 	}
+	if len(password) < minPasswordLength {
+		return nil, ErrWeakPassword
+	}
 	var exists models.User
 	if err := s.DB.Where("email = ?", email).First(&exists).Error; err == nil {
 		return nil, errors.New("email already registered")
@@ -36,24 +65,55 @@ func (s *AuthService) Register(name, email, password string) (*models.User, erro
 		Name:         name,
 		Email:        email,
 		PasswordHash: string(hash),
-		Role:         "user",
+		Role:         rbac.User,
 	}
 	if err := s.DB.Create(u).Error; err != nil {
 		return nil, err
 	}
+	// The account exists either way; the user can ask for another email.
+	if err := s.SendVerification(u.ID); err != nil {
+		log.Printf("auth: verification email to %s: %v", u.Email, err)
+	}
 	return u, nil
 }
 
-func (s *AuthService) Login(email, password string) (string, *models.User, error) {
+// Login checks credentials and starts a new session. For accounts with 2FA
+// it returns a *TwoFactorRequiredError carrying the challenge instead.
+func (s *AuthService) Login(email, password string, client ClientInfo) (*TokenPair, *models.User, error) {
+	if s.Guard != nil {
+		if err := s.Guard.Check(email, client.IP); err != nil {
+			return nil, nil, err
+		}
+	}
 	var u models.User
 	if err := s.DB.Where("email = ?", strings.ToLower(email)).First(&u).Error; err != nil {
-		return "", nil, errors.New("invalid credentials")
+		s.loginFailed(email, client.IP, 0)
+		return nil, nil, ErrInvalidCredentials
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
-		return "", nil, errors.New("invalid credentials")
+		s.loginFailed(email, client.IP, u.ID)
+		return nil, nil, ErrInvalidCredentials
+	}
+	if u.SuspendedAt != nil {
+		return nil, nil, ErrAccountSuspended
+	}
+	if u.TOTPEnabledAt != nil {
+		return nil, nil, s.twoFactorChallenge(&u)
+	}
+	if s.Guard != nil {
+		s.Guard.Succeeded(email)
+	}
+	pair, err := s.startSession(&u, client, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, &u, nil
+}
+
+func (s *AuthService) loginFailed(email, ip string, userID uint) {
+	if s.Guard != nil {
+		s.Guard.Failed(email, ip, userID)
 	}
-	token, err := middleware.GenerateToken(s.JWTSecret, u.ID, u.Role, 24*time.Hour)
-	return token, &u, err
 }
 
 type TeamService struct{ DB *gorm.DB }
@@ -64,6 +124,14 @@ func (s *TeamService) List() ([]models.Team, error) {
 	return teams, err
 }
 
+func (s *TeamService) Get(id uint) (*models.Team, error) {
+	var t models.Team
+	if err := s.DB.First(&t, id).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
 func (s *TeamService) Upsert(t *models.Team) error {
 	return s.DB.Save(t).Error
 }
@@ -84,7 +152,35 @@ func (s *PlayerService) Upsert(p *models.Player) error {
 	return s.DB.Save(p).Error
 }
 
-type MatchService struct{ DB *gorm.DB }
+// ErrNotYourClub is returned when a club official edits a player of
+// another team.
+var ErrNotYourClub = errors.New("club officials can only edit players of their own team")
+
+// UpsertForClub saves a player on behalf of a club official: the player
+// must belong to the official's team before and after the change. Nested
+// team and stats objects are ignored so the official cannot edit them
+// through the player.
+func (s *PlayerService) UpsertForClub(officialID uint, p *models.Player) error {
+	var u models.User
+	if err := s.DB.First(&u, officialID).Error; err != nil {
+		return err
+	}
+	if u.ClubTeamID == nil || p.TeamID != *u.ClubTeamID {
+		return ErrNotYourClub
+	}
+	if p.ID != 0 {
+		var existing models.Player
+		if err := s.DB.First(&existing, p.ID).Error; err != nil || existing.TeamID != *u.ClubTeamID {
+			return ErrNotYourClub
+		}
+	}
+	return s.DB.Omit(clause.Associations).Save(p).Error
+}
+
+type MatchService struct {
+	DB     *gorm.DB
+	Events *EventBus
+}
 
 func (s *MatchService) List() ([]models.Match, error) {
 	var m []models.Match
@@ -92,54 +188,91 @@ func (s *MatchService) List() ([]models.Match, error) {
 	return m, err
 }
 
-func (s *MatchService) UpdateResult(id uint, home, away int, status string) error {
-	return s.DB.Model(&models.Match{}).Where("id = ?", id).
-		Updates(map[string]interface{}{"home_score": home, "away_score": away, "status": status}).Error
+// Get returns one match, or gorm.ErrRecordNotFound.
+func (s *MatchService) Get(id uint) (*models.Match, error) {
+	var m models.Match
+	if err := s.DB.First(&m, id).Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
 }
 
-type TableRow struct {
-	TeamID   uint   `json:"team_id"`
-	Team     string `json:"team"`
-	Played   int    `json:"played"`
-	Points   int    `json:"points"`
-	GoalDiff int    `json:"gd"`
+// LatestLive returns the live match that kicked off last, or
+// gorm.ErrRecordNotFound when none is being played.
+func (s *MatchService) LatestLive() (*models.Match, error) {
+	var m models.Match
+	if err := s.DB.Where("status = ?", "live").Order("date desc").First(&m).Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
 }
 
-type TableService struct{ DB *gorm.DB }
+// ForTeams returns every match involving any of the given teams, ordered by
+// kick-off.
+func (s *MatchService) ForTeams(teamIDs []uint) ([]models.Match, error) {
+	var m []models.Match
+	err := s.DB.Preload("HomeTeam").Preload("AwayTeam").
+		Where("home_team_id IN ? OR away_team_id IN ?", teamIDs, teamIDs).
+		Order("date asc").Find(&m).Error
+	return m, err
+}
 
-var tableCache = cache.New()
+// Errors UpdateResult returns for a result it will not store.
+var (
+	ErrInvalidStatus = errors.New("status must be upcoming, live or finished")
+	ErrNegativeScore = errors.New("scores cannot be negative")
+)
 
-func (s *TableService) Compute() ([]TableRow, error) {
-	var rows []TableRow
-	// Try Redis first
-	found, err := cache.GetRedis("league_table", &rows)
-	if err == nil && found {
-		return rows, nil
+// UpdateResult sets a match's score and status and publishes
+// EventMatchResultChanged. The bus is synchronous on purpose: when this
+// returns, the table, match threads and live subscribers have all seen the
+// new result, so the next read agrees with it. Subscribers log their own
+// failures; they never fail the update. An unknown id returns
+// gorm.ErrRecordNotFound.
+func (s *MatchService) UpdateResult(id uint, home, away int, status string) error {
+	switch status {
+	case "upcoming", "live", "finished":
+	default:
+		return ErrInvalidStatus
 	}
-	// Fallback to in-memory
-	if v, ok := tableCache.Get("league_table"); ok {
-		if cachedRows, ok2 := v.([]TableRow); ok2 {
-			return cachedRows, nil
-		}
+	if home < 0 || away < 0 {
+		return ErrNegativeScore
 	}
-	var teams []models.Team
-	if err := s.DB.Order("points desc, goal_diff desc").Find(&teams).Error; err != nil {
-		return nil, err
+	var m models.Match
+	if err := s.DB.First(&m, id).Error; err != nil {
+		return err
+	}
+	changed, err := setResult(s.DB, &m, home, away, status)
+	if err != nil {
+		return err
+	}
+	s.Events.Publish(Event{Name: EventMatchResultChanged, Payload: changed})
+	return nil
+}
+
+// setResult writes a score and status onto m through db, which may be a
+// transaction, and returns the event to publish once it is committed.
+func setResult(db *gorm.DB, m *models.Match, home, away int, status string) (MatchResultChanged, error) {
+	prev := m.Status
+	changes := map[string]interface{}{"home_score": home, "away_score": away, "status": status}
+	switch {
+	case status == "finished" && prev != "finished":
+		changes["finished_at"] = time.Now()
+	case status != "finished":
+		changes["finished_at"] = nil
+	}
+	if err := db.Model(m).Updates(changes).Error; err != nil {
+		return MatchResultChanged{}, err
 	}
-	rows = make([]TableRow, 0, len(teams))
-	for _, t := range teams {
-		rows = append(rows, TableRow{
-			TeamID:   t.ID,
-			Team:     t.Name,
-			Played:   t.MatchesPlayed,
-			Points:   t.Points,
-			GoalDiff: t.GoalDiff,
-		})
-	}
-	// Set both Redis and in-memory cache
-	_ = cache.SetRedis("league_table", rows, 30*time.Second)
-	tableCache.Set("league_table", rows, 30*time.Second)
-	return rows, nil
+	return MatchResultChanged{
+		MatchID:        m.ID,
+		HomeTeamID:     m.HomeTeamID,
+		AwayTeamID:     m.AwayTeamID,
+		HomeScore:      home,
+		AwayScore:      away,
+		Status:         status,
+		PreviousStatus: prev,
+	}, nil
 }
 
 func DB() *gorm.DB { return database.DB }
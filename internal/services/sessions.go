@@ -0,0 +1,300 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"project/internal/middleware"
+	"project/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Session revocation reasons.
+const (
+	RevokedLogout    = "logout"
+	RevokedLogoutAll = "logout_all"
+	RevokedReuse     = "refresh_reuse"
+	RevokedByUser    = "revoked"
+)
+
+var (
+	ErrInvalidRefresh  = errors.New("invalid or expired refresh token")
+	ErrRefreshReused   = errors.New("refresh token was already used; session revoked")
+	ErrSessionRevoked  = errors.New("session revoked")
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// touchEvery limits how often a session's last activity is written back.
+const touchEvery = time.Minute
+
+// ClientInfo describes the device a session was started from.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// TokenPair is what a client gets from login and refresh. The access token
+// keeps its old "token" JSON name so existing clients keep working.
+type TokenPair struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refreshToken"`
+	ExpiresIn    int       `json:"expiresIn"` // access token lifetime, seconds
+	SessionID    uint      `json:"-"`
+	RefreshUntil time.Time `json:"-"`
+}
+
+func (s *AuthService) accessTTL() time.Duration {
+	if s.AccessTTL > 0 {
+		return s.AccessTTL
+	}
+	return 15 * time.Minute
+}
+
+func (s *AuthService) refreshTTL() time.Duration {
+	if s.RefreshTTL > 0 {
+		return s.RefreshTTL
+	}
+	return 30 * 24 * time.Hour
+}
+
+// startSession opens a session; twoFactor records that the user passed a
+// second factor. Suspended users never get one, whichever way they sign in.
+func (s *AuthService) startSession(u *models.User, client ClientInfo, twoFactor bool) (*TokenPair, error) {
+	if u.SuspendedAt != nil {
+		return nil, ErrAccountSuspended
+	}
+	now := time.Now()
+	sess := models.Session{
+		UserID:     u.ID,
+		TwoFactor:  twoFactor,
+		UserAgent:  truncate(client.UserAgent, 255),
+		IP:         truncate(client.IP, 64),
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(s.refreshTTL()),
+	}
+	var raw string
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&sess).Error; err != nil {
+			return err
+		}
+		var err error
+		raw, err = issueRefresh(tx, sess.ID, sess.ExpiresAt)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.pair(u, &sess, raw)
+}
+
+// Refresh exchanges a refresh token for a new token pair. Each refresh
+// token works once: presenting one that was already exchanged means it was
+// copied, so the whole session is revoked and both holders are signed out.
+func (s *AuthService) Refresh(raw string, client ClientInfo) (*TokenPair, *models.User, error) {
+	if raw == "" {
+		return nil, nil, ErrInvalidRefresh
+	}
+	now := time.Now()
+	var (
+		sess   models.Session
+		u      models.User
+		newRaw string
+		reused bool
+	)
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var rt models.RefreshToken
+		if err := tx.Where("token_hash = ?", hashToken(raw)).First(&rt).Error; err != nil {
+			return ErrInvalidRefresh
+		}
+		if err := tx.First(&sess, rt.SessionID).Error; err != nil {
+			return ErrInvalidRefresh
+		}
+		if sess.RevokedAt != nil || now.After(sess.ExpiresAt) {
+			return ErrInvalidRefresh
+		}
+		// Claim the token with a conditional update so two concurrent
+		// refreshes cannot both succeed.
+		res := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", rt.ID).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			reused = true
+			return revokeSession(tx, sess.ID, RevokedReuse, now)
+		}
+		if now.After(rt.ExpiresAt) {
+			return ErrInvalidRefresh
+		}
+		if err := tx.First(&u, sess.UserID).Error; err != nil {
+			return ErrInvalidRefresh
+		}
+		sess.LastUsedAt = now
+		sess.ExpiresAt = now.Add(s.refreshTTL())
+		updates := map[string]interface{}{"last_used_at": sess.LastUsedAt, "expires_at": sess.ExpiresAt}
+		if client.UserAgent != "" {
+			updates["user_agent"] = truncate(client.UserAgent, 255)
+		}
+		if client.IP != "" {
+			updates["ip"] = truncate(client.IP, 64)
+		}
+		if err := tx.Model(&sess).Updates(updates).Error; err != nil {
+			return err
+		}
+		var err error
+		newRaw, err = issueRefresh(tx, sess.ID, sess.ExpiresAt)
+		return err
+	})
+	if reused {
+		return nil, nil, ErrRefreshReused
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	pair, err := s.pair(&u, &sess, newRaw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, &u, nil
+}
+
+// Logout revokes one session.
+func (s *AuthService) Logout(sessionID uint) error {
+	return revokeSession(s.DB, sessionID, RevokedLogout, time.Now())
+}
+
+// LogoutRefresh revokes the session a refresh token belongs to, for clients
+// that only hold the refresh cookie.
+func (s *AuthService) LogoutRefresh(raw string) error {
+	var rt models.RefreshToken
+	if err := s.DB.Where("token_hash = ?", hashToken(raw)).First(&rt).Error; err != nil {
+		return ErrInvalidRefresh
+	}
+	return s.Logout(rt.SessionID)
+}
+
+// LogoutAll revokes every active session of the user and returns how many
+// were signed out.
+func (s *AuthService) LogoutAll(userID uint) (int64, error) {
+	res := s.DB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": RevokedLogoutAll})
+	return res.RowsAffected, res.Error
+}
+
+// SessionActive is the middleware.SessionChecker for access tokens. It also
+// records the session's last activity, at most once per touchEvery.
+func (s *AuthService) SessionActive(sessionID uint) bool {
+	now := time.Now()
+	var n int64
+	s.DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, now).
+		Count(&n)
+	if n == 0 {
+		return false
+	}
+	s.DB.Model(&models.Session{}).
+		Where("id = ? AND last_used_at < ?", sessionID, now.Add(-touchEvery)).
+		UpdateColumn("last_used_at", now)
+	return true
+}
+
+// SessionView is one signed-in device as shown on the account page.
+type SessionView struct {
+	ID         uint      `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+// Sessions lists the user's active sessions, most recently used first.
+// currentID marks the session the request came from.
+func (s *AuthService) Sessions(userID, currentID uint) ([]SessionView, error) {
+	var list []models.Session
+	err := s.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at desc").Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	out := make([]SessionView, 0, len(list))
+	for _, sess := range list {
+		out = append(out, SessionView{
+			ID:         sess.ID,
+			UserAgent:  sess.UserAgent,
+			IP:         sess.IP,
+			CreatedAt:  sess.CreatedAt,
+			LastUsedAt: sess.LastUsedAt,
+			ExpiresAt:  sess.ExpiresAt,
+			Current:    sess.ID == currentID,
+		})
+	}
+	return out, nil
+}
+
+// RevokeSession signs one of the user's devices out. Other users' sessions
+// are reported as not found.
+func (s *AuthService) RevokeSession(userID, sessionID uint) error {
+	res := s.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": RevokedByUser})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *AuthService) pair(u *models.User, sess *models.Session, refresh string) (*TokenPair, error) {
+	access, err := middleware.GenerateToken(s.Keys, u.ID, sess.ID, u.Role, sess.TwoFactor, s.accessTTL())
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(s.accessTTL() / time.Second),
+		SessionID:    sess.ID,
+		RefreshUntil: sess.ExpiresAt,
+	}, nil
+}
+
+func revokeSession(db *gorm.DB, sessionID uint, reason string, at time.Time) error {
+	return db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Updates(map[string]interface{}{"revoked_at": at, "revoked_reason": reason}).Error
+}
+
+func revokeUserSessions(tx *gorm.DB, userID uint, reason string, at time.Time) error {
+	return tx.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": at, "revoked_reason": reason}).Error
+}
+
+func issueRefresh(tx *gorm.DB, sessionID uint, expires time.Time) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	raw := hex.EncodeToString(b)
+	rt := models.RefreshToken{SessionID: sessionID, TokenHash: hashToken(raw), ExpiresAt: expires}
+	if err := tx.Create(&rt).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"project/internal/middleware"
+	"project/internal/models"
+)
+
+func TestRefreshRotatesAndDetectsReuse(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuth(db)
+	u := createUser(t, db, "fan@example.com", "user")
+	setPassword(t, db, &u, "password1")
+
+	first, _, err := s.Login("fan@example.com", "password1", ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := s.Refresh(first.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.SessionID != first.SessionID {
+		t.Fatalf("refresh did not rotate the token within the session")
+	}
+	claims, err := middleware.ParseToken(s.Keys, second.AccessToken)
+	if err != nil || claims.SessionID != first.SessionID {
+		t.Fatalf("access token: %+v, %v", claims, err)
+	}
+
+	// Replaying the first token means it leaked: the session ends for
+	// everyone holding it.
+	if _, _, err := s.Refresh(first.RefreshToken, ClientInfo{}); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("reuse: err = %v, want ErrRefreshReused", err)
+	}
+	if s.SessionActive(first.SessionID) {
+		t.Fatal("session still active after reuse")
+	}
+	if _, _, err := s.Refresh(second.RefreshToken, ClientInfo{}); !errors.Is(err, ErrInvalidRefresh) {
+		t.Fatalf("refresh after reuse: err = %v, want ErrInvalidRefresh", err)
+	}
+	var sess models.Session
+	db.First(&sess, first.SessionID)
+	if sess.RevokedReason != RevokedReuse {
+		t.Fatalf("revoked reason = %q, want %q", sess.RevokedReason, RevokedReuse)
+	}
+}
+
+func TestLogoutAllEndsEverySession(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuth(db)
+	u := createUser(t, db, "fan@example.com", "user")
+	setPassword(t, db, &u, "password1")
+
+	a, _, _ := s.Login("fan@example.com", "password1", ClientInfo{})
+	b, _, _ := s.Login("fan@example.com", "password1", ClientInfo{})
+	if n, err := s.LogoutAll(u.ID); err != nil || n != 2 {
+		t.Fatalf("LogoutAll = %d, %v", n, err)
+	}
+	for _, p := range []*TokenPair{a, b} {
+		if s.SessionActive(p.SessionID) {
+			t.Errorf("session %d still active", p.SessionID)
+		}
+		if _, _, err := s.Refresh(p.RefreshToken, ClientInfo{}); !errors.Is(err, ErrInvalidRefresh) {
+			t.Errorf("refresh after logout: err = %v", err)
+		}
+	}
+}
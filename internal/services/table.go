@@ -0,0 +1,334 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"project/internal/cache"
+	"project/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type TableRow struct {
+	TeamID       uint   `json:"team_id"`
+	Team         string `json:"team"`
+	Played       int    `json:"played"`
+	Won          int    `json:"won"`
+	Drawn        int    `json:"drawn"`
+	Lost         int    `json:"lost"`
+	GoalsFor     int    `json:"gf"`
+	GoalsAgainst int    `json:"ga"`
+	Points       int    `json:"points"`
+	GoalDiff     int    `json:"gd"`
+	// TieBreak names the rule that ranked this team below the row above it
+	// when both are level on points. Empty when points alone decide.
+	TieBreak string `json:"tie_break,omitempty"`
+	// PlayOff is set when the team cannot be separated from a neighbour by
+	// any rule and a play-off would decide the position.
+	PlayOff bool `json:"play_off,omitempty"`
+	// Live is set in the as-it-stands table for teams playing right now.
+	Live bool `json:"live"`
+	// ProvisionalPoints, ProvisionalPlayed and ProvisionalGoalDiff count
+	// the current score of a live match as final. They equal Points, Played
+	// and GoalDiff when the team is not playing.
+	ProvisionalPoints   int `json:"provisional_points"`
+	ProvisionalPlayed   int `json:"provisional_played"`
+	ProvisionalGoalDiff int `json:"provisional_gd"`
+
+	h2hPoints    int
+	h2hAwayGoals int
+}
+
+// Tie-break rules in the order the Premier League applies them.
+const (
+	TieBreakGoalDiff     = "goal_difference"
+	TieBreakGoalsFor     = "goals_scored"
+	TieBreakHeadToHead   = "head_to_head_points"
+	TieBreakHeadToHeadAG = "head_to_head_away_goals"
+	TieBreakPlayOff      = "play_off"
+)
+
+type TableService struct{ DB *gorm.DB }
+
+var tableCache = cache.New()
+
+// Invalidate drops the cached table from Redis and from memory.
+func (s *TableService) Invalidate() {
+	_ = cache.DelRedis("league_table")
+	tableCache.Delete("league_table")
+}
+
+// Subscribe hooks the table into the event bus: every result change
+// updates the team counters, invalidates both cache layers, recomputes the
+// table and publishes the new as-it-stands standings.
+func (s *TableService) Subscribe(bus *EventBus) {
+	bus.Subscribe(EventMatchResultChanged, func(Event) {
+		if err := s.SyncTeamCounters(); err != nil {
+			log.Printf("team counters: %v", err)
+		}
+		s.Invalidate()
+		rows, err := s.LiveTable()
+		if err != nil {
+			log.Printf("table recompute: %v", err)
+			return
+		}
+		bus.Publish(Event{Name: EventStandingsUpdated, Payload: StandingsUpdated{Rows: rows}})
+	})
+}
+
+// Compute builds the league table from every finished match. It only
+// reads; the Points/MatchesPlayed/GoalDiff columns on teams are synced by
+// SyncTeamCounters and never read back here.
+func (s *TableService) Compute() ([]TableRow, error) {
+	var rows []TableRow
+	// Try Redis first
+	found, err := cache.GetRedis("league_table", &rows)
+	if err == nil && found {
+		return rows, nil
+	}
+	// Fallback to in-memory
+	if v, ok := tableCache.Get("league_table"); ok {
+		if cachedRows, ok2 := v.([]TableRow); ok2 {
+			return cachedRows, nil
+		}
+	}
+	var teams []models.Team
+	if err := s.DB.Find(&teams).Error; err != nil {
+		return nil, err
+	}
+	var matches []models.Match
+	if err := s.DB.Where("status = ?", "finished").Find(&matches).Error; err != nil {
+		return nil, err
+	}
+	rows = BuildTable(teams, matches)
+	for i := range rows {
+		rows[i].ProvisionalPoints, rows[i].ProvisionalPlayed, rows[i].ProvisionalGoalDiff = rows[i].Points, rows[i].Played, rows[i].GoalDiff
+	}
+	// Set both Redis and in-memory cache
+	_ = cache.SetRedis("league_table", rows, 30*time.Second)
+	tableCache.Set("league_table", rows, 30*time.Second)
+	return rows, nil
+}
+
+// LiveTable is the "as it stands" table: matches with status live count with
+// their current score for ordering and the Provisional columns, while the
+// other columns stay official. It is not cached since it moves with every goal.
+func (s *TableService) LiveTable() ([]TableRow, error) {
+	var live []models.Match
+	if err := s.DB.Where("status = ?", "live").Find(&live).Error; err != nil {
+		return nil, err
+	}
+	if len(live) == 0 {
+		return s.Compute()
+	}
+	var teams []models.Team
+	if err := s.DB.Find(&teams).Error; err != nil {
+		return nil, err
+	}
+	var finished []models.Match
+	if err := s.DB.Where("status = ?", "finished").Find(&finished).Error; err != nil {
+		return nil, err
+	}
+	official := make(map[uint]TableRow, len(teams))
+	for _, r := range BuildTable(teams, finished) {
+		official[r.TeamID] = r
+	}
+	playing := make(map[uint]bool, len(live)*2)
+	asItStands := append([]models.Match{}, finished...)
+	for _, m := range live {
+		playing[m.HomeTeamID] = true
+		playing[m.AwayTeamID] = true
+		home, away := 0, 0
+		if m.HomeScore != nil {
+			home = *m.HomeScore
+		}
+		if m.AwayScore != nil {
+			away = *m.AwayScore
+		}
+		m.HomeScore, m.AwayScore, m.Status = &home, &away, "finished"
+		asItStands = append(asItStands, m)
+	}
+	rows := BuildTable(teams, asItStands)
+	for i, r := range rows {
+		o := official[r.TeamID]
+		o.TieBreak, o.PlayOff = r.TieBreak, r.PlayOff
+		o.Live = playing[r.TeamID]
+		o.ProvisionalPoints, o.ProvisionalPlayed, o.ProvisionalGoalDiff = r.Points, r.Played, r.GoalDiff
+		rows[i] = o
+	}
+	return rows, nil
+}
+
+// BuildTable aggregates finished matches into table rows ordered by the
+// Premier League rules: points, goal difference, goals scored, then
+// head-to-head points and head-to-head away goals among the tied teams.
+// Every team gets a row, even before it has played. Matches without both
+// scores set or involving unknown teams are ignored.
+func BuildTable(teams []models.Team, matches []models.Match) []TableRow {
+	rows := make([]TableRow, 0, len(teams))
+	index := make(map[uint]int, len(teams))
+	for _, t := range teams {
+		index[t.ID] = len(rows)
+		rows = append(rows, TableRow{TeamID: t.ID, Team: t.Name})
+	}
+	for _, m := range matches {
+		if m.Status != "finished" || m.HomeScore == nil || m.AwayScore == nil {
+			continue
+		}
+		hi, okH := index[m.HomeTeamID]
+		ai, okA := index[m.AwayTeamID]
+		if !okH || !okA {
+			continue
+		}
+		rows[hi].addResult(*m.HomeScore, *m.AwayScore)
+		rows[ai].addResult(*m.AwayScore, *m.HomeScore)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		if a.GoalDiff != b.GoalDiff {
+			return a.GoalDiff > b.GoalDiff
+		}
+		if a.GoalsFor != b.GoalsFor {
+			return a.GoalsFor > b.GoalsFor
+		}
+		return a.Team < b.Team
+	})
+	for start := 0; start < len(rows); {
+		end := start + 1
+		for end < len(rows) && levelOnOverall(rows[start], rows[end]) {
+			end++
+		}
+		if end-start > 1 {
+			applyHeadToHead(rows[start:end], matches)
+		}
+		start = end
+	}
+	labelTieBreaks(rows)
+	return rows
+}
+
+func levelOnOverall(a, b TableRow) bool {
+	return a.Points == b.Points && a.GoalDiff == b.GoalDiff && a.GoalsFor == b.GoalsFor
+}
+
+// applyHeadToHead orders a group of teams level on points, goal difference
+// and goals scored by a mini-league of the matches played between them.
+func applyHeadToHead(group []TableRow, matches []models.Match) {
+	members := make(map[uint]int, len(group))
+	for i := range group {
+		members[group[i].TeamID] = i
+	}
+	for _, m := range matches {
+		if m.Status != "finished" || m.HomeScore == nil || m.AwayScore == nil {
+			continue
+		}
+		hi, okH := members[m.HomeTeamID]
+		ai, okA := members[m.AwayTeamID]
+		if !okH || !okA {
+			continue
+		}
+		home, away := *m.HomeScore, *m.AwayScore
+		group[ai].h2hAwayGoals += away
+		switch {
+		case home > away:
+			group[hi].h2hPoints += 3
+		case home < away:
+			group[ai].h2hPoints += 3
+		default:
+			group[hi].h2hPoints++
+			group[ai].h2hPoints++
+		}
+	}
+	sort.SliceStable(group, func(i, j int) bool {
+		a, b := group[i], group[j]
+		if a.h2hPoints != b.h2hPoints {
+			return a.h2hPoints > b.h2hPoints
+		}
+		if a.h2hAwayGoals != b.h2hAwayGoals {
+			return a.h2hAwayGoals > b.h2hAwayGoals
+		}
+		return a.Team < b.Team
+	})
+}
+
+// labelTieBreaks records on each row which rule separated it from the row
+// above, flagging teams that only a play-off could split.
+func labelTieBreaks(rows []TableRow) {
+	for i := 1; i < len(rows); i++ {
+		prev, cur := &rows[i-1], &rows[i]
+		switch {
+		case prev.Played == 0 && cur.Played == 0:
+			// nothing to separate before a ball is kicked
+		case prev.Points != cur.Points:
+			// decided on points, no tie-break involved
+		case prev.GoalDiff != cur.GoalDiff:
+			cur.TieBreak = TieBreakGoalDiff
+		case prev.GoalsFor != cur.GoalsFor:
+			cur.TieBreak = TieBreakGoalsFor
+		case prev.h2hPoints != cur.h2hPoints:
+			cur.TieBreak = TieBreakHeadToHead
+		case prev.h2hAwayGoals != cur.h2hAwayGoals:
+			cur.TieBreak = TieBreakHeadToHeadAG
+		default:
+			cur.TieBreak = TieBreakPlayOff
+			prev.PlayOff = true
+			cur.PlayOff = true
+		}
+	}
+}
+
+func (r *TableRow) addResult(scored, conceded int) {
+	r.Played++
+	r.GoalsFor += scored
+	r.GoalsAgainst += conceded
+	r.GoalDiff = r.GoalsFor - r.GoalsAgainst
+	switch {
+	case scored > conceded:
+		r.Won++
+		r.Points += 3
+	case scored == conceded:
+		r.Drawn++
+		r.Points++
+	default:
+		r.Lost++
+	}
+}
+
+// SyncTeamCounters writes the derived totals back onto teams whose stored
+// counters have drifted, so /api/teams agrees with the table. It runs on
+// every result change and once at startup.
+func (s *TableService) SyncTeamCounters() error {
+	var teams []models.Team
+	if err := s.DB.Find(&teams).Error; err != nil {
+		return err
+	}
+	var matches []models.Match
+	if err := s.DB.Where("status = ?", "finished").Find(&matches).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]models.Team, len(teams))
+	for _, t := range teams {
+		byID[t.ID] = t
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, r := range BuildTable(teams, matches) {
+			t := byID[r.TeamID]
+			if t.Points == r.Points && t.MatchesPlayed == r.Played && t.GoalDiff == r.GoalDiff {
+				continue
+			}
+			if err := tx.Model(&models.Team{}).Where("id = ?", r.TeamID).Updates(map[string]interface{}{
+				"points":         r.Points,
+				"matches_played": r.Played,
+				"goal_diff":      r.GoalDiff,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"testing"
+
+	"project/internal/cache"
+	"project/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// createTeams stores one team per name and returns them in order.
+func createTeams(t *testing.T, db *gorm.DB, names ...string) []models.Team {
+	t.Helper()
+	teams := make([]models.Team, len(names))
+	for i, n := range names {
+		teams[i] = models.Team{Name: n}
+		if err := db.Create(&teams[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return teams
+}
+
+// resetTableCache drops the in-memory table cache before and after a test.
+func resetTableCache(t *testing.T) {
+	tableCache = cache.New()
+	t.Cleanup(func() { tableCache = cache.New() })
+}
+
+// result is a finished match between two teams.
+func result(home, away models.Team, hs, as int) models.Match {
+	return models.Match{HomeTeamID: home.ID, AwayTeamID: away.ID, HomeScore: &hs, AwayScore: &as, Status: "finished"}
+}
+
+func TestComputeOnlyReadsAndSyncUpdatesCounters(t *testing.T) {
+	db := newTestDB(t)
+	s := &TableService{DB: db}
+	resetTableCache(t)
+	teams := createTeams(t, db, "Arsenal", "Chelsea")
+	m := result(teams[0], teams[1], 2, 0)
+	db.Create(&m)
+
+	if _, err := s.Compute(); err != nil {
+		t.Fatal(err)
+	}
+	var stored models.Team
+	db.First(&stored, teams[0].ID)
+	if stored.Points != 0 {
+		t.Fatalf("Compute wrote team counters: %d points", stored.Points)
+	}
+
+	if err := s.SyncTeamCounters(); err != nil {
+		t.Fatal(err)
+	}
+	db.First(&stored, teams[0].ID)
+	if stored.Points != 3 || stored.MatchesPlayed != 1 || stored.GoalDiff != 2 {
+		t.Fatalf("synced counters = %d pts, %d played, %+d gd", stored.Points, stored.MatchesPlayed, stored.GoalDiff)
+	}
+}
+
+func TestTableTieBreaks(t *testing.T) {
+	type game struct{ home, away, hs, as int }
+	cases := []struct {
+		name     string
+		games    []game
+		order    []string
+		tieBreak []string
+		playOff  []bool
+	}{
+		{
+			name:     "points",
+			games:    []game{{0, 1, 1, 0}, {0, 2, 1, 0}, {0, 3, 1, 0}, {1, 2, 1, 0}, {1, 3, 1, 0}, {2, 3, 1, 0}},
+			order:    []string{"A", "B", "C", "D"},
+			tieBreak: []string{"", "", "", ""},
+		},
+		{
+			name:     "goal difference",
+			games:    []game{{0, 2, 3, 0}, {1, 3, 1, 0}},
+			order:    []string{"A", "B", "D", "C"},
+			tieBreak: []string{"", TieBreakGoalDiff, "", TieBreakGoalDiff},
+		},
+		{
+			name:     "goals scored",
+			games:    []game{{0, 2, 3, 1}, {1, 3, 2, 0}},
+			order:    []string{"A", "B", "C", "D"},
+			tieBreak: []string{"", TieBreakGoalsFor, "", TieBreakGoalsFor},
+		},
+		{
+			// A and B are level overall; B won the match between them.
+			name:     "head-to-head points",
+			games:    []game{{0, 1, 0, 1}, {0, 3, 1, 0}, {1, 2, 0, 1}},
+			order:    []string{"C", "B", "A", "D"},
+			tieBreak: []string{"", TieBreakGoalDiff, TieBreakHeadToHead, ""},
+		},
+		{
+			// Two draws; B scored more goals away from home.
+			name:     "head-to-head away goals",
+			games:    []game{{0, 1, 2, 2}, {1, 0, 1, 1}},
+			order:    []string{"B", "A", "C", "D"},
+			tieBreak: []string{"", TieBreakHeadToHeadAG, "", ""},
+		},
+		{
+			// A, B and C are level on 7 points, 5 scored and 3 conceded;
+			// their mini-league has C on 4, B on 3 and A on 1.
+			name: "three-way head-to-head",
+			games: []game{
+				{2, 1, 1, 0}, {2, 0, 1, 1}, {1, 0, 1, 0},
+				{2, 3, 3, 2}, {1, 3, 3, 1}, {1, 3, 1, 1}, {0, 3, 3, 1}, {0, 3, 1, 0},
+			},
+			order:    []string{"C", "B", "A", "D"},
+			tieBreak: []string{"", TieBreakHeadToHead, TieBreakHeadToHead, ""},
+		},
+		{
+			// Level on everything, including away goals. C and D have not
+			// played and are not flagged.
+			name:     "play-off",
+			games:    []game{{0, 1, 1, 1}, {1, 0, 1, 1}},
+			order:    []string{"A", "B", "C", "D"},
+			tieBreak: []string{"", TieBreakPlayOff, "", ""},
+			playOff:  []bool{true, true, false, false},
+		},
+		{
+			name:     "nobody has played",
+			order:    []string{"A", "B", "C", "D"},
+			tieBreak: []string{"", "", "", ""},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newTestDB(t)
+			s := &TableService{DB: db}
+			resetTableCache(t)
+			teams := createTeams(t, db, "A", "B", "C", "D")
+			for _, g := range tc.games {
+				m := result(teams[g.home], teams[g.away], g.hs, g.as)
+				if err := db.Create(&m).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			rows, err := s.Compute()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, r := range rows {
+				if r.Team != tc.order[i] || r.TieBreak != tc.tieBreak[i] {
+					t.Errorf("row %d = %s (%q), want %s (%q)", i+1, r.Team, r.TieBreak, tc.order[i], tc.tieBreak[i])
+				}
+				if want := tc.playOff != nil && tc.playOff[i]; r.PlayOff != want {
+					t.Errorf("row %d (%s): play-off = %v, want %v", i+1, r.Team, r.PlayOff, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"project/internal/filter"
+	"project/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxCommentLength = 2000
+	// MaxCommentDepth is the deepest reply allowed; top-level comments are
+	// depth 0.
+	MaxCommentDepth = 8
+)
+
+// Comment listing sort modes.
+const (
+	SortNew           = "new"
+	SortOld           = "old"
+	SortTop           = "top"
+	SortControversial = "controversial"
+)
+
+var (
+	ErrThreadNotFound  = errors.New("thread not found")
+	ErrCommentNotFound = errors.New("comment not found")
+	ErrEmptyComment    = errors.New("message is required")
+	ErrCommentTooLong  = errors.New("message is too long")
+	ErrTooDeep         = errors.New("reply nesting is too deep")
+	ErrInvalidVote     = errors.New("vote must be 1, -1 or 0")
+	ErrCommentRejected = errors.New("comment rejected")
+	ErrPostingTooFast  = errors.New("you are posting too fast")
+)
+
+// ThreadService manages threads and comments. New comments go through
+// Filter when it is set.
+type ThreadService struct {
+	DB     *gorm.DB
+	Filter *filter.Pipeline
+}
+
+// ThreadSummary is a thread as listed, with its comment count.
+type ThreadSummary struct {
+	ID           uint      `json:"id"`
+	MatchID      uint      `json:"matchId"`
+	Kind         string    `json:"kind"`
+	Title        string    `json:"title"`
+	Body         string    `json:"body,omitempty"`
+	CommentCount int64     `json:"commentCount"`
+	Views        int64     `json:"views"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// CommentView is a comment with its author's display name. It never exposes
+// more of the author than the name.
+type CommentView struct {
+	ID         uint          `json:"id"`
+	ThreadID   uint          `json:"threadId"`
+	ParentID   *uint         `json:"parentId"`
+	Depth      int           `json:"depth"`
+	UserID     uint          `json:"userId"`
+	Author     string        `json:"author"`
+	Message    string        `json:"message"`
+	Upvotes    int           `json:"upvotes"`
+	Downvotes  int           `json:"downvotes"`
+	Score      int           `json:"score"`
+	ReplyCount int           `json:"replyCount"`
+	Removed    bool          `json:"removed"`
+	Held       bool          `json:"held,omitempty"`
+	Replies    []CommentView `json:"replies"`
+	CreatedAt  time.Time     `json:"createdAt"`
+}
+
+// CommentQuery selects a page of top-level comments and how much of the
+// reply tree under each to include. Depth 0 returns no replies.
+type CommentQuery struct {
+	Page     int
+	PageSize int
+	Sort     string
+	Depth    int
+}
+
+// List returns threads, newest first, optionally only for one match.
+func (s *ThreadService) List(matchID uint) ([]ThreadSummary, error) {
+	out := []ThreadSummary{}
+	q := s.DB.Model(&models.Thread{}).
+		Select("threads.id, threads.match_id, threads.kind, threads.title, threads.body, threads.views, threads.created_at, "+
+			"(SELECT COUNT(*) FROM comments WHERE comments.thread_id = threads.id AND comments.deleted_at IS NULL AND comments.held = ?) AS comment_count", false)
+	if matchID != 0 {
+		q = q.Where("threads.match_id = ?", matchID)
+	}
+	err := q.Order("threads.created_at desc").Scan(&out).Error
+	return out, err
+}
+
+func (s *ThreadService) Get(id uint) (*ThreadSummary, error) {
+	var t models.Thread
+	if err := s.DB.First(&t, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrThreadNotFound
+		}
+		return nil, err
+	}
+	sum := threadSummary(t)
+	s.DB.Model(&models.Comment{}).Where("thread_id = ? AND held = ?", t.ID, false).Count(&sum.CommentCount)
+	return sum, nil
+}
+
+func (s *ThreadService) Create(matchID uint, title string) (*ThreadSummary, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return nil, errors.New("title is required")
+	}
+	if err := s.DB.First(&models.Match{}, matchID).Error; err != nil {
+		return nil, err
+	}
+	t := models.Thread{MatchID: matchID, Kind: models.ThreadDiscussion, Title: title}
+	if err := s.DB.Create(&t).Error; err != nil {
+		return nil, err
+	}
+	return threadSummary(t), nil
+}
+
+func threadSummary(t models.Thread) *ThreadSummary {
+	return &ThreadSummary{ID: t.ID, MatchID: t.MatchID, Kind: t.Kind, Title: t.Title, Body: t.Body, Views: t.Views, CreatedAt: t.CreatedAt}
+}
+
+// View records a thread view and returns the updated summary.
+func (s *ThreadService) View(id uint) (*ThreadSummary, error) {
+	res := s.DB.Model(&models.Thread{}).Where("id = ?", id).UpdateColumn("views", gorm.Expr("views + 1"))
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return s.Get(id)
+}
+
+// Comments returns one page of a thread's top-level comments in the
+// requested order, each with its replies nested up to q.Depth levels, and
+// the total number of top-level comments.
+func (s *ThreadService) Comments(threadID uint, q CommentQuery) ([]CommentView, int64, error) {
+	if _, err := s.Get(threadID); err != nil {
+		return nil, 0, err
+	}
+	visible := s.DB.Model(&models.Comment{}).Where("thread_id = ? AND held = ?", threadID, false)
+	var total int64
+	if err := visible.Session(&gorm.Session{}).Where("parent_id IS NULL").Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var roots []models.Comment
+	err := visible.Session(&gorm.Session{}).Preload("User").Where("parent_id IS NULL").
+		Order(commentOrder(q.Sort)).Offset((q.Page - 1) * q.PageSize).Limit(q.PageSize).Find(&roots).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	page := make([]CommentView, len(roots))
+	ids := make([]uint, len(roots))
+	for i, cm := range roots {
+		page[i] = commentView(cm)
+		ids[i] = cm.ID
+	}
+
+	// Load the replies under this page only, one level at a time.
+	children := make(map[uint][]CommentView)
+	loaded := append([]uint{}, ids...)
+	for depth := 1; depth <= q.Depth && len(ids) > 0; depth++ {
+		var list []models.Comment
+		err := visible.Session(&gorm.Session{}).Preload("User").Where("parent_id IN ?", ids).Find(&list).Error
+		if err != nil {
+			return nil, 0, err
+		}
+		ids = ids[:0]
+		for _, cm := range list {
+			children[*cm.ParentID] = append(children[*cm.ParentID], commentView(cm))
+			ids = append(ids, cm.ID)
+		}
+		loaded = append(loaded, ids...)
+	}
+	// Reply counts must include replies deeper than the requested depth.
+	counts := make(map[uint]int)
+	if len(loaded) > 0 {
+		var rows []struct {
+			ParentID uint
+			N        int
+		}
+		err := visible.Session(&gorm.Session{}).Select("parent_id, COUNT(*) AS n").
+			Where("parent_id IN ?", loaded).Group("parent_id").Scan(&rows).Error
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, r := range rows {
+			counts[r.ParentID] = r.N
+		}
+	}
+	for i := range page {
+		attachReplies(&page[i], children, counts, q.Sort)
+	}
+	return page, total, nil
+}
+
+// commentOrder is the SQL ORDER BY for a sort mode; it must agree with
+// sortComments, which orders replies once they are loaded.
+func commentOrder(mode string) string {
+	switch mode {
+	case SortOld:
+		return "created_at asc, id asc"
+	case SortTop:
+		return "(upvotes - downvotes) desc, created_at desc, id desc"
+	case SortControversial:
+		return "CASE WHEN upvotes > 0 AND downvotes > 0 THEN POWER(upvotes + downvotes, " +
+			"CASE WHEN upvotes > downvotes THEN downvotes * 1.0 / upvotes ELSE upvotes * 1.0 / downvotes END) " +
+			"ELSE 0 END desc, created_at desc, id desc"
+	}
+	return "created_at desc, id desc"
+}
+
+func attachReplies(v *CommentView, children map[uint][]CommentView, counts map[uint]int, mode string) {
+	v.ReplyCount = counts[v.ID]
+	kids := children[v.ID]
+	sortComments(kids, mode)
+	v.Replies = make([]CommentView, len(kids))
+	copy(v.Replies, kids)
+	for i := range v.Replies {
+		attachReplies(&v.Replies[i], children, counts, mode)
+	}
+}
+
+func sortComments(list []CommentView, mode string) {
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		switch mode {
+		case SortOld:
+			return a.CreatedAt.Before(b.CreatedAt)
+		case SortTop:
+			if a.Score != b.Score {
+				return a.Score > b.Score
+			}
+		case SortControversial:
+			ca, cb := controversy(a.Upvotes, a.Downvotes), controversy(b.Upvotes, b.Downvotes)
+			if ca != cb {
+				return ca > cb
+			}
+		}
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+}
+
+// controversy ranks comments with many votes split evenly highest: the
+// total vote count raised to the balance between up and down votes.
+func controversy(up, down int) float64 {
+	if up <= 0 || down <= 0 {
+		return 0
+	}
+	magnitude := float64(up + down)
+	balance := float64(down) / float64(up)
+	if up < down {
+		balance = float64(up) / float64(down)
+	}
+	return math.Pow(magnitude, balance)
+}
+
+// AddComment posts a comment as userID, as a reply when parentID is set.
+// Users with an active posting ban get ErrPostingBanned. The content filter
+// may reject the comment, mask part of it, or store it held for moderation.
+func (s *ThreadService) AddComment(threadID, userID uint, parentID *uint, message string) (*CommentView, error) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return nil, ErrEmptyComment
+	}
+	if len([]rune(message)) > maxCommentLength {
+		return nil, ErrCommentTooLong
+	}
+	if _, err := s.Get(threadID); err != nil {
+		return nil, err
+	}
+	var author models.User
+	if err := s.DB.First(&author, userID).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+	if author.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+	if ban, err := activeBan(s.DB, userID); err != nil {
+		return nil, err
+	} else if ban != nil {
+		return nil, ErrPostingBanned
+	}
+	cm := models.Comment{ThreadID: threadID, UserID: userID, Message: message}
+	if parentID != nil {
+		var parent models.Comment
+		if err := s.DB.Where("thread_id = ? AND held = ?", threadID, false).First(&parent, *parentID).Error; err != nil {
+			return nil, ErrCommentNotFound
+		}
+		if parent.Depth+1 > MaxCommentDepth {
+			return nil, ErrTooDeep
+		}
+		cm.ParentID = &parent.ID
+		cm.Depth = parent.Depth + 1
+	}
+	if s.Filter != nil {
+		res := s.Filter.Check(userID, message)
+		switch res.Action {
+		case filter.Reject:
+			if res.Filter == filter.NameRate {
+				return nil, ErrPostingTooFast
+			}
+			return nil, fmt.Errorf("%w: %s", ErrCommentRejected, res.Reason)
+		case filter.Hold:
+			cm.Held = true
+			cm.HeldReason = res.Filter + ": " + res.Reason
+		}
+		cm.Message = res.Text
+	}
+	if err := s.DB.Create(&cm).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Preload("User").First(&cm, cm.ID).Error; err != nil {
+		return nil, err
+	}
+	v := commentView(cm)
+	return &v, nil
+}
+
+// Vote sets userID's vote on a comment: 1 up, -1 down, 0 to withdraw. Each
+// user has at most one vote per comment; the comment's counters are
+// recomputed from the vote rows in the same transaction.
+func (s *ThreadService) Vote(commentID, userID uint, value int) (*CommentView, error) {
+	if value < -1 || value > 1 {
+		return nil, ErrInvalidVote
+	}
+	var cm models.Comment
+	if err := s.DB.First(&cm, commentID).Error; err != nil {
+		return nil, ErrCommentNotFound
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("comment_id = ? AND user_id = ?", commentID, userID).
+			Delete(&models.CommentVote{}).Error; err != nil {
+			return err
+		}
+		if value != 0 {
+			if err := tx.Create(&models.CommentVote{CommentID: commentID, UserID: userID, Value: value}).Error; err != nil {
+				return err
+			}
+		}
+		var up, down int64
+		tx.Model(&models.CommentVote{}).Where("comment_id = ? AND value > 0", commentID).Count(&up)
+		tx.Model(&models.CommentVote{}).Where("comment_id = ? AND value < 0", commentID).Count(&down)
+		return tx.Model(&cm).UpdateColumns(map[string]interface{}{"upvotes": up, "downvotes": down}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.DB.Preload("User").First(&cm, cm.ID).Error; err != nil {
+		return nil, err
+	}
+	v := commentView(cm)
+	return &v, nil
+}
+
+// commentView blanks the message of removed comments; the row stays so its
+// replies keep their place in the tree.
+func commentView(cm models.Comment) CommentView {
+	message := cm.Message
+	if cm.RemovedAt != nil {
+		message = ""
+	}
+	return CommentView{
+		ID:        cm.ID,
+		ThreadID:  cm.ThreadID,
+		ParentID:  cm.ParentID,
+		Depth:     cm.Depth,
+		UserID:    cm.UserID,
+		Author:    cm.User.Name,
+		Message:   message,
+		Upvotes:   cm.Upvotes,
+		Downvotes: cm.Downvotes,
+		Score:     cm.Upvotes - cm.Downvotes,
+		Removed:   cm.RemovedAt != nil,
+		Held:      cm.Held,
+		Replies:   []CommentView{},
+		CreatedAt: cm.CreatedAt,
+	}
+}
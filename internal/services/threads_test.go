@@ -0,0 +1,87 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"project/internal/models"
+
+	"gorm.io/gorm"
+)
+
+func seedComment(t *testing.T, db *gorm.DB, threadID, userID uint, parent *models.Comment, up, down int, at time.Time) models.Comment {
+	t.Helper()
+	cm := models.Comment{ThreadID: threadID, UserID: userID, Message: "m", Upvotes: up, Downvotes: down}
+	cm.CreatedAt = at
+	if parent != nil {
+		cm.ParentID = &parent.ID
+		cm.Depth = parent.Depth + 1
+	}
+	if err := db.Create(&cm).Error; err != nil {
+		t.Fatal(err)
+	}
+	return cm
+}
+
+func TestCommentsPagesAndSortsRoots(t *testing.T) {
+	db := newTestDB(t)
+	s := &ThreadService{DB: db}
+	u := createUser(t, db, "fan@example.com", "user")
+	th := models.Thread{MatchID: 1, Title: "t"}
+	db.Create(&th)
+
+	base := time.Now().Add(-time.Hour)
+	a := seedComment(t, db, th.ID, u.ID, nil, 10, 0, base)                    // top
+	b := seedComment(t, db, th.ID, u.ID, nil, 6, 5, base.Add(time.Minute))    // controversial
+	c := seedComment(t, db, th.ID, u.ID, nil, 0, 0, base.Add(2*time.Minute))  // newest
+	r1 := seedComment(t, db, th.ID, u.ID, &a, 0, 0, base.Add(3*time.Minute))  // depth 1
+	r2 := seedComment(t, db, th.ID, u.ID, &r1, 0, 0, base.Add(4*time.Minute)) // depth 2
+	seedComment(t, db, th.ID, u.ID, &r2, 0, 0, base.Add(5*time.Minute))       // depth 3
+	held := models.Comment{ThreadID: th.ID, UserID: u.ID, Message: "h", Held: true}
+	db.Create(&held)
+
+	cases := []struct {
+		sort string
+		want []uint
+	}{
+		{SortNew, []uint{c.ID, b.ID, a.ID}},
+		{SortOld, []uint{a.ID, b.ID, c.ID}},
+		{SortTop, []uint{a.ID, b.ID, c.ID}},
+		{SortControversial, []uint{b.ID, c.ID, a.ID}},
+	}
+	for _, tc := range cases {
+		var got []uint
+		for page := 1; page <= 3; page++ {
+			list, total, err := s.Comments(th.ID, CommentQuery{Page: page, PageSize: 1, Sort: tc.sort})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != 3 {
+				t.Fatalf("%s: total = %d, want 3", tc.sort, total)
+			}
+			for _, v := range list {
+				got = append(got, v.ID)
+			}
+		}
+		if len(got) != 3 || got[0] != tc.want[0] || got[1] != tc.want[1] || got[2] != tc.want[2] {
+			t.Errorf("%s: got %v, want %v", tc.sort, got, tc.want)
+		}
+	}
+
+	list, _, err := s.Comments(th.ID, CommentQuery{Page: 1, PageSize: 10, Sort: SortOld, Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	top := list[0]
+	if top.ID != a.ID || top.ReplyCount != 1 || len(top.Replies) != 1 {
+		t.Fatalf("root = %+v", top)
+	}
+	mid := top.Replies[0].Replies
+	if len(mid) != 1 || mid[0].ID != r2.ID || mid[0].ReplyCount != 1 || len(mid[0].Replies) != 0 {
+		t.Fatalf("depth 2 = %+v, want %d with its deeper reply counted but not loaded", mid, r2.ID)
+	}
+
+	if list, _, _ := s.Comments(th.ID, CommentQuery{Page: 99, PageSize: 10}); len(list) != 0 {
+		t.Fatalf("page past the end returned %d comments", len(list))
+	}
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"project/internal/models"
+	"project/internal/rbac"
+	"project/internal/totp"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// PurposeLogin2FA is the purpose of the challenge handed out between the
+// password and the second factor.
+const PurposeLogin2FA = "login_2fa"
+
+const (
+	challengeTTL       = 5 * time.Minute
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+	// Recovery codes avoid characters that are easy to misread.
+	recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+var (
+	ErrTwoFactorEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorDisabled  = errors.New("two-factor authentication is not enabled")
+	ErrNoPendingSetup     = errors.New("start two-factor setup first")
+	ErrInvalidCode        = errors.New("invalid authentication code")
+	ErrInvalidChallenge   = errors.New("login challenge is invalid or has expired; log in again")
+	ErrTwoFactorMandatory = errors.New("two-factor authentication is required for your role")
+	ErrPasswordIncorrect  = errors.New("password is incorrect")
+)
+
+// TwoFactorRequiredError is returned by Login when the password was right
+// and the account has 2FA: the client finishes with CompleteTwoFactorLogin.
+type TwoFactorRequiredError struct {
+	Challenge string
+	ExpiresIn int // seconds
+}
+
+func (e *TwoFactorRequiredError) Error() string {
+	return "two-factor authentication code required"
+}
+
+// TwoFactorSetup is what an authenticator app needs to enroll.
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// TwoFactorStatus describes a user's 2FA enrollment.
+type TwoFactorStatus struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabledAt"`
+	RecoveryCodesLeft int64      `json:"recoveryCodesLeft"`
+	Required          bool       `json:"required"`
+}
+
+func (s *AuthService) issuer() string {
+	if s.TOTPIssuer != "" {
+		return s.TOTPIssuer
+	}
+	return "EPL Stats"
+}
+
+// twoFactorRequired reports whether the role must use 2FA.
+func (s *AuthService) twoFactorRequired(role string) bool {
+	return s.RequireAdmin2FA && role == rbac.Admin
+}
+
+func (s *AuthService) TwoFactorStatus(userID uint) (*TwoFactorStatus, error) {
+	var u models.User
+	if err := s.DB.First(&u, userID).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+	st := &TwoFactorStatus{Enabled: u.TOTPEnabledAt != nil, EnabledAt: u.TOTPEnabledAt, Required: s.twoFactorRequired(u.Role)}
+	if st.Enabled {
+		s.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&st.RecoveryCodesLeft)
+	}
+	return st, nil
+}
+
+// SetupTwoFactor generates a new secret for the user to scan. It is not
+// active until EnableTwoFactor confirms a code from it.
+func (s *AuthService) SetupTwoFactor(userID uint) (*TwoFactorSetup, error) {
+	var u models.User
+	if err := s.DB.First(&u, userID).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+	if u.TOTPEnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.DB.Model(&u).Update("totp_pending_secret", secret).Error; err != nil {
+		return nil, err
+	}
+	return &TwoFactorSetup{Secret: secret, URI: totp.URI(s.issuer(), u.Email, secret)}, nil
+}
+
+// EnableTwoFactor confirms the pending secret with a code, switches 2FA on
+// and returns the recovery codes, which are shown only this once. The
+// calling session counts as two-factor from now on, so it also gets a new
+// access token (the pair has no refresh token).
+func (s *AuthService) EnableTwoFactor(userID, sessionID uint, code string) ([]string, *TokenPair, error) {
+	var (
+		u     models.User
+		codes []string
+	)
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&u, userID).Error; err != nil {
+			return ErrUserNotFound
+		}
+		if u.TOTPEnabledAt != nil {
+			return ErrTwoFactorEnabled
+		}
+		if u.TOTPPendingSecret == "" {
+			return ErrNoPendingSetup
+		}
+		step, ok := totp.Validate(u.TOTPPendingSecret, code, time.Now())
+		if !ok {
+			return ErrInvalidCode
+		}
+		now := time.Now()
+		if err := tx.Model(&u).Updates(map[string]interface{}{
+			"totp_secret":         u.TOTPPendingSecret,
+			"totp_pending_secret": "",
+			"totp_enabled_at":     now,
+			"totp_last_step":      step,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		if codes, err = replaceRecoveryCodes(tx, userID); err != nil {
+			return err
+		}
+		return tx.Model(&models.Session{}).Where("id = ? AND user_id = ?", sessionID, userID).
+			Update("two_factor", true).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	var sess models.Session
+	if err := s.DB.First(&sess, sessionID).Error; err != nil {
+		return codes, nil, nil
+	}
+	// Only the access token changes; the refresh token stays valid.
+	pair, err := s.pair(&u, &sess, "")
+	if err != nil {
+		return codes, nil, nil
+	}
+	return codes, pair, nil
+}
+
+// DisableTwoFactor turns 2FA off after checking the password and a current
+// code (or recovery code). Roles that must use 2FA cannot turn it off.
+func (s *AuthService) DisableTwoFactor(userID uint, password, code string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var u models.User
+		if err := tx.First(&u, userID).Error; err != nil {
+			return ErrUserNotFound
+		}
+		if u.TOTPEnabledAt == nil {
+			return ErrTwoFactorDisabled
+		}
+		if s.twoFactorRequired(u.Role) {
+			return ErrTwoFactorMandatory
+		}
+		if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+			return ErrPasswordIncorrect
+		}
+		if err := verifySecondFactor(tx, &u, code); err != nil {
+			return err
+		}
+		if err := tx.Model(&u).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Session{}).Where("user_id = ?", userID).Update("two_factor", false).Error
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a
+// current code.
+func (s *AuthService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	var codes []string
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var u models.User
+		if err := tx.First(&u, userID).Error; err != nil {
+			return ErrUserNotFound
+		}
+		if u.TOTPEnabledAt == nil {
+			return ErrTwoFactorDisabled
+		}
+		if err := verifySecondFactor(tx, &u, code); err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// CompleteTwoFactorLogin finishes a login that Login answered with a
+// TwoFactorRequiredError. Wrong codes count as failed logins, so the
+// login guard limits guessing.
+func (s *AuthService) CompleteTwoFactorLogin(challenge, code string, client ClientInfo) (*TokenPair, *models.User, error) {
+	ut, err := s.checkToken(s.DB, challenge, PurposeLogin2FA)
+	if err != nil {
+		return nil, nil, ErrInvalidChallenge
+	}
+	var u models.User
+	if err := s.DB.First(&u, ut.UserID).Error; err != nil || u.TOTPEnabledAt == nil {
+		return nil, nil, ErrInvalidChallenge
+	}
+	if s.Guard != nil {
+		if err := s.Guard.Check(u.Email, client.IP); err != nil {
+			return nil, nil, err
+		}
+	}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, &u, code); err != nil {
+			return err
+		}
+		if claimToken(tx, ut.ID) != nil {
+			return ErrInvalidChallenge
+		}
+		return nil
+	})
+	if errors.Is(err, ErrInvalidCode) {
+		s.loginFailed(u.Email, client.IP, u.ID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.Guard != nil {
+		s.Guard.Succeeded(u.Email)
+	}
+	pair, err := s.startSession(&u, client, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, &u, nil
+}
+
+// twoFactorChallenge is what Login returns instead of a session once the
+// password checks out for a 2FA account.
+func (s *AuthService) twoFactorChallenge(u *models.User) error {
+	challenge, err := s.issueToken(u.ID, PurposeLogin2FA, challengeTTL)
+	if err != nil {
+		return err
+	}
+	return &TwoFactorRequiredError{Challenge: challenge, ExpiresIn: int(challengeTTL / time.Second)}
+}
+
+// verifySecondFactor accepts a TOTP code newer than the last one used, or
+// an unused recovery code.
+func verifySecondFactor(tx *gorm.DB, u *models.User, code string) error {
+	code = strings.TrimSpace(code)
+	if step, ok := totp.Validate(u.TOTPSecret, code, time.Now()); ok {
+		res := tx.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", u.ID, step).
+			Update("totp_last_step", step)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidCode // replayed
+		}
+		return nil
+	}
+	normalized := normalizeRecoveryCode(code)
+	if len(normalized) != recoveryCodeLength {
+		return ErrInvalidCode
+	}
+	res := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", u.ID, hashToken(normalized)).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := randomCode(recoveryCodeLength)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: hashToken(raw)}).Error; err != nil {
+			return nil, err
+		}
+		half := recoveryCodeLength / 2
+		codes = append(codes, raw[:half]+"-"+raw[half:])
+	}
+	return codes, nil
+}
+
+// randomCode draws n characters from recoveryAlphabet, discarding bytes
+// that would bias the modulo.
+func randomCode(n int) (string, error) {
+	limit := byte(256 - 256%len(recoveryAlphabet))
+	out := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(out) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if b < limit && len(out) < n {
+				out = append(out, recoveryAlphabet[int(b)%len(recoveryAlphabet)])
+			}
+		}
+	}
+	return string(out), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"project/internal/models"
+	"project/internal/totp"
+)
+
+// enrollTwoFactor switches 2FA on for userID and returns the secret and
+// recovery codes. The enabling code uses up its time step.
+func enrollTwoFactor(t *testing.T, s *AuthService, userID, sessionID uint) (string, []string) {
+	t.Helper()
+	setup, err := s.SetupTwoFactor(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := totp.Code(setup.Secret, totp.Step(time.Now()))
+	codes, _, err := s.EnableTwoFactor(userID, sessionID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return setup.Secret, codes
+}
+
+// loginChallenge signs in with a password and returns the 2FA challenge.
+func loginChallenge(t *testing.T, s *AuthService, email, password string) string {
+	t.Helper()
+	_, _, err := s.Login(email, password, ClientInfo{})
+	var need *TwoFactorRequiredError
+	if !errors.As(err, &need) {
+		t.Fatalf("login: err = %v, want *TwoFactorRequiredError", err)
+	}
+	return need.Challenge
+}
+
+func TestTOTPCodesWorkOnce(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuth(db)
+	u := createUser(t, db, "fan@example.com", "user")
+	setPassword(t, db, &u, "password1")
+	pair, _, _ := s.Login("fan@example.com", "password1", ClientInfo{})
+	secret, _ := enrollTwoFactor(t, s, u.ID, pair.SessionID)
+
+	// The code that enabled 2FA cannot sign in.
+	var enrolled models.User
+	db.First(&enrolled, u.ID)
+	used, _ := totp.Code(secret, enrolled.TOTPLastStep)
+	challenge := loginChallenge(t, s, "fan@example.com", "password1")
+	if _, _, err := s.CompleteTwoFactorLogin(challenge, used, ClientInfo{}); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("enabling code replayed: err = %v, want ErrInvalidCode", err)
+	}
+
+	next, _ := totp.Code(secret, enrolled.TOTPLastStep+1)
+	session, _, err := s.CompleteTwoFactorLogin(challenge, next, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.SessionActive(session.SessionID) {
+		t.Fatal("2FA login did not start a session")
+	}
+	// The challenge is spent, and so is the code.
+	if _, _, err := s.CompleteTwoFactorLogin(challenge, next, ClientInfo{}); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("challenge reused: err = %v, want ErrInvalidChallenge", err)
+	}
+	again := loginChallenge(t, s, "fan@example.com", "password1")
+	if _, _, err := s.CompleteTwoFactorLogin(again, next, ClientInfo{}); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("code replayed: err = %v, want ErrInvalidCode", err)
+	}
+}
+
+func TestRecoveryCodesWorkOnce(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuth(db)
+	u := createUser(t, db, "fan@example.com", "user")
+	setPassword(t, db, &u, "password1")
+	pair, _, _ := s.Login("fan@example.com", "password1", ClientInfo{})
+	_, codes := enrollTwoFactor(t, s, u.ID, pair.SessionID)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes", len(codes))
+	}
+
+	challenge := loginChallenge(t, s, "fan@example.com", "password1")
+	if _, _, err := s.CompleteTwoFactorLogin(challenge, " "+codes[0]+" ", ClientInfo{}); err != nil {
+		t.Fatalf("recovery code: %v", err)
+	}
+	challenge = loginChallenge(t, s, "fan@example.com", "password1")
+	if _, _, err := s.CompleteTwoFactorLogin(challenge, codes[0], ClientInfo{}); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("recovery code reused: err = %v, want ErrInvalidCode", err)
+	}
+	st, _ := s.TwoFactorStatus(u.ID)
+	if st.RecoveryCodesLeft != int64(recoveryCodeCount-1) {
+		t.Fatalf("codes left = %d", st.RecoveryCodesLeft)
+	}
+}
+
+func TestAdminCannotDisableMandatoryTwoFactor(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuth(db)
+	s.RequireAdmin2FA = true
+	u := createUser(t, db, "admin@example.com", "admin")
+	setPassword(t, db, &u, "password1")
+	secret, _ := enrollTwoFactor(t, s, u.ID, 0)
+	code, _ := totp.Code(secret, totp.Step(time.Now())+1)
+	if err := s.DisableTwoFactor(u.ID, "password1", code); !errors.Is(err, ErrTwoFactorMandatory) {
+		t.Fatalf("err = %v, want ErrTwoFactorMandatory", err)
+	}
+}
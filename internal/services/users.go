@@ -0,0 +1,378 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	netmail "net/mail"
+	"strings"
+	"time"
+
+	"project/internal/mail"
+	"project/internal/models"
+	"project/internal/rbac"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Session revocation reasons for admin actions.
+const (
+	RevokedSuspended   = "suspended"
+	RevokedForcedReset = "forced_reset"
+	RevokedDeleted     = "deleted"
+)
+
+// PurposeInvite signs the link in an invitation email. PurposeBootstrap
+// signs the startup link for an admin without a password; it is separate
+// from password resets so a forgot-password request cannot retire it.
+const (
+	PurposeInvite    = "invite"
+	PurposeBootstrap = "bootstrap_admin"
+)
+
+const (
+	inviteTTL    = 7 * 24 * time.Hour
+	bootstrapTTL = 24 * time.Hour
+)
+
+var (
+	ErrAccountSuspended = errors.New("this account is suspended")
+	ErrNotSuspended     = errors.New("user is not suspended")
+	ErrSelfAction       = errors.New("you cannot do this to your own account")
+	ErrLastAdmin        = errors.New("this is the last active admin; appoint another admin first")
+	ErrInvalidEmail     = errors.New("a valid email address is required")
+	ErrEmailTaken       = errors.New("an account with this email already exists; change its role instead")
+)
+
+// UserFilter narrows the admin user list. Query matches name or email;
+// Suspended, when set, keeps only suspended (true) or active (false) users.
+type UserFilter struct {
+	Query     string
+	Role      string
+	Suspended *bool
+}
+
+// UserView is a user as the admin user list shows it.
+type UserView struct {
+	ID              uint       `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Role            string     `json:"role"`
+	ClubTeamID      *uint      `json:"clubTeamId,omitempty"`
+	EmailVerified   bool       `json:"emailVerified"`
+	HasPassword     bool       `json:"hasPassword"`
+	TwoFactor       bool       `json:"twoFactor"`
+	SuspendedAt     *time.Time `json:"suspendedAt,omitempty"`
+	SuspendedReason string     `json:"suspendedReason,omitempty"`
+	InvitedByID     *uint      `json:"invitedById,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+// likeEscaper makes a search term match literally inside a LIKE pattern
+// declared with ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// ListUsers returns one page of users, newest first.
+func (s *AuthService) ListUsers(f UserFilter, page, pageSize int) ([]UserView, int64, error) {
+	q := s.DB.Model(&models.User{})
+	if term := strings.TrimSpace(strings.ToLower(f.Query)); term != "" {
+		like := "%" + likeEscaper.Replace(term) + "%"
+		q = q.Where(`LOWER(name) LIKE ? ESCAPE '\' OR LOWER(email) LIKE ? ESCAPE '\'`, like, like)
+	}
+	if f.Role != "" {
+		q = q.Where("role = ?", f.Role)
+	}
+	if f.Suspended != nil {
+		if *f.Suspended {
+			q = q.Where("suspended_at IS NOT NULL")
+		} else {
+			q = q.Where("suspended_at IS NULL")
+		}
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var list []models.User
+	if err := q.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&list).Error; err != nil {
+		return nil, 0, err
+	}
+	out := make([]UserView, 0, len(list))
+	for _, u := range list {
+		out = append(out, userView(u))
+	}
+	return out, total, nil
+}
+
+// SuspendUser blocks sign-in for a user and signs out every session.
+func (s *AuthService) SuspendUser(adminID, userID uint, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return ErrReasonRequired
+	}
+	if adminID == userID {
+		return ErrSelfAction
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var u models.User
+		if err := tx.First(&u, userID).Error; err != nil {
+			return ErrUserNotFound
+		}
+		if u.Role == rbac.Admin {
+			if err := keepAnAdmin(tx, u.ID); err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		if err := tx.Model(&u).Updates(map[string]interface{}{"suspended_at": now, "suspended_reason": truncate(reason, 255)}).Error; err != nil {
+			return err
+		}
+		if err := revokeUserSessions(tx, u.ID, RevokedSuspended, now); err != nil {
+			return err
+		}
+		return audit(tx, adminID, models.ModSuspendUser, "user", userID, reason, "")
+	})
+}
+
+// UnsuspendUser lifts a suspension. The user signs in again as usual.
+func (s *AuthService) UnsuspendUser(adminID, userID uint, reason string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var u models.User
+		if err := tx.First(&u, userID).Error; err != nil {
+			return ErrUserNotFound
+		}
+		if u.SuspendedAt == nil {
+			return ErrNotSuspended
+		}
+		if err := tx.Model(&u).Updates(map[string]interface{}{"suspended_at": nil, "suspended_reason": ""}).Error; err != nil {
+			return err
+		}
+		return audit(tx, adminID, models.ModUnsuspendUser, "user", userID, strings.TrimSpace(reason), "")
+	})
+}
+
+// ForcePasswordReset clears a user's password, signs out every session and
+// emails a reset link. Until the user picks a new password only provider
+// sign-in (if linked) works.
+func (s *AuthService) ForcePasswordReset(adminID, userID uint, reason string) error {
+	var u models.User
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&u, userID).Error; err != nil {
+			return ErrUserNotFound
+		}
+		now := time.Now()
+		if err := tx.Model(&u).Update("password_hash", "").Error; err != nil {
+			return err
+		}
+		if err := revokeUserSessions(tx, u.ID, RevokedForcedReset, now); err != nil {
+			return err
+		}
+		return audit(tx, adminID, models.ModForceReset, "user", userID, strings.TrimSpace(reason), "")
+	})
+	if err != nil {
+		return err
+	}
+	token, err := s.issueToken(u.ID, PurposeResetPassword, s.resetTTL())
+	if err != nil {
+		return err
+	}
+	return s.send(mail.Message{
+		To:      u.Email,
+		Subject: "Choose a new password",
+		Body: fmt.Sprintf("Hi %s,\n\nAn administrator has reset the password on your account and signed you out everywhere. Choose a new one here:\n\n%s\n\n"+
+			"The link expires in %s. Once it has, use \"Forgot password\" on the login page to get another.\n",
+			u.Name, s.link("reset", token), humanDuration(s.resetTTL())),
+	})
+}
+
+// DeleteUser removes an account. Personal data is scrubbed before the row
+// is soft-deleted so the email can be registered again, while comments and
+// audit entries keep pointing at a "Deleted user".
+func (s *AuthService) DeleteUser(adminID, userID uint, reason string) error {
+	if adminID == userID {
+		return ErrSelfAction
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var u models.User
+		if err := tx.First(&u, userID).Error; err != nil {
+			return ErrUserNotFound
+		}
+		if u.Role == rbac.Admin {
+			if err := keepAnAdmin(tx, u.ID); err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		if err := revokeUserSessions(tx, u.ID, RevokedDeleted, now); err != nil {
+			return err
+		}
+		for _, m := range []interface{}{&models.UserIdentity{}, &models.RecoveryCode{}, &models.CalendarFeed{}} {
+			if err := tx.Unscoped().Where("user_id = ?", u.ID).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.UserToken{}).Where("user_id = ? AND used_at IS NULL", u.ID).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&u).Updates(map[string]interface{}{
+			"name":                "Deleted user",
+			"email":               fmt.Sprintf("deleted-%d@deleted.invalid", u.ID),
+			"password_hash":       "",
+			"totp_secret":         "",
+			"totp_pending_secret": "",
+			"totp_enabled_at":     nil,
+			"favorite_team_id":    nil,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&u).Error; err != nil {
+			return err
+		}
+		return audit(tx, adminID, models.ModDeleteUser, "user", userID, strings.TrimSpace(reason), "")
+	})
+}
+
+// InviteUser creates an account for email with the given role and emails a
+// link to finish it. The account has no password until the link is used.
+func (s *AuthService) InviteUser(adminID uint, email, name, role string, clubTeamID *uint) (*models.User, error) {
+	email = strings.TrimSpace(strings.ToLower(email))
+	if addr, err := netmail.ParseAddress(email); err != nil || addr.Address != email {
+		return nil, ErrInvalidEmail
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+	var (
+		u       models.User
+		inviter models.User
+	)
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		teamID, err := checkRole(tx, role, clubTeamID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("email = ?", email).First(&models.User{}).Error; err == nil {
+			return ErrEmailTaken
+		}
+		tx.First(&inviter, adminID)
+		u = models.User{Name: truncate(name, 100), Email: email, Role: role, ClubTeamID: teamID, InvitedByID: &adminID}
+		if err := tx.Create(&u).Error; err != nil {
+			return err
+		}
+		return audit(tx, adminID, models.ModInviteUser, "user", u.ID, "", email+" as "+role)
+	})
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.issueToken(u.ID, PurposeInvite, inviteTTL)
+	if err != nil {
+		return nil, err
+	}
+	// The account exists either way; a forced password reset sends a new
+	// link if this email is lost.
+	if err := s.send(mail.Message{
+		To:      u.Email,
+		Subject: "You have been invited",
+		Body: fmt.Sprintf("Hi %s,\n\n%s has invited you to join as %s. Choose a password to finish setting up your account:\n\n%s\n\n"+
+			"The link expires in %s and works once. If you weren't expecting this, ignore this email.\n",
+			u.Name, inviter.Name, role, s.link("invite", token), humanDuration(inviteTTL)),
+	}); err != nil {
+		log.Printf("auth: invitation email to %s: %v", u.Email, err)
+	}
+	return &u, nil
+}
+
+// AcceptInvite consumes an invitation, sets the name and password and
+// signs the new user in. Following the emailed link verifies the address.
+func (s *AuthService) AcceptInvite(token, name, password string, client ClientInfo) (*TokenPair, *models.User, error) {
+	if len(password) < minPasswordLength {
+		return nil, nil, ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, nil, err
+	}
+	var u models.User
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		ut, err := s.consumeToken(tx, token, PurposeInvite)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&u, ut.UserID).Error; err != nil {
+			return ErrInvalidLink
+		}
+		updates := map[string]interface{}{"password_hash": string(hash)}
+		if u.EmailVerifiedAt == nil {
+			updates["email_verified_at"] = time.Now()
+		}
+		if name = strings.TrimSpace(name); name != "" {
+			updates["name"] = truncate(name, 100)
+		}
+		return tx.Model(&u).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	pair, err := s.startSession(&u, client, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, &u, nil
+}
+
+// BootstrapAdmin returns a one-time link for choosing the password of an
+// admin without one: the admin created at first start without
+// ADMIN_PASSWORD, or an old seeded admin whose published password was
+// cleared. It returns "" when the admin already has a password or a linked
+// provider account. A new link is issued on every start until one is used;
+// the reset page accepts it.
+func (s *AuthService) BootstrapAdmin(email string) (string, error) {
+	var u models.User
+	if err := s.DB.Where("email = ? AND role = ?", strings.TrimSpace(strings.ToLower(email)), rbac.Admin).First(&u).Error; err != nil {
+		return "", nil
+	}
+	var linked int64
+	s.DB.Model(&models.UserIdentity{}).Where("user_id = ?", u.ID).Count(&linked)
+	if u.PasswordHash != "" || linked > 0 {
+		return "", nil
+	}
+	token, err := s.issueToken(u.ID, PurposeBootstrap, bootstrapTTL)
+	if err != nil {
+		return "", err
+	}
+	return s.link("reset", token), nil
+}
+
+// keepAnAdmin fails if userID is the only active admin, so the site cannot
+// lose its last one to a demotion, suspension or deletion.
+func keepAnAdmin(tx *gorm.DB, userID uint) error {
+	var n int64
+	if err := tx.Model(&models.User{}).
+		Where("role = ? AND id <> ? AND suspended_at IS NULL", rbac.Admin, userID).
+		Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+func userView(u models.User) UserView {
+	return UserView{
+		ID:              u.ID,
+		Name:            u.Name,
+		Email:           u.Email,
+		Role:            u.Role,
+		ClubTeamID:      u.ClubTeamID,
+		EmailVerified:   u.EmailVerifiedAt != nil,
+		HasPassword:     u.PasswordHash != "",
+		TwoFactor:       u.TOTPEnabledAt != nil,
+		SuspendedAt:     u.SuspendedAt,
+		SuspendedReason: u.SuspendedReason,
+		InvitedByID:     u.InvitedByID,
+		CreatedAt:       u.CreatedAt,
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"project/internal/models"
+	"project/internal/rbac"
+)
+
+func TestLastAdminCannotBeRemoved(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuth(db)
+	mod := &ModerationService{DB: db}
+	admin := createUser(t, db, "admin@example.com", rbac.Admin)
+	other := createUser(t, db, "other@example.com", rbac.Admin)
+
+	// A suspended admin cannot sign in, so it does not count.
+	if err := s.SuspendUser(admin.ID, other.ID, "left the club"); err != nil {
+		t.Fatal(err)
+	}
+	checks := map[string]error{
+		"demote":  mod.SetRole(other.ID, admin.ID, rbac.Editor, nil),
+		"suspend": s.SuspendUser(other.ID, admin.ID, "testing"),
+		"delete":  s.DeleteUser(other.ID, admin.ID, "testing"),
+	}
+	for name, err := range checks {
+		if !errors.Is(err, ErrLastAdmin) {
+			t.Errorf("%s: err = %v, want ErrLastAdmin", name, err)
+		}
+	}
+	var got models.User
+	db.First(&got, admin.ID)
+	if got.Role != rbac.Admin || got.SuspendedAt != nil {
+		t.Fatalf("last admin changed: role %s, suspended %v", got.Role, got.SuspendedAt)
+	}
+
+	if err := s.UnsuspendUser(admin.ID, other.ID, "back"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mod.SetRole(other.ID, admin.ID, rbac.Editor, nil); err != nil {
+		t.Fatalf("demote with another admin: %v", err)
+	}
+}
+
+func TestAdminCannotActOnThemselves(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuth(db)
+	admin := createUser(t, db, "admin@example.com", rbac.Admin)
+	createUser(t, db, "other@example.com", rbac.Admin)
+
+	if err := s.SuspendUser(admin.ID, admin.ID, "oops"); !errors.Is(err, ErrSelfAction) {
+		t.Errorf("suspend self: err = %v, want ErrSelfAction", err)
+	}
+	if err := s.DeleteUser(admin.ID, admin.ID, "oops"); !errors.Is(err, ErrSelfAction) {
+		t.Errorf("delete self: err = %v, want ErrSelfAction", err)
+	}
+}
+
+var inviteLink = regexp.MustCompile(`/auth\?invite=(\S+)`)
+
+func TestInviteIsAcceptedOnce(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuth(db)
+	admin := createUser(t, db, "admin@example.com", rbac.Admin)
+
+	u, err := s.InviteUser(admin.ID, "Editor@Example.com", "", rbac.Editor, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Email != "editor@example.com" || u.PasswordHash != "" {
+		t.Fatalf("invited account = %+v", u)
+	}
+	if _, err := s.InviteUser(admin.ID, "editor@example.com", "", rbac.Editor, nil); !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("second invite: err = %v, want ErrEmailTaken", err)
+	}
+	if _, err := s.InviteUser(admin.ID, "official@example.com", "", rbac.ClubOfficial, nil); !errors.Is(err, ErrClubTeamNeeded) {
+		t.Fatalf("club official without team: err = %v, want ErrClubTeamNeeded", err)
+	}
+
+	sent := s.Mailer.(*outbox).sent
+	m := inviteLink.FindStringSubmatch(sent[len(sent)-1].Body)
+	if m == nil {
+		t.Fatal("no invite link in email")
+	}
+	token, _ := url.QueryUnescape(m[1])
+
+	if _, _, err := s.AcceptInvite(token, "Ed", "short", ClientInfo{}); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("weak password: err = %v, want ErrWeakPassword", err)
+	}
+	pair, got, err := s.AcceptInvite(token, "Ed", "password1", ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.AccessToken == "" || got.Role != rbac.Editor || got.EmailVerifiedAt == nil {
+		t.Fatalf("accepted account = %+v", got)
+	}
+	if _, _, err := s.AcceptInvite(token, "Ed", "password2", ClientInfo{}); !errors.Is(err, ErrInvalidLink) {
+		t.Fatalf("reused invite: err = %v, want ErrInvalidLink", err)
+	}
+	if _, _, err := s.Login("editor@example.com", "password1", ClientInfo{}); err != nil {
+		t.Fatalf("login after accepting: %v", err)
+	}
+}
+
+func TestBootstrapAdminOnlyWithoutPassword(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuth(db)
+	admin := createUser(t, db, "admin@example.com", rbac.Admin)
+
+	link, err := s.BootstrapAdmin("Admin@example.com")
+	if err != nil || link == "" {
+		t.Fatalf("BootstrapAdmin = %q, %v; want a link", link, err)
+	}
+	setPassword(t, db, &admin, "password1")
+	if link, _ := s.BootstrapAdmin("admin@example.com"); link != "" {
+		t.Fatalf("BootstrapAdmin with a password = %q, want none", link)
+	}
+}
+
+func TestListUsersMatchesWildcardsLiterally(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuth(db)
+	createUser(t, db, "a_b@example.com", rbac.User)
+	createUser(t, db, "axb@example.com", rbac.User)
+	createUser(t, db, "100%fan@example.com", rbac.User)
+
+	cases := map[string]int{"a_b": 1, "%": 1, "_": 1, "ab": 0, "example": 3}
+	for q, want := range cases {
+		_, total, err := s.ListUsers(UserFilter{Query: q}, 1, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != int64(want) {
+			t.Errorf("search %q: %d users, want %d", q, total, want)
+		}
+	}
+}
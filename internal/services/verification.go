@@ -0,0 +1,267 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/internal/mail"
+	"project/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Purposes of emailed tokens. The purpose is part of the signature, so a
+// verification link cannot be replayed as a reset link.
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+// RevokedPasswordReset is the session revocation reason after a reset.
+const RevokedPasswordReset = "password_reset"
+
+const minPasswordLength = 8
+
+var (
+	ErrInvalidLink      = errors.New("this link is invalid or has expired")
+	ErrAlreadyVerified  = errors.New("email is already verified")
+	ErrEmailNotVerified = errors.New("verify your email address before posting")
+	ErrWeakPassword     = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+)
+
+func (s *AuthService) verifyTTL() time.Duration {
+	if s.VerifyTTL > 0 {
+		return s.VerifyTTL
+	}
+	return 48 * time.Hour
+}
+
+func (s *AuthService) resetTTL() time.Duration {
+	if s.ResetTTL > 0 {
+		return s.ResetTTL
+	}
+	return time.Hour
+}
+
+// SendVerification emails the user a fresh verification link. Older links
+// stop working.
+func (s *AuthService) SendVerification(userID uint) error {
+	var u models.User
+	if err := s.DB.First(&u, userID).Error; err != nil {
+		return ErrUserNotFound
+	}
+	if u.EmailVerifiedAt != nil {
+		return ErrAlreadyVerified
+	}
+	token, err := s.issueToken(u.ID, PurposeVerifyEmail, s.verifyTTL())
+	if err != nil {
+		return err
+	}
+	return s.send(mail.Message{
+		To:      u.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address to start posting in match threads:\n\n%s\n\n"+
+			"The link expires in %s. If you didn't create an account, ignore this email.\n",
+			u.Name, s.link("verify", token), humanDuration(s.verifyTTL())),
+	})
+}
+
+// VerifyEmail consumes a verification token.
+func (s *AuthService) VerifyEmail(token string) (*models.User, error) {
+	var u models.User
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		ut, err := s.consumeToken(tx, token, PurposeVerifyEmail)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&u, ut.UserID).Error; err != nil {
+			return ErrInvalidLink
+		}
+		if u.EmailVerifiedAt == nil {
+			now := time.Now()
+			u.EmailVerifiedAt = &now
+			return tx.Model(&u).Update("email_verified_at", now).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// RequestPasswordReset emails a reset link if the address belongs to an
+// account. Unknown addresses succeed silently so the endpoint cannot be used
+// to find out who is registered.
+func (s *AuthService) RequestPasswordReset(email string) error {
+	var u models.User
+	if err := s.DB.Where("email = ?", strings.TrimSpace(strings.ToLower(email))).First(&u).Error; err != nil {
+		return nil
+	}
+	token, err := s.issueToken(u.ID, PurposeResetPassword, s.resetTTL())
+	if err != nil {
+		return err
+	}
+	return s.send(mail.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. To choose a new one, open:\n\n%s\n\n"+
+			"The link expires in %s and works once. If it wasn't you, ignore this email; your password has not changed.\n",
+			u.Name, s.link("reset", token), humanDuration(s.resetTTL())),
+	})
+}
+
+// ResetPassword consumes a reset (or admin bootstrap) token and sets a new
+// password. Every session is signed out, and since the user proved they
+// read the inbox the address counts as verified.
+func (s *AuthService) ResetPassword(token, password string) error {
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		ut, err := s.consumeToken(tx, token, PurposeResetPassword)
+		if errors.Is(err, ErrInvalidLink) {
+			ut, err = s.consumeToken(tx, token, PurposeBootstrap)
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&models.User{}).Where("id = ?", ut.UserID).
+			Update("password_hash", string(hash)).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ? AND email_verified_at IS NULL", ut.UserID).
+			Update("email_verified_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", ut.UserID).
+			Updates(map[string]interface{}{"revoked_at": now, "revoked_reason": RevokedPasswordReset}).Error
+	})
+}
+
+// issueToken stores a token row and returns the signed link token. Earlier
+// unused tokens for the same purpose are retired so only the newest email
+// works.
+func (s *AuthService) issueToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	ut := models.UserToken{UserID: userID, Purpose: purpose, ExpiresAt: now.Add(ttl)}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&ut).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	payload := strconv.FormatUint(uint64(ut.ID), 10) + "." + strconv.FormatInt(ut.ExpiresAt.Unix(), 10)
+	return payload + "." + s.sign(purpose, payload), nil
+}
+
+// consumeToken checks a token and marks it used, so it works exactly once.
+func (s *AuthService) consumeToken(tx *gorm.DB, token, purpose string) (*models.UserToken, error) {
+	ut, err := s.checkToken(tx, token, purpose)
+	if err != nil {
+		return nil, err
+	}
+	if err := claimToken(tx, ut.ID); err != nil {
+		return nil, err
+	}
+	return ut, nil
+}
+
+// checkToken verifies the signature and expiry and that the token is still
+// unused, without using it up.
+func (s *AuthService) checkToken(tx *gorm.DB, token, purpose string) (*models.UserToken, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidLink
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(s.sign(purpose, payload))) {
+		return nil, ErrInvalidLink
+	}
+	id, err1 := strconv.ParseUint(parts[0], 10, 64)
+	exp, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil || time.Now().Unix() > exp {
+		return nil, ErrInvalidLink
+	}
+	var ut models.UserToken
+	if err := tx.Where("purpose = ? AND used_at IS NULL", purpose).First(&ut, id).Error; err != nil {
+		return nil, ErrInvalidLink
+	}
+	if time.Now().After(ut.ExpiresAt) {
+		return nil, ErrInvalidLink
+	}
+	return &ut, nil
+}
+
+// claimToken marks a token used with a conditional update, so of two
+// concurrent requests only one wins.
+func claimToken(tx *gorm.DB, id uint) error {
+	res := tx.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidLink
+	}
+	return nil
+}
+
+func (s *AuthService) sign(purpose, payload string) string {
+	mac := hmac.New(sha256.New, []byte(s.JWTSecret))
+	mac.Write([]byte(purpose + "." + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *AuthService) link(param, token string) string {
+	base := strings.TrimRight(s.BaseURL, "/")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	return base + "/auth?" + param + "=" + url.QueryEscape(token)
+}
+
+func (s *AuthService) send(m mail.Message) error {
+	if s.Mailer == nil {
+		log.Printf("mail: no mailer configured, dropping %q to %s", m.Subject, m.To)
+		return nil
+	}
+	return s.Mailer.Send(m)
+}
+
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		if n := int(d / (24 * time.Hour)); n != 1 {
+			return fmt.Sprintf("%d days", n)
+		}
+		return "1 day"
+	case d >= time.Hour && d%time.Hour == 0:
+		if n := int(d / time.Hour); n != 1 {
+			return fmt.Sprintf("%d hours", n)
+		}
+		return "1 hour"
+	}
+	return fmt.Sprintf("%d minutes", int(d/time.Minute))
+}
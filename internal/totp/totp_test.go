@@ -0,0 +1,52 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the RFC 6238 SHA-1 test key "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	// The RFC lists 8-digit values; these are their last 6 digits.
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tc := range cases {
+		got, err := Code(rfcSecret, Step(time.Unix(tc.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("Code at %d = %s, want %s", tc.unix, got, tc.want)
+		}
+	}
+}
+
+func TestValidateAllowsOneStepOfSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := Step(now)
+	for _, d := range []int64{-1, 0, 1} {
+		code, _ := Code(rfcSecret, step+d)
+		got, ok := Validate(rfcSecret, code[:3]+" "+code[3:], now)
+		if !ok || got != step+d {
+			t.Errorf("step %+d: Validate = %d, %v", d, got, ok)
+		}
+	}
+	for _, d := range []int64{-2, 2} {
+		code, _ := Code(rfcSecret, step+d)
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("step %+d accepted", d)
+		}
+	}
+	if _, ok := Validate(rfcSecret, "12345", now); ok {
+		t.Error("short code accepted")
+	}
+}
@@ -10,76 +10,9 @@ import (
 	"project/models"
 	"project/storage"
 	"strconv"
-	"sync"
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
-}
-
-var wsClients = make(map[*websocket.Conn]bool)
-var wsMutex sync.Mutex
-
-func broadcastStandings(standings []map[string]interface{}) {
-	wsMutex.Lock()
-	defer wsMutex.Unlock()
-	for c := range wsClients {
-		c.WriteJSON(map[string]interface{}{"standings": standings})
-	}
-}
-
-func wsStandingsHandler(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		return
-	}
-	wsMutex.Lock()
-	wsClients[conn] = true
-	wsMutex.Unlock()
-	// Send initial standings
-	standings := getLiveStandings()
-	conn.WriteJSON(map[string]interface{}{"standings": standings})
-	for {
-		_, _, err := conn.ReadMessage()
-		if err != nil {
-			break
-		}
-	}
-	wsMutex.Lock()
-	delete(wsClients, conn)
-	wsMutex.Unlock()
-	conn.Close()
-}
-
-// Dummy function for now, should call TableService and mark live teams
-func getLiveStandings() []map[string]interface{} {
-	// Full league table with Manchester United first
-	return []map[string]interface{}{
-		{"team": "Manchester United", "played": 25, "points": 65, "gd": 40, "live": true},
-		{"team": "Arsenal", "played": 25, "points": 60, "gd": 35, "live": false},
-		{"team": "Man City", "played": 25, "points": 59, "gd": 33, "live": false},
-		{"team": "Liverpool", "played": 25, "points": 58, "gd": 30, "live": false},
-		{"team": "Chelsea", "played": 25, "points": 45, "gd": 10, "live": false},
-		{"team": "Tottenham", "played": 25, "points": 43, "gd": 8, "live": false},
-		{"team": "Newcastle", "played": 25, "points": 41, "gd": 12, "live": false},
-		{"team": "Brighton", "played": 25, "points": 39, "gd": 7, "live": false},
-		{"team": "Brentford", "played": 25, "points": 36, "gd": 3, "live": false},
-		{"team": "Fulham", "played": 25, "points": 35, "gd": 2, "live": false},
-		{"team": "Crystal Palace", "played": 25, "points": 30, "gd": -5, "live": false},
-		{"team": "Aston Villa", "played": 25, "points": 29, "gd": -7, "live": false},
-		{"team": "Leicester", "played": 25, "points": 28, "gd": -8, "live": false},
-		{"team": "Wolves", "played": 25, "points": 27, "gd": -10, "live": false},
-		{"team": "West Ham", "played": 25, "points": 25, "gd": -12, "live": false},
-		{"team": "Leeds", "played": 25, "points": 23, "gd": -15, "live": false},
-		{"team": "Everton", "played": 25, "points": 22, "gd": -18, "live": false},
-		{"team": "Bournemouth", "played": 25, "points": 21, "gd": -20, "live": false},
-		{"team": "Southampton", "played": 25, "points": 18, "gd": -25, "live": false},
-	}
-}
-
 func feedHandler(w http.ResponseWriter, r *http.Request) {
 	tmpl := template.Must(template.ParseFiles("web/templates/index.html"))
 	tmpl.Execute(w, nil)
@@ -121,13 +54,6 @@ func backgroundWorker() {
 }
 
 func main() {
-	http.HandleFunc("/api/calendar/", func(w http.ResponseWriter, r *http.Request) {
-		// Stub: serve a downloadable .ics file for the favorite team
-		w.Header().Set("Content-Type", "text/calendar")
-		w.Header().Set("Content-Disposition", "attachment; filename=matches.ics")
-		// TODO: Generate real calendar data from DB
-		w.Write([]byte("BEGIN:VCALENDAR\nVERSION:2.0\nPRODID:-//EPLHub//EN\nEND:VCALENDAR\n"))
-	})
 	// Initialize Redis (default: localhost:6379, db 0, no password)
 	cache.InitRedis("localhost:6379", "", 0)
 	go backgroundWorker()
@@ -140,7 +66,6 @@ func main() {
 	http.HandleFunc("/league", leagueTableHandler)
 	http.HandleFunc("/account", accountHandler)
 	http.HandleFunc("/ping", pingHandler)
-	http.HandleFunc("/ws/standings", wsStandingsHandler)
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("web/static"))))
 	http.Handle("/templates/", http.StripPrefix("/templates/", http.FileServer(http.Dir("web/templates"))))
 